@@ -2,16 +2,20 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
-	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Netcracker/qubership-kube-events-reader/pkg/controller"
 	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/format"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/redaction"
 	"github.com/Netcracker/qubership-kube-events-reader/pkg/sink"
 	"github.com/Netcracker/qubership-kube-events-reader/pkg/utils"
 	"github.com/go-logr/logr"
@@ -23,10 +27,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
 )
 
-const (
-	logsType    = "logs"
-	metricsType = "metrics"
-)
+const logsType = "logs"
 
 var Logger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo, ReplaceAttr: utils.ReplaceAttrs, AddSource: true}))
 
@@ -50,15 +51,24 @@ func validateFormatInput(printFormat string) error {
 func main() {
 	var namespaceFlags utils.NamespaceFlagsType
 	flag.Var(&namespaceFlags, "namespace", "Namespace to watch for events. The parameter can be used multiple times. If parameter is not set events of all namespaces will be watched")
-	var outputs utils.SinksFlagsType
-	flag.Var(&outputs, "output", "Outputs for events. The parameter can be used multiple times. The parameter has two available values: metrics or/and logs.")
+	var outputs sink.OutputsFlag
+	flag.Var(&outputs, "output", "Outputs for events. The parameter can be used multiple times. Available values: "+strings.Join(sink.Types(), ", ")+".")
 	workers := flag.Int("workers", 2, "Workers number for controller")
-	printFormat := flag.String("format", "", "Format to print Event. It should be valid Golang template of `text/template` package")
+	printFormat := flag.String("format", "", "Format to print Event. It should be valid Golang template of `text/template` package or `cloudevents` to print Event as structured CloudEvent")
+	clusterName := flag.String("clusterName", "", "Name of the cluster which is used in source attribute of CloudEvents")
 	metricsPort := flag.String("metricsPort", "9999", "Port to expose Prometheus metrics on")
 	metricsPath := flag.String("metricsPath", "/metrics", "HTTP path to scrape for Prometheus metrics")
 	filterFile := flag.String("filtersPath", "", "Absolute path to file with filter events configuration")
 	pprofEnabled := flag.Bool("pprofEnable", true, "Enable pprof")
 	healthServePort := flag.String("pprofAddr", "8080", "Port to health and pprof endpoint")
+	serverPort := flag.String("serverPort", "", "Port of one server for metrics, health and pprof endpoints. metricsPort and pprofAddr are not used if it is set")
+	goCollector := flag.Bool("goCollector", false, "Expose metrics of Go runtime")
+	processCollector := flag.Bool("processCollector", false, "Expose metrics of CPU, memory and file descriptors of the process")
+	tlsCertFile := flag.String("tlsCertFile", "", "Path to TLS certificate of the server exposing metrics. The certificate is reloaded when the file changes")
+	tlsKeyFile := flag.String("tlsKeyFile", "", "Path to TLS key of the server exposing metrics")
+	tlsClientCAFile := flag.String("tlsClientCAFile", "", "Path to CA certificates. Clients of metrics and pprof endpoints must present certificates signed by them if it is set")
+	metricsAuth := flag.String("metricsAuth", "", "Authentication of requests to metrics and pprof endpoints: "+utils.AuthModeToken+" or "+utils.AuthModeKubernetes+". Requests are not authenticated if it is empty")
+	metricsTokenFile := flag.String("metricsTokenFile", "", "Path to file with bearer token required by "+utils.AuthModeToken+" authentication")
 	flag.Parse()
 
 	// Validate the input format string.
@@ -88,6 +98,7 @@ func main() {
 	}
 
 	slog.Info("starting K8s Events Reader...")
+	format.ClusterName = *clusterName
 
 	if len(outputs) < 1 {
 		slog.Warn("output for events is not set. Output in logs is used by default")
@@ -102,6 +113,16 @@ func main() {
 		slog.Error("could not parse filter events configuration. See `filtersPath` parameters and content of the file")
 		os.Exit(1)
 	}
+	if err = sink.ValidateFilters(filters); err != nil {
+		slog.Error("filter events configuration is not valid", "error", err)
+		os.Exit(1)
+	}
+	metricsEndpoint := sink.NewMetricsEndpoint(sink.MetricsEndpointOptions{GoCollector: *goCollector, ProcessCollector: *processCollector})
+	redactor, err := redaction.NewRedactor(filters.Redaction, metricsEndpoint)
+	if err != nil {
+		slog.Error("redaction configuration is not valid", "error", err)
+		os.Exit(1)
+	}
 
 	cfg := ctrl.GetConfigOrDie()
 	cfg.ContentType = "application/vnd.kubernetes.protobuf"
@@ -115,23 +136,25 @@ func main() {
 
 	srvBaseCtx := signals.SetupSignalHandler()
 	var sinks []sink.ISink
-	if slices.Contains(outputs, logsType) {
-		stdoutSink, err := sink.InitStdoutSink(*printFormat, filters.GetSinkFiltersByName(logsType))
-		if err != nil {
-			slog.Error("error occurred during initialization of logs output", "error", err)
-			os.Exit(1)
-		}
-		sinks = append(sinks, stdoutSink)
-		slog.Info("sink initialized successfully", "sink", "stdout")
-	}
-	if slices.Contains(outputs, metricsType) {
-		metricsSink, err := sink.InitMetricsSink(srvBaseCtx, *metricsPort, *metricsPath, filters.GetSinkFiltersByName(metricsType), nil)
-		if err != nil {
-			slog.Error("error occurred during initialization of metrics output", "error", err)
-			os.Exit(1)
+	var redactedSinks []bool
+	var sinkNames []string
+	var hasMetricsSink bool
+	options := &sink.Options{PrintFormat: *printFormat, MetricsEndpoint: metricsEndpoint}
+	for _, output := range outputs {
+		for _, sinkFilters := range filters.GetSinksByType(output) {
+			outputSink, err := sink.New(srvBaseCtx, output, options, sinkFilters)
+			if err != nil {
+				slog.Error(fmt.Sprintf("error occurred during initialization of %s output", sinkFilters.Name), "error", err)
+				os.Exit(1)
+			}
+			sinks = append(sinks, outputSink)
+			redactedSinks = append(redactedSinks, filters.Redaction.IsRedactedFor(sinkFilters))
+			sinkNames = append(sinkNames, sinkFilters.Name)
+			if _, ok := outputSink.(*sink.PrometheusMetricsSink); ok {
+				hasMetricsSink = true
+			}
+			slog.Info("sink initialized successfully", "sink", sinkFilters.Name, "type", output)
 		}
-		sinks = append(sinks, metricsSink)
-		slog.Info("sink initialized successfully", "sink", "metrics")
 	}
 	filters = nil
 
@@ -143,24 +166,85 @@ func main() {
 		controllers = controller.NewNamespacedEventControllers(kubeClient, observedNamespaces, controller.NewListerWatcherFunc(), sinks)
 	}
 	stop := make(chan struct{})
-	defer close(stop)
+	var running sync.WaitGroup
 	for _, c := range controllers {
-		go c.Run(*workers, stop)
+		c.SetRedaction(redactor, redactedSinks)
+		c.SetSinkNames(sinkNames)
+		running.Go(func() { c.Run(*workers, stop) })
 	}
 
-	srv, err := utils.StartHealthEndpoint(srvBaseCtx, *pprofEnabled, *healthServePort)
+	var serverTLS *tls.Config
+	if len(*tlsCertFile) > 0 || len(*tlsKeyFile) > 0 || len(*tlsClientCAFile) > 0 {
+		if serverTLS, err = utils.NewTLSConfig(srvBaseCtx, *tlsCertFile, *tlsKeyFile, *tlsClientCAFile); err != nil {
+			slog.Error("TLS configuration of metrics endpoint is not valid", "error", err)
+			os.Exit(1)
+		}
+	}
+	authorizer, err := utils.NewTokenAuthorizer(*metricsAuth, *metricsTokenFile, kubeClient)
 	if err != nil {
-		slog.Error("could not start health endpoint", "error", err)
+		slog.Error("authentication of metrics endpoint is not valid", "error", err)
+		os.Exit(1)
+	}
+
+	var servers []*http.Server
+	if len(*serverPort) > 0 {
+		srv, err := utils.StartServer(srvBaseCtx, utils.ServerOptions{
+			Port:                     *serverPort,
+			Health:                   true,
+			Pprof:                    *pprofEnabled,
+			Metrics:                  metricsEndpoint.Handler(),
+			MetricsPath:              *metricsPath,
+			TLS:                      serverTLS,
+			Auth:                     authorizer,
+			RequireClientCertificate: len(*tlsClientCAFile) > 0,
+		})
+		if err != nil {
+			slog.Error("could not start server", "error", err)
+		} else {
+			servers = append(servers, srv)
+		}
+	} else {
+		srv, err := utils.StartHealthEndpoint(srvBaseCtx, *pprofEnabled, *healthServePort)
+		if err != nil {
+			slog.Error("could not start health endpoint", "error", err)
+		} else {
+			servers = append(servers, srv)
+		}
+		if hasMetricsSink {
+			srv, err = utils.StartServer(srvBaseCtx, utils.ServerOptions{
+				Port:                     *metricsPort,
+				Metrics:                  metricsEndpoint.Handler(),
+				MetricsPath:              *metricsPath,
+				TLS:                      serverTLS,
+				Auth:                     authorizer,
+				RequireClientCertificate: len(*tlsClientCAFile) > 0,
+			})
+			if err != nil {
+				slog.Error("could not start metrics endpoint", "error", err)
+				os.Exit(1)
+			}
+			servers = append(servers, srv)
+		}
 	}
 
 	<-srvBaseCtx.Done()
 	slog.Info("stopping application")
 
-	if err = Shutdown(srvBaseCtx, 30*time.Second,
+	// the signal context is already done, so the shutdown timeout starts from now
+	if err = Shutdown(context.WithoutCancel(srvBaseCtx), 30*time.Second,
+		func(ctx context.Context) {
+			stopControllers(ctx, stop, &running)
+			if err := sink.Close(ctx, sinks); err != nil {
+				slog.Error("could not close sinks gracefully", "error", err)
+			}
+			slog.Info("sinks are closed")
+		},
 		func(ctx context.Context) {
-			if err = srv.Shutdown(ctx); err != nil {
-				slog.Error(fmt.Sprintf("failed to shut down HTTP server gracefully in time. Error: %s", err))
-				slog.Info("force closing http server", "error", srv.Close())
+			for _, srv := range servers {
+				if err := srv.Shutdown(ctx); err != nil {
+					slog.Error(fmt.Sprintf("failed to shut down HTTP server gracefully in time. Error: %s", err))
+					slog.Info("force closing http server", "error", srv.Close())
+				}
 			}
 			slog.Info("http server is shut down")
 		},
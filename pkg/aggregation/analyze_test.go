@@ -130,3 +130,25 @@ func TestGetCommonMessageRoutesByKind(t *testing.T) {
 		t.Fatalf("expected default fallback to require message match for OwnerRefInvalidNamespace, got %q", got)
 	}
 }
+
+func TestGetWorkloadName(t *testing.T) {
+	testCases := []struct {
+		kind     string
+		name     string
+		workload string
+	}{
+		{kind: "Pod", name: "monitoring-operator-5c6b9d7f8-x2kqz", workload: "monitoring-operator"},
+		{kind: "Pod", name: "fluent-bit-7xk2p", workload: "fluent-bit"},
+		{kind: "Pod", name: "postgres-1", workload: "postgres"},
+		{kind: "Pod", name: "standalone", workload: "standalone"},
+		{kind: "ReplicaSet", name: "monitoring-operator-5c6b9d7f8", workload: "monitoring-operator"},
+		{kind: "Deployment", name: "monitoring-operator", workload: "monitoring-operator"},
+		{kind: "Node", name: "worker-1", workload: "worker-1"},
+	}
+
+	for _, testCase := range testCases {
+		if got := GetWorkloadName(testCase.kind, testCase.name); got != testCase.workload {
+			t.Fatalf("expected workload of %s %q to be %q, got %q", testCase.kind, testCase.name, testCase.workload, got)
+		}
+	}
+}
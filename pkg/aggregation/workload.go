@@ -0,0 +1,31 @@
+package aggregation
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	deploymentPodNameRegexp = regexp.MustCompile("^(.+)-[bcdfghjklmnpqrstvwxz2456789]{6,10}-[bcdfghjklmnpqrstvwxz2456789]{5}$")
+	replicaSetNameRegexp    = regexp.MustCompile("^(.+)-[bcdfghjklmnpqrstvwxz2456789]{6,10}$")
+	statefulSetPodRegexp    = regexp.MustCompile("^(.+)-\\d+$")
+	generatedPodNameRegexp  = regexp.MustCompile("^(.+)-[bcdfghjklmnpqrstvwxz2456789]{5}$")
+)
+
+// GetWorkloadName returns the name of the workload which the involved object most likely belongs to.
+// Generated suffixes of Pods and ReplicaSets are cut off, names of other kinds are returned as is
+func GetWorkloadName(kind string, name string) string {
+	switch strings.ToLower(kind) {
+	case kindPod:
+		for _, expression := range []*regexp.Regexp{deploymentPodNameRegexp, generatedPodNameRegexp, statefulSetPodRegexp} {
+			if matches := expression.FindStringSubmatch(name); matches != nil {
+				return matches[1]
+			}
+		}
+	case kindReplicaSet:
+		if matches := replicaSetNameRegexp.FindStringSubmatch(name); matches != nil {
+			return matches[1]
+		}
+	}
+	return name
+}
@@ -2,13 +2,16 @@ package controller
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"slices"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/redaction"
 	"github.com/Netcracker/qubership-kube-events-reader/pkg/sink"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -31,8 +34,26 @@ type EventController struct {
 
 	queue workqueue.TypedRateLimitingInterface[KeyEvent]
 	sinks []sink.ISink
+	// batchers contains batcher for each sink implementing sink.BatchSink and nil for other sinks
+	batchers []*sink.Batcher
+	redactor *redaction.Redactor
+	// redactedSinks contains true for each sink getting redacted events
+	redactedSinks []bool
+	// sinkNames contains the name of each sink used in labels of lag metrics
+	sinkNames []string
+	// lagObservers are observers of lag of sinks with enabled lag metrics
+	lagObservers []*sink.LagObserver
+	// deliveries counts events added to batches or waiting for retry, so Run returns after they are sent or dropped
+	deliveries sync.WaitGroup
+	// stopping is set when Run stops, so events retried after the last flush of batches do not wait for linger time
+	stopping atomic.Bool
 }
 
+const (
+	maxRetries        = 3
+	initialRetryDelay = time.Second
+)
+
 type KeyEvent struct {
 	Key       string
 	EventType watch.EventType
@@ -62,18 +83,55 @@ func newEventController(clientSet kubernetes.Interface, namespace string, newLis
 	if len(sinks) < 1 {
 		return nil
 	}
+	var lagObservers []*sink.LagObserver
+	for _, s := range sinks {
+		if lagSink, ok := s.(sink.LagSink); ok && lagSink.LagObserver() != nil {
+			lagObservers = append(lagObservers, lagSink.LagObserver())
+		}
+	}
 	rateLimiter := workqueue.DefaultTypedControllerRateLimiter[KeyEvent]()
-	queue := workqueue.NewTypedRateLimitingQueue(rateLimiter)
+	var queue workqueue.TypedRateLimitingInterface[KeyEvent] = workqueue.NewTypedRateLimitingQueue(rateLimiter)
+	if len(lagObservers) > 0 {
+		queue = &timedQueue{TypedRateLimitingInterface: queue}
+	}
 	indexer, informer := NewIndexerInformer(clientSet.CoreV1().RESTClient(), namespace, queue, newListerWatcherFunc)
 
+	batchers := make([]*sink.Batcher, len(sinks))
+	for i, s := range sinks {
+		if batchSink, ok := s.(sink.BatchSink); ok {
+			batchers[i] = sink.NewBatcher(batchSink)
+		}
+	}
+
 	return &EventController{
 		queue:         queue,
 		eventInformer: informer,
 		eventIndexer:  indexer,
 		sinks:         sinks,
+		batchers:      batchers,
+		lagObservers:  lagObservers,
 	}
 }
 
+// SetRedaction makes sinks marked in redactedSinks get events redacted by the redactor. redactedSinks is aligned with sinks
+func (c *EventController) SetRedaction(redactor *redaction.Redactor, redactedSinks []bool) {
+	c.redactor = redactor
+	c.redactedSinks = redactedSinks
+}
+
+// SetSinkNames sets names of sinks used in labels of lag metrics. sinkNames is aligned with sinks
+func (c *EventController) SetSinkNames(sinkNames []string) {
+	c.sinkNames = sinkNames
+}
+
+// sinkName returns the name of the sink or its index if names are not set
+func (c *EventController) sinkName(i int) string {
+	if i < len(c.sinkNames) {
+		return c.sinkNames[i]
+	}
+	return strconv.Itoa(i)
+}
+
 // NewListerWatcherFunc returns function to create cache.ListerWatcher
 func NewListerWatcherFunc() func(kubeRestClient rest.Interface, namespace string) cache.ListerWatcher {
 	return func(kubeRestClient rest.Interface, namespace string) cache.ListerWatcher {
@@ -161,7 +219,8 @@ func NewIndexerInformer(kubeRestClient rest.Interface, namespace string, queue w
 	return indexer, informer
 }
 
-// Run starts workers for syncing events with eventInformer
+// Run starts workers for syncing events with eventInformer. When stopCh is closed, it waits until events taken from the
+// queue are released to sinks, so sinks can be closed after Run returns
 func (c *EventController) Run(workers int, stopCh chan struct{}) {
 	defer utilruntime.HandleCrash()
 	defer c.queue.ShutDown()
@@ -173,13 +232,23 @@ func (c *EventController) Run(workers int, stopCh chan struct{}) {
 		return
 	}
 
+	var running sync.WaitGroup
 	for range workers {
-		go wait.Until(c.runWorker, time.Second, stopCh)
+		running.Go(func() { wait.Until(c.runWorker, time.Second, stopCh) })
 	}
 
 	slog.Info("started workers")
 	<-stopCh
 	slog.Info("shutting down workers")
+	c.queue.ShutDown()
+	running.Wait()
+	c.stopping.Store(true)
+	for _, batcher := range c.batchers {
+		if batcher != nil {
+			batcher.Flush()
+		}
+	}
+	c.deliveries.Wait()
 }
 
 // runWorker constantly processes each event
@@ -200,6 +269,13 @@ func (c *EventController) processNextWorkItem() bool {
 		return false
 	}
 	defer c.queue.Done(keyEvent)
+	if queue, ok := c.queue.(*timedQueue); ok {
+		if wait, ok := queue.wait(keyEvent); ok {
+			for _, observer := range c.lagObservers {
+				observer.ObserveQueue(wait)
+			}
+		}
+	}
 
 	var err error
 	if keyEvent != nilKeyEvent {
@@ -249,13 +325,76 @@ func (c *EventController) processEvent(obj any) error {
 		return err
 	}
 
-	var joinedErr error
-	for _, s := range c.sinks {
-		if err := s.Release(eventObj); err != nil {
-			joinedErr = errors.Join(joinedErr, err)
+	// the event is redacted once before any sink gets it, so each rule is counted once per event
+	redactedEvent := eventObj
+	if slices.Contains(c.redactedSinks, true) {
+		redactedEvent = c.redactor.Redact(eventObj)
+	}
+
+	for i := range c.sinks {
+		sinkEvent := eventObj
+		if i < len(c.redactedSinks) && c.redactedSinks[i] {
+			sinkEvent = redactedEvent
 		}
+		if c.batchers[i] != nil {
+			c.releaseBatched(i, sinkEvent, 0)
+		} else {
+			c.release(i, sinkEvent, 0)
+		}
+	}
+	return nil
+}
+
+// observeDelivery observes the lag of delivery of the event released by the sink
+func (c *EventController) observeDelivery(sinkName string, eventObj *corev1.Event) {
+	released := time.Now()
+	for _, observer := range c.lagObservers {
+		observer.ObserveDelivery(sinkName, eventObj, released)
+	}
+}
+
+// release releases the event to the sink. The event is removed from the store after all sinks get it, so the event is
+// released again to the failed sink only instead of re-queueing the key, and other sinks do not get duplicates
+func (c *EventController) release(i int, eventObj *corev1.Event, retries int) {
+	s := c.sinks[i]
+	if err := s.Release(eventObj); err != nil {
+		c.retry(i, eventObj, retries, err, c.release)
+	} else if s.IsEventAllowed(eventObj) {
+		c.observeDelivery(c.sinkName(i), eventObj)
+	}
+}
+
+// releaseBatched adds the event to the batch of the sink. Failed events are re-added to the batch in the same way as
+// events of other sinks are released again
+func (c *EventController) releaseBatched(i int, eventObj *corev1.Event, retries int) {
+	c.deliveries.Add(1)
+	c.batchers[i].Add(eventObj, func(err error) {
+		defer c.deliveries.Done()
+		if err != nil {
+			c.retry(i, eventObj, retries, err, c.releaseBatched)
+			return
+		}
+		c.observeDelivery(c.sinkName(i), eventObj)
+	})
+	if c.stopping.Load() {
+		c.batchers[i].Flush()
+	}
+}
+
+// retry releases the event to the sink again after the exponential delay. The event is dropped after maxRetries retries
+// or if the error is permanent
+func (c *EventController) retry(i int, eventObj *corev1.Event, retries int, err error, release func(int, *corev1.Event, int)) {
+	if retries >= maxRetries || sink.IsPermanent(err) {
+		utilruntime.HandleError(err)
+		slog.Info("dropping event after failed attempts to release it to the sink", "sink", c.sinkName(i), "error", err)
+		return
 	}
-	return joinedErr
+	slog.Error("error releasing event to the sink", "sink", c.sinkName(i), "error", err)
+	c.deliveries.Add(1)
+	time.AfterFunc(initialRetryDelay<<retries, func() {
+		defer c.deliveries.Done()
+		release(i, eventObj, retries+1)
+	})
 }
 
 // handleErr checks if an error happened and makes attempts to reprocess item
@@ -265,7 +404,7 @@ func (c *EventController) handleErr(err error, key KeyEvent) {
 		return
 	}
 
-	if c.queue.NumRequeues(key) < 3 {
+	if c.queue.NumRequeues(key) < maxRetries {
 		slog.Error("error syncing event", "error", err)
 		c.queue.AddRateLimited(key)
 		return
@@ -2,18 +2,24 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
 	"github.com/Netcracker/qubership-kube-events-reader/pkg/format"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/redaction"
 	"github.com/Netcracker/qubership-kube-events-reader/pkg/sink"
 	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
@@ -63,12 +69,14 @@ func Test_ClusterEventController_StdoutSink(t *testing.T) {
 	assert.NoError(t, err, "No error should happen")
 	assert.NotEqual(t, 0, len(result), "Stdout file should not be empty")
 
+	defaultTemplate, err := format.NewTemplate("")
+	assert.NoError(t, err, "No error should happen")
 	expectedEventLog := strings.Builder{}
-	assert.NoError(t, format.FormatTemplate.Execute(&expectedEventLog, test.EventPodLogging), "No error should happen")
+	assert.NoError(t, defaultTemplate.Execute(&expectedEventLog, test.EventPodLogging), "No error should happen")
 	assert.Equal(t, 1, strings.Count(string(result), expectedEventLog.String()), "Stdout file should contain the event from logging namespace")
 
 	expectedEventLog.Reset()
-	assert.NoError(t, format.FormatTemplate.Execute(&expectedEventLog, test.EventPodTracing), "No error should happen")
+	assert.NoError(t, defaultTemplate.Execute(&expectedEventLog, test.EventPodTracing), "No error should happen")
 	assert.Equal(t, 1, strings.Count(string(result), expectedEventLog.String()), "Stdout file should contain the event from tracing namespace")
 
 	fakeLW.Delete(eventPodLogging)
@@ -113,13 +121,15 @@ func Test_NamespacedEventController_StdoutSink_TwoNamespaces(t *testing.T) {
 	assert.NoError(t, err, "No error should happen")
 	assert.NotEqual(t, 0, len(result), "Stdout file should not be empty")
 
+	defaultTemplate, err := format.NewTemplate("")
+	assert.NoError(t, err, "No error should happen")
 	expectedEventLog := strings.Builder{}
-	assert.NoError(t, format.FormatTemplate.Execute(&expectedEventLog, test.EventPodLogging), "No error should happen")
+	assert.NoError(t, defaultTemplate.Execute(&expectedEventLog, test.EventPodLogging), "No error should happen")
 	//fakeLW has no filtration of namespaces of objects, so there will be 2 occurrences in the file
 	assert.True(t, strings.Contains(string(result), expectedEventLog.String()), "Stdout file should contain the event from logging namespace")
 
 	expectedEventLog.Reset()
-	assert.NoError(t, format.FormatTemplate.Execute(&expectedEventLog, test.EventPodTracing), "No error should happen")
+	assert.NoError(t, defaultTemplate.Execute(&expectedEventLog, test.EventPodTracing), "No error should happen")
 	assert.True(t, strings.Contains(string(result), expectedEventLog.String()), "Stdout file should contain the event from tracing namespace")
 
 	fakeLW.Delete(eventPodLogging)
@@ -130,10 +140,12 @@ func Test_ClusterEventController_MetricsSink(t *testing.T) {
 	var fakeLW = fcache.NewFakeControllerSource()
 	eventPodLogging := test.EventPodLogging.DeepCopy()
 	fakeLW.Add(eventPodLogging)
-	defer sink.UnregisterMetrics()
 	filterAllLogs := &filter.Filters{
 		Sinks: []*filter.Sink{{Name: "metrics"}}}
-	metricsSink, err := sink.InitMetricsSink(context.TODO(), "9999", "", filterAllLogs.GetSinkFiltersByName("metrics"), test.StartFakeHttpServer)
+	endpoint := sink.NewMetricsEndpoint(sink.MetricsEndpointOptions{})
+	server := httptest.NewServer(endpoint.Handler())
+	defer server.Close()
+	metricsSink, err := sink.InitMetricsSink(context.TODO(), endpoint, filterAllLogs.GetSinkFiltersByName("metrics"))
 	assert.NoError(t, err, "No error should happen")
 
 	controller := NewClusterEventController(fKubeClient, FakeListerWatcherFunc(fakeLW), []sink.ISink{metricsSink})
@@ -152,7 +164,7 @@ func Test_ClusterEventController_MetricsSink(t *testing.T) {
 	//wait for the event processing some seconds
 	time.Sleep(1 * time.Second)
 
-	resp, err := test.FakeServer.Client().Get(test.FakeServer.URL)
+	resp, err := server.Client().Get(server.URL)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 	defer func() {
@@ -194,10 +206,12 @@ func Test_ClusterEventController_LogsSink_MetricsSink(t *testing.T) {
 
 	eventPodLogging := test.EventPodLogging.DeepCopy()
 	fakeLW.Add(eventPodLogging)
-	defer sink.UnregisterMetrics()
 	filterAllLogs := &filter.Filters{
 		Sinks: []*filter.Sink{{Name: "metrics"}, {Name: "logs"}}}
-	metricsSink, err := sink.InitMetricsSink(context.TODO(), "9999", "", filterAllLogs.GetSinkFiltersByName("metrics"), test.StartFakeHttpServer)
+	endpoint := sink.NewMetricsEndpoint(sink.MetricsEndpointOptions{})
+	server := httptest.NewServer(endpoint.Handler())
+	defer server.Close()
+	metricsSink, err := sink.InitMetricsSink(context.TODO(), endpoint, filterAllLogs.GetSinkFiltersByName("metrics"))
 	assert.NoError(t, err)
 	stdoutSink, err := sink.InitStdoutSink("", filterAllLogs.GetSinkFiltersByName("logs"))
 	assert.NoError(t, err)
@@ -223,16 +237,18 @@ func Test_ClusterEventController_LogsSink_MetricsSink(t *testing.T) {
 	assert.NoError(t, err, "No error should happen")
 	assert.NotEqual(t, 0, len(result), "Stdout file should not be empty")
 
+	defaultTemplate, err := format.NewTemplate("")
+	assert.NoError(t, err, "No error should happen")
 	expectedEventLog := strings.Builder{}
-	assert.NoError(t, format.FormatTemplate.Execute(&expectedEventLog, test.EventPodLogging), "No error should happen")
+	assert.NoError(t, defaultTemplate.Execute(&expectedEventLog, test.EventPodLogging), "No error should happen")
 	assert.Equal(t, 1, strings.Count(string(result), expectedEventLog.String()), "Stdout file should contain the event from logging namespace")
 
 	expectedEventLog.Reset()
-	assert.NoError(t, format.FormatTemplate.Execute(&expectedEventLog, test.EventPodTracing), "No error should happen")
+	assert.NoError(t, defaultTemplate.Execute(&expectedEventLog, test.EventPodTracing), "No error should happen")
 	assert.Equal(t, 1, strings.Count(string(result), expectedEventLog.String()), "Stdout file should contain the event from tracing namespace")
 
 	//check metrics sink
-	resp, err := test.FakeServer.Client().Get(test.FakeServer.URL)
+	resp, err := server.Client().Get(server.URL)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 	defer func() {
@@ -260,3 +276,314 @@ func Test_ClusterEventController_LogsSink_MetricsSink(t *testing.T) {
 	fakeLW.Delete(eventPodTracing)
 	fakeLW.Delete(eventPvcMonitoring)
 }
+
+// fakeBatchSink records batches and fails the first attempt to send each event
+type fakeBatchSink struct {
+	*sink.Sink
+	mu       sync.Mutex
+	batches  [][]string
+	attempts map[string]int
+	linger   time.Duration
+	added    int
+}
+
+func (fs *fakeBatchSink) IsEventAllowed(_ *corev1.Event) bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.added++
+	return true
+}
+
+func (fs *fakeBatchSink) Release(_ *corev1.Event) error {
+	return errors.New("events should be sent in batches")
+}
+
+func (fs *fakeBatchSink) BatchOptions() sink.BatchOptions {
+	return sink.BatchOptions{MaxEvents: 10, Linger: fs.linger}
+}
+
+func (fs *fakeBatchSink) ReleaseBatch(events []*corev1.Event) []error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var names []string
+	errs := make([]error, len(events))
+	for i, eventObj := range events {
+		names = append(names, eventObj.Name)
+		fs.attempts[eventObj.Name]++
+		if fs.attempts[eventObj.Name] == 1 {
+			errs[i] = errors.New("temporary error")
+		}
+	}
+	fs.batches = append(fs.batches, names)
+	return errs
+}
+
+func Test_ClusterEventController_BatchSink(t *testing.T) {
+	var fakeLW = fcache.NewFakeControllerSource()
+	batchSink := &fakeBatchSink{Sink: &sink.Sink{}, attempts: map[string]int{}, linger: 200 * time.Millisecond}
+	controller := NewClusterEventController(fKubeClient, FakeListerWatcherFunc(fakeLW), []sink.ISink{batchSink})
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go controller.Run(2, stop)
+
+	eventPodLogging := test.EventPodLogging.DeepCopy()
+	eventPodTracing := test.EventPodTracing.DeepCopy()
+	fakeLW.Add(eventPodLogging)
+	fakeLW.Add(eventPodTracing)
+
+	assert.Eventually(t, func() bool {
+		batchSink.mu.Lock()
+		defer batchSink.mu.Unlock()
+		return len(batchSink.batches) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	batchSink.mu.Lock()
+	defer batchSink.mu.Unlock()
+	assert.ElementsMatch(t, []string{eventPodLogging.Name, eventPodTracing.Name}, batchSink.batches[0], "Events should be sent in one batch")
+	assert.ElementsMatch(t, []string{eventPodLogging.Name, eventPodTracing.Name}, batchSink.batches[1], "Failed events should be sent again")
+
+	fakeLW.Delete(eventPodLogging)
+	fakeLW.Delete(eventPodTracing)
+}
+
+// fakeSink records released events and fails the first attempt to release each event if failFirst is set
+type fakeSink struct {
+	*sink.Sink
+	failFirst bool
+	// permanent makes the first failure permanent
+	permanent bool
+	mu        sync.Mutex
+	attempts  map[string]int
+}
+
+func (fs *fakeSink) Release(eventObj *corev1.Event) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.attempts[eventObj.Name]++
+	if fs.failFirst && fs.attempts[eventObj.Name] == 1 {
+		if fs.permanent {
+			return sink.Permanent(errors.New("rejected event"))
+		}
+		return errors.New("temporary error")
+	}
+	return nil
+}
+
+func (fs *fakeSink) attemptsOf(name string) int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.attempts[name]
+}
+
+func Test_ClusterEventController_RetriesFailedSinkOnly(t *testing.T) {
+	var fakeLW = fcache.NewFakeControllerSource()
+	failingSink := &fakeSink{Sink: &sink.Sink{}, failFirst: true, attempts: map[string]int{}}
+	otherSink := &fakeSink{Sink: &sink.Sink{}, attempts: map[string]int{}}
+	controller := NewClusterEventController(fKubeClient, FakeListerWatcherFunc(fakeLW), []sink.ISink{failingSink, otherSink})
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go controller.Run(1, stop)
+
+	eventPodLogging := test.EventPodLogging.DeepCopy()
+	fakeLW.Add(eventPodLogging)
+
+	assert.Eventually(t, func() bool {
+		return failingSink.attemptsOf(eventPodLogging.Name) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, otherSink.attemptsOf(eventPodLogging.Name), "Sinks which got the event should not get it again")
+
+	fakeLW.Delete(eventPodLogging)
+}
+
+func Test_ClusterEventController_DropsPermanentErrors(t *testing.T) {
+	var fakeLW = fcache.NewFakeControllerSource()
+	rejectingSink := &fakeSink{Sink: &sink.Sink{}, failFirst: true, permanent: true, attempts: map[string]int{}}
+	controller := NewClusterEventController(fKubeClient, FakeListerWatcherFunc(fakeLW), []sink.ISink{rejectingSink})
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go controller.Run(1, stop)
+
+	eventPodLogging := test.EventPodLogging.DeepCopy()
+	fakeLW.Add(eventPodLogging)
+
+	assert.Eventually(t, func() bool {
+		return rejectingSink.attemptsOf(eventPodLogging.Name) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(initialRetryDelay + 500*time.Millisecond)
+	assert.Equal(t, 1, rejectingSink.attemptsOf(eventPodLogging.Name), "Event rejected by the sink should not be retried")
+
+	fakeLW.Delete(eventPodLogging)
+}
+
+func Test_ClusterEventController_Run_ReleasesBatchesOnStop(t *testing.T) {
+	var fakeLW = fcache.NewFakeControllerSource()
+	batchSink := &fakeBatchSink{Sink: &sink.Sink{}, attempts: map[string]int{}, linger: time.Hour}
+	controller := NewClusterEventController(fKubeClient, FakeListerWatcherFunc(fakeLW), []sink.ISink{batchSink})
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		controller.Run(1, stop)
+		close(stopped)
+	}()
+
+	eventPodLogging := test.EventPodLogging.DeepCopy()
+	fakeLW.Add(eventPodLogging)
+	assert.Eventually(t, func() bool {
+		batchSink.mu.Lock()
+		defer batchSink.mu.Unlock()
+		return batchSink.added == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	close(stop)
+
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not return after stop")
+	}
+	batchSink.mu.Lock()
+	defer batchSink.mu.Unlock()
+	assert.Equal(t, 2, batchSink.attempts[eventPodLogging.Name], "Run should return after the batch and the retry of failed event are sent")
+}
+
+func Test_ClusterEventController_Redaction(t *testing.T) {
+	var fakeLW = fcache.NewFakeControllerSource()
+	initialStdout := os.Stdout
+	fname, err := test.ChangeStdoutToFile("stdout_redaction")
+	defer func(t *testing.T) {
+		assert.NoError(t, test.ChangeFileToStdout(initialStdout))
+	}(t)
+	assert.NoError(t, err, "No error should happen")
+
+	keep := false
+	filters := &filter.Filters{
+		Sinks:     []*filter.Sink{{Name: "redacted"}, {Name: "original", Redact: &keep}},
+		Redaction: &filter.Redaction{},
+	}
+	redactedSink, err := sink.InitStdoutSink("redacted: {{.Message}}", filters.GetSinkFiltersByName("redacted"))
+	assert.NoError(t, err, "No error should happen")
+	originalSink, err := sink.InitStdoutSink("original: {{.Message}}", filters.GetSinkFiltersByName("original"))
+	assert.NoError(t, err, "No error should happen")
+	redactor, err := redaction.NewRedactor(filters.Redaction, nil)
+	assert.NoError(t, err, "No error should happen")
+
+	controller := NewClusterEventController(fKubeClient, FakeListerWatcherFunc(fakeLW), []sink.ISink{redactedSink, originalSink})
+	controller.SetRedaction(redactor, []bool{
+		filters.Redaction.IsRedactedFor(filters.GetSinkFiltersByName("redacted")),
+		filters.Redaction.IsRedactedFor(filters.GetSinkFiltersByName("original")),
+	})
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go controller.Run(1, stop)
+
+	eventPodTracing := test.EventPodTracing.DeepCopy()
+	eventPodTracing.Message = "Failed to connect with password=qwerty"
+	fakeLW.Add(eventPodTracing)
+
+	assert.Eventually(t, func() bool {
+		result, err := os.ReadFile(fname)
+		return err == nil && strings.Count(string(result), "\n") == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	result, err := os.ReadFile(fname)
+	assert.NoError(t, err, "No error should happen")
+	assert.Contains(t, string(result), "redacted: Failed to connect with password=[REDACTED]")
+	assert.Contains(t, string(result), "original: Failed to connect with password=qwerty", "Opted out sink should get the original event")
+
+	fakeLW.Delete(eventPodTracing)
+}
+
+// histogramCounts returns numbers of observations of histograms of the endpoint by the name and values of labels
+func histogramCounts(t *testing.T, endpoint *sink.MetricsEndpoint) map[string]uint64 {
+	counts := map[string]uint64{}
+	families, err := endpoint.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			name := family.GetName()
+			for _, label := range metric.GetLabel() {
+				name += "/" + label.GetValue()
+			}
+			counts[name] = metric.GetHistogram().GetSampleCount()
+		}
+	}
+	return counts
+}
+
+func Test_ClusterEventController_LagMetrics(t *testing.T) {
+	var fakeLW = fcache.NewFakeControllerSource()
+	filters := &filter.Filters{Sinks: []*filter.Sink{
+		{Name: "metrics", Settings: json.RawMessage(`{"prefix":"kube_lag_events","lag":{}}`)},
+		{Name: "warnings", Type: "metrics", Match: []filter.EventMatch{{Type: "Warning"}}, Settings: json.RawMessage(`{"prefix":"kube_lag_warnings"}`)},
+	}}
+	endpoint := sink.NewMetricsEndpoint(sink.MetricsEndpointOptions{})
+	metricsSink, err := sink.InitMetricsSink(context.TODO(), endpoint, filters.GetSinkFiltersByName("metrics"))
+	assert.NoError(t, err, "No error should happen")
+	warningsSink, err := sink.InitMetricsSink(context.TODO(), endpoint, filters.GetSinkFiltersByName("warnings"))
+	assert.NoError(t, err, "No error should happen")
+
+	controller := NewClusterEventController(fKubeClient, FakeListerWatcherFunc(fakeLW), []sink.ISink{metricsSink, warningsSink})
+	controller.SetSinkNames([]string{"metrics", "warnings"})
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go controller.Run(1, stop)
+
+	eventPodLogging := test.EventPodLogging.DeepCopy()
+	eventPodTracing := test.EventPodTracing.DeepCopy()
+	fakeLW.Add(eventPodLogging)
+	fakeLW.Add(eventPodTracing)
+
+	assert.Eventually(t, func() bool {
+		counts := histogramCounts(t, endpoint)
+		return counts["kube_lag_events_queue_wait_seconds"] == 2 && counts["kube_lag_events_delivery_lag_seconds/warnings"] > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	counts := histogramCounts(t, endpoint)
+	assert.Equal(t, uint64(2), counts["kube_lag_events_delivery_lag_seconds/metrics"])
+	assert.Equal(t, uint64(1), counts["kube_lag_events_delivery_lag_seconds/warnings"], "Events not allowed by the sink should not be observed")
+	assert.NotContains(t, counts, "kube_lag_warnings_queue_wait_seconds", "Lag should not be measured by sink without lag settings")
+
+	fakeLW.Delete(eventPodLogging)
+	fakeLW.Delete(eventPodTracing)
+}
+
+func Test_ClusterEventController_LagMetrics_BatchSink(t *testing.T) {
+	var fakeLW = fcache.NewFakeControllerSource()
+	filters := &filter.Filters{Sinks: []*filter.Sink{
+		{Name: "metrics", Settings: json.RawMessage(`{"prefix":"kube_batch_lag_events","lag":{}}`)},
+	}}
+	endpoint := sink.NewMetricsEndpoint(sink.MetricsEndpointOptions{})
+	metricsSink, err := sink.InitMetricsSink(context.TODO(), endpoint, filters.GetSinkFiltersByName("metrics"))
+	assert.NoError(t, err, "No error should happen")
+	batchSink := &fakeBatchSink{Sink: &sink.Sink{}, attempts: map[string]int{}, linger: time.Hour}
+
+	controller := NewClusterEventController(fKubeClient, FakeListerWatcherFunc(fakeLW), []sink.ISink{metricsSink, batchSink})
+	controller.SetSinkNames([]string{"metrics", "batched"})
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		controller.Run(1, stop)
+		close(done)
+	}()
+
+	fakeLW.Add(test.EventPodLogging.DeepCopy())
+	fakeLW.Add(test.EventPodTracing.DeepCopy())
+
+	assert.Eventually(t, func() bool {
+		return histogramCounts(t, endpoint)["kube_batch_lag_events_delivery_lag_seconds/metrics"] == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NotContains(t, histogramCounts(t, endpoint), "kube_batch_lag_events_delivery_lag_seconds/batched",
+		"Events should not be observed until the batch is sent")
+
+	// the first attempt to send the batch fails, so events are observed after the retry
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run should return after batches are sent")
+	}
+	assert.Equal(t, uint64(2), histogramCounts(t, endpoint)["kube_batch_lag_events_delivery_lag_seconds/batched"])
+}
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// timedQueue records the time keys are added to the queue, so the wait of events in the queue can be observed.
+// The time of the first addition is kept until the key is taken from the queue, as the queue merges duplicate keys
+type timedQueue struct {
+	workqueue.TypedRateLimitingInterface[KeyEvent]
+	added sync.Map
+}
+
+func (q *timedQueue) Add(key KeyEvent) {
+	q.added.LoadOrStore(key, time.Now())
+	q.TypedRateLimitingInterface.Add(key)
+}
+
+func (q *timedQueue) AddRateLimited(key KeyEvent) {
+	q.added.LoadOrStore(key, time.Now())
+	q.TypedRateLimitingInterface.AddRateLimited(key)
+}
+
+func (q *timedQueue) AddAfter(key KeyEvent, duration time.Duration) {
+	q.added.LoadOrStore(key, time.Now())
+	q.TypedRateLimitingInterface.AddAfter(key, duration)
+}
+
+// wait returns the time since the key is added to the queue and forgets the key
+func (q *timedQueue) wait(key KeyEvent) (time.Duration, bool) {
+	added, ok := q.added.LoadAndDelete(key)
+	if !ok {
+		return 0, false
+	}
+	return time.Since(added.(time.Time)), true
+}
@@ -1,6 +1,7 @@
 package filter
 
 import (
+	"encoding/json"
 	"fmt"
 	"k8s.io/apimachinery/pkg/util/yaml"
 	"log/slog"
@@ -9,12 +10,43 @@ import (
 
 type Filters struct {
 	Sinks []*Sink `json:"sinks"`
+	// Redaction removes sensitive data from events before sinks get them. Events are not redacted if it is not set
+	Redaction *Redaction `json:"redaction,omitempty"`
 }
 
 type Sink struct {
-	Name    string       `json:"name"`
+	// Name identifies the instance of the sink. It is used as the type of the sink if Type is not set
+	Name string `json:"name"`
+	// Type is the type of the sink, e.g. logs or metrics. Several sinks with different names can have the same type
+	Type    string       `json:"type,omitempty"`
 	Match   []EventMatch `json:"match,omitempty"`
 	Exclude []EventMatch `json:"exclude,omitempty"`
+	// Settings contains sink specific configuration. It is decoded by the sink itself
+	Settings json.RawMessage `json:"settings,omitempty"`
+	// Redact overrides Redaction.OptIn for the sink: true to get redacted events, false to get original events
+	Redact *bool `json:"redact,omitempty"`
+}
+
+type Redaction struct {
+	// Detectors are names of built-in detectors. All detectors are used if it is not set, none if it is empty
+	Detectors []string `json:"detectors,omitempty"`
+	// Rules are custom regular expressions to redact
+	Rules []RedactionRule `json:"rules,omitempty"`
+	// Fields are redacted in addition to message, e.g. annotations or involvedObjectName
+	Fields []string `json:"fields,omitempty"`
+	// Replacement replaces sensitive data. Default is [REDACTED]
+	Replacement string `json:"replacement,omitempty"`
+	// OptIn makes only sinks with redact: true get redacted events. Otherwise, all sinks except redact: false get them
+	OptIn bool `json:"optIn,omitempty"`
+}
+
+type RedactionRule struct {
+	// Name identifies the rule in metrics. It must be unique and differ from names of built-in detectors
+	Name string `json:"name"`
+	// Pattern is the regular expression to redact. Only the group named secret is replaced if the pattern has it
+	Pattern string `json:"pattern"`
+	// Replacement overrides Redaction.Replacement for the rule. It can refer to groups of the pattern, e.g. ${1}
+	Replacement string `json:"replacement,omitempty"`
 }
 
 type EventMatch struct {
@@ -52,6 +84,40 @@ func (f *Filters) GetSinkFiltersByName(sink string) *Sink {
 	return nil
 }
 
+// GetSinksByType returns all sinks of the given type. If there is no such sink, the sink without rules and settings
+// named after the type is returned, so each output has at least one instance
+func (f *Filters) GetSinksByType(sinkType string) []*Sink {
+	var sinks []*Sink
+	for _, s := range f.Sinks {
+		if s.GetType() == sinkType {
+			sinks = append(sinks, s)
+		}
+	}
+	if len(sinks) == 0 {
+		return []*Sink{{Name: sinkType}}
+	}
+	return sinks
+}
+
+// GetType returns the type of the sink
+func (s *Sink) GetType() string {
+	if len(s.Type) > 0 {
+		return s.Type
+	}
+	return s.Name
+}
+
+// IsRedactedFor returns true if the sink gets redacted events
+func (r *Redaction) IsRedactedFor(s *Sink) bool {
+	if r == nil {
+		return false
+	}
+	if s != nil && s.Redact != nil {
+		return *s.Redact
+	}
+	return !r.OptIn
+}
+
 func ValidateFileSize(filePath string, maxSize int64) (err error) {
 	// Open the file and get its size.
 
@@ -12,7 +12,7 @@ func Test_ParseFiltersConfiguration(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, filters)
 	expectedFilters := &Filters{
-		[]*Sink{
+		Sinks: []*Sink{
 			{
 				Name: "metrics",
 				Match: []EventMatch{
@@ -51,9 +51,43 @@ func Test_GetSinkFiltersByName(t *testing.T) {
 	assert.Nil(t, filters.GetSinkFiltersByName("test1"))
 }
 
+func Test_GetSinksByType(t *testing.T) {
+	warnings := &Sink{Name: "warnings", Type: "logs", Match: []EventMatch{{Type: "Warning"}}}
+	others := &Sink{Name: "others", Type: "logs", Exclude: []EventMatch{{Type: "Warning"}}}
+	metrics := &Sink{Name: "metrics"}
+	filters := &Filters{Sinks: []*Sink{warnings, metrics, others}}
+
+	assert.Equal(t, []*Sink{warnings, others}, filters.GetSinksByType("logs"))
+	assert.Equal(t, []*Sink{metrics}, filters.GetSinksByType("metrics"))
+	assert.Equal(t, []*Sink{{Name: "chat"}}, filters.GetSinksByType("chat"))
+	assert.Equal(t, "logs", warnings.GetType())
+	assert.Equal(t, "metrics", metrics.GetType())
+}
+
 func Test_ValidateFileSize(t *testing.T) {
 	const maxFileSize = 5 * 1024 * 1024 // 5 MB
 	filterFile := flag.String("filtersPath", "../test/filtering_config_valid.yaml", "Absolute path to file with filter events configuration")
 	err := ValidateFileSize(*filterFile, maxFileSize)
 	assert.NoError(t, err)
 }
+
+func Test_Redaction_IsRedactedFor(t *testing.T) {
+	redact, keep := true, false
+	optedIn := &Sink{Name: "optedIn", Redact: &redact}
+	optedOut := &Sink{Name: "optedOut", Redact: &keep}
+	other := &Sink{Name: "other"}
+
+	var notSet *Redaction
+	assert.False(t, notSet.IsRedactedFor(optedIn), "Events should not be redacted without configuration")
+
+	redaction := &Redaction{}
+	assert.True(t, redaction.IsRedactedFor(optedIn))
+	assert.False(t, redaction.IsRedactedFor(optedOut))
+	assert.True(t, redaction.IsRedactedFor(other), "All sinks should get redacted events by default")
+	assert.True(t, redaction.IsRedactedFor(nil))
+
+	redaction.OptIn = true
+	assert.True(t, redaction.IsRedactedFor(optedIn))
+	assert.False(t, redaction.IsRedactedFor(optedOut))
+	assert.False(t, redaction.IsRedactedFor(other), "Only opted in sinks should get redacted events")
+}
@@ -0,0 +1,72 @@
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	CloudEventsSpecVersion = "1.0"
+	cloudEventTypePrefix   = "io.k8s.event"
+)
+
+// ClusterName is used to build source attribute of CloudEvents
+var ClusterName string
+
+// CloudEvent is the representation of Event in CloudEvents 1.0 structured JSON format
+type CloudEvent struct {
+	SpecVersion     string        `json:"specversion"`
+	ID              string        `json:"id"`
+	Source          string        `json:"source"`
+	Type            string        `json:"type"`
+	Subject         string        `json:"subject,omitempty"`
+	Time            *time.Time    `json:"time,omitempty"`
+	DataContentType string        `json:"datacontenttype"`
+	Data            *corev1.Event `json:"data"`
+}
+
+// NewCloudEvent converts given Event to CloudEvent
+func NewCloudEvent(event *corev1.Event) *CloudEvent {
+	data := *event
+	data.ManagedFields = nil
+	cloudEvent := &CloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              fmt.Sprintf("%s.%s", event.UID, event.ResourceVersion),
+		Source:          cloudEventSource(event.InvolvedObject.Namespace),
+		Type:            fmt.Sprintf("%s.%s.%s", cloudEventTypePrefix, strings.ToLower(event.Type), event.Reason),
+		Subject:         fmt.Sprintf("%s/%s", event.InvolvedObject.Kind, event.InvolvedObject.Name),
+		DataContentType: "application/json",
+		Data:            &data,
+	}
+	if timestamp := ResolveTimestamp(event); timestamp.Observed {
+		cloudEvent.Time = &timestamp.Time
+	}
+	return cloudEvent
+}
+
+func cloudEventSource(namespace string) string {
+	source := ""
+	if len(ClusterName) > 0 {
+		source = "/clusters/" + ClusterName
+	}
+	if len(namespace) > 0 {
+		source += "/namespaces/" + namespace
+	}
+	if len(source) == 0 {
+		return "/"
+	}
+	return source
+}
+
+// formatCloudEvent returns Event encoded as structured CloudEvent
+func formatCloudEvent(event *corev1.Event) (string, error) {
+	encoded, err := json.Marshal(NewCloudEvent(event))
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
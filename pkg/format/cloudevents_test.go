@@ -0,0 +1,64 @@
+package format
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_NewCloudEvent(t *testing.T) {
+	ClusterName = "test-cluster"
+	defer func() { ClusterName = "" }()
+
+	event := test.EventPodTracing.DeepCopy()
+	event.UID = "7f1d1c7e-3c1b-4b7a-9a52-5d0e8f1f2a11"
+	event.ResourceVersion = "1234"
+
+	cloudEvent := NewCloudEvent(event)
+	assert.Equal(t, "1.0", cloudEvent.SpecVersion)
+	assert.Equal(t, "io.k8s.event.warning.BackOff", cloudEvent.Type)
+	assert.Equal(t, "/clusters/test-cluster/namespaces/tracing", cloudEvent.Source)
+	assert.Equal(t, "Pod/test-pod", cloudEvent.Subject)
+	assert.Equal(t, "7f1d1c7e-3c1b-4b7a-9a52-5d0e8f1f2a11.1234", cloudEvent.ID)
+	assert.True(t, cloudEvent.Time.Equal(test.LastTs.Time))
+	assert.Equal(t, "Back-off restarting failed container", cloudEvent.Data.Message)
+
+	ClusterName = ""
+	event.InvolvedObject.Namespace = ""
+	assert.Equal(t, "/", NewCloudEvent(event).Source)
+}
+
+func Test_EventFormat_CloudEvents(t *testing.T) {
+	eventTemplate, err := NewTemplate(CloudEventsFormat)
+	assert.NoError(t, err, "No error should happen")
+
+	formattedEvent := FormatEventWithTemplate(eventTemplate, test.EventPodLogging)
+
+	var cloudEvent struct {
+		SpecVersion string       `json:"specversion"`
+		Type        string       `json:"type"`
+		Source      string       `json:"source"`
+		Subject     string       `json:"subject"`
+		Data        corev1.Event `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(formattedEvent), &cloudEvent), "Formatted event should be valid JSON")
+	assert.Equal(t, "1.0", cloudEvent.SpecVersion)
+	assert.Equal(t, "io.k8s.event.normal.Started", cloudEvent.Type)
+	assert.Equal(t, "/namespaces/logging", cloudEvent.Source)
+	assert.Equal(t, "Pod/test-pod", cloudEvent.Subject)
+	assert.Equal(t, test.EventPodLogging.Message, cloudEvent.Data.Message)
+}
+
+func Test_NewCloudEvent_InferredTimeIsOmitted(t *testing.T) {
+	event := test.EventPodLogging.DeepCopy()
+	event.Series = &corev1.EventSeries{Count: 2, LastObservedTime: metav1.NewMicroTime(test.LastTs.Add(time.Minute))}
+	assert.True(t, test.LastTs.Add(time.Minute).Equal(*NewCloudEvent(event).Time), "Time of the last occurrence in series should be used")
+
+	event = &corev1.Event{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.Now()}}
+	assert.Nil(t, NewCloudEvent(event).Time, "Inferred time should not be set as time of CloudEvent")
+}
@@ -1,48 +1,116 @@
 package format
 
 import (
-	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"fmt"
+	"io"
 	"log/slog"
+	"os"
 	"strings"
 	"text/template"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/aggregation"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-var FormatTemplate *template.Template
+// CloudEventsFormat is the name of preset format to print Event as structured CloudEvent
+const CloudEventsFormat = "cloudevents"
+
+var presetFormats = map[string]string{
+	CloudEventsFormat: "{{cloudEvent .}}",
+}
 
-var defaultFormat = "{\"time\":\"{{.LastTimestamp.Format \"2006-01-02T15:04:05.999\"}}\",\"involvedObjectKind\":\"{{.InvolvedObject.Kind}}\",\"involvedObjectNamespace\":\"{{.InvolvedObject.Namespace}}\",\"involvedObjectName\":\"{{.InvolvedObject.Name}}\",\"involvedObjectUid\":\"{{.InvolvedObject.UID}}\",\"involvedObjectApiVersion\":\"{{.InvolvedObject.APIVersion}}\",\"involvedObjectResourceVersion\":\"{{.InvolvedObject.ResourceVersion}}\",\"reason\":\"{{.Reason}}\",\"type\":\"{{.Type}}\",\"message\":\"{{js .Message}}\",\"kind\":\"KubernetesEvent\"}"
+var defaultFormat = "{\"time\":\"{{(timestamp .).Format \"2006-01-02T15:04:05.999\"}}\",\"involvedObjectKind\":\"{{.InvolvedObject.Kind}}\",\"involvedObjectNamespace\":\"{{.InvolvedObject.Namespace}}\",\"involvedObjectName\":\"{{.InvolvedObject.Name}}\",\"involvedObjectUid\":\"{{.InvolvedObject.UID}}\",\"involvedObjectApiVersion\":\"{{.InvolvedObject.APIVersion}}\",\"involvedObjectResourceVersion\":\"{{.InvolvedObject.ResourceVersion}}\",\"reason\":\"{{.Reason}}\",\"type\":\"{{.Type}}\",\"message\":\"{{js .Message}}\",\"kind\":\"KubernetesEvent\"}"
 
-// SetFormat initializes text template to print logs of events
-func SetFormat(format string) error {
+// NewTemplate parses text template to print Event. Default template is used if the format is empty.
+// The template is checked by rendering a sample Event, so errors of execution are found at startup
+func NewTemplate(format string) (*template.Template, error) {
 	if len(format) == 0 || len(strings.TrimSpace(format)) == 0 {
 		slog.Warn("Template format is not set. Default is used.")
-		t, err := template.New("format").Parse(defaultFormat)
-		FormatTemplate = t
-		if err != nil {
-			slog.Error("Failed when creating default template", "error", err)
-			return err
-		}
-		return nil
-	}
-	t, err := template.New("format").Parse(format)
-	if err != nil {
-		return err
+		format = defaultFormat
+	}
+	if preset, ok := presetFormats[strings.TrimSpace(format)]; ok {
+		format = preset
 	}
-	FormatTemplate = t
-	return nil
+	return ParseEventTemplate("format", format)
 }
 
-// FormatEvent returns formatted string of given Event using predefined template
-func FormatEvent(event *corev1.Event) (formatted string) {
+// ParseEventTemplate parses text template executed with Event. Functions of templateFuncs are available in the template.
+// Constant patterns of regexReplace are compiled once. The template is checked by rendering a sample Event
+func ParseEventTemplate(name string, text string) (*template.Template, error) {
+	initAggregations.Do(aggregation.InitAggregations)
+	t, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	patterns, err := compilePatterns(t)
+	if err != nil {
+		return nil, err
+	}
+	t.Funcs(template.FuncMap{"regexReplace": regexReplaceFunc(patterns)})
+	if err = t.Execute(io.Discard, sampleEvent()); err != nil {
+		return nil, fmt.Errorf("could not render sample event: %w", err)
+	}
+	return t, nil
+}
 
-	writer := strings.Builder{}
+// NewTemplateFromFile parses text template to print Event from the file
+func NewTemplateFromFile(path string) (*template.Template, error) {
+	format, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read format file %s: %w", path, err)
+	}
+	if len(strings.TrimSpace(string(format))) == 0 {
+		return nil, fmt.Errorf("format file %s is empty", path)
+	}
+	return NewTemplate(strings.TrimRight(string(format), "\n"))
+}
 
-	if event.LastTimestamp.IsZero() {
-		slog.Debug("Event lastTimestamp is zero. Using current timestamp", "Event", event)
-		event.LastTimestamp = metav1.Now()
+// sampleEvent returns Event with all fields set which is used to check templates
+func sampleEvent() *corev1.Event {
+	now := metav1.Now()
+	return &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "sample-pod.17a0b1c2d3e4f5a6",
+			Namespace:         "default",
+			UID:               "00000000-0000-0000-0000-000000000000",
+			ResourceVersion:   "1",
+			CreationTimestamp: now,
+			Labels:            map[string]string{"app": "sample"},
+			Annotations:       map[string]string{"sample": "true"},
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "Pod",
+			Namespace:       "default",
+			Name:            "sample-pod",
+			UID:             "00000000-0000-0000-0000-000000000001",
+			APIVersion:      "v1",
+			ResourceVersion: "1",
+			FieldPath:       "spec.containers{sample}",
+		},
+		Reason:              "Started",
+		Message:             "Started container sample",
+		Source:              corev1.EventSource{Component: "kubelet", Host: "sample-node"},
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+		Type:                corev1.EventTypeNormal,
+		EventTime:           metav1.NewMicroTime(now.Time),
+		Series:              &corev1.EventSeries{Count: 1, LastObservedTime: metav1.NewMicroTime(now.Time)},
+		Action:              "Started",
+		Related:             &corev1.ObjectReference{Kind: "Node", Name: "sample-node"},
+		ReportingController: "kubelet",
+		ReportingInstance:   "sample-node",
 	}
+}
+
+// FormatEventWithTemplate returns formatted string of given Event using the template. Event is not changed,
+// templates should use timestamp function instead of LastTimestamp field which is empty in events of newer controllers
+func FormatEventWithTemplate(t *template.Template, event *corev1.Event) (formatted string) {
+
+	writer := strings.Builder{}
 
-	if err := FormatTemplate.Execute(&writer, event); err != nil {
+	if err := t.Execute(&writer, event); err != nil {
 		slog.Error("Could not execute template for Event", "error", err)
 		return
 	}
@@ -1,6 +1,8 @@
 package format
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"text/template"
@@ -11,17 +13,17 @@ import (
 
 func Test_EventFormat_Default(t *testing.T) {
 
-	err := SetFormat("")
+	eventTemplate, err := NewTemplate("")
 	assert.NoError(t, err, "No error should happen")
 
-	templ, err := template.New("test").Parse(defaultFormat)
+	templ, err := template.New("test").Funcs(templateFuncs).Parse(defaultFormat)
 	assert.NoError(t, err, "No error should happen")
 
 	expectedFormattedEvent := strings.Builder{}
 	err = templ.Execute(&expectedFormattedEvent, test.EventPodLogging)
 	assert.NoError(t, err, "No error should happen")
 
-	formattedEvent := FormatEvent(test.EventPodLogging)
+	formattedEvent := FormatEventWithTemplate(eventTemplate, test.EventPodLogging)
 	assert.Equal(t, 0, strings.Compare(expectedFormattedEvent.String(), formattedEvent), "Formatted event should be printed using default template")
 }
 
@@ -29,7 +31,7 @@ var eventFormatTest = "time={{.LastTimestamp.Format \"2006-01-02T15:04:05Z\"}} i
 
 func Test_EventFormat_Custom(t *testing.T) {
 
-	err := SetFormat(eventFormatTest)
+	eventTemplate, err := NewTemplate(eventFormatTest)
 	assert.NoError(t, err, "No error should happen")
 
 	templ, err := template.New("test").Parse(eventFormatTest)
@@ -39,6 +41,32 @@ func Test_EventFormat_Custom(t *testing.T) {
 	err = templ.Execute(&expectedFormattedEvent, test.EventPodLogging)
 	assert.NoError(t, err, "No error should happen")
 
-	formattedEvent := FormatEvent(test.EventPodLogging)
+	formattedEvent := FormatEventWithTemplate(eventTemplate, test.EventPodLogging)
 	assert.Equal(t, 0, strings.Compare(expectedFormattedEvent.String(), formattedEvent), "Formatted event should be printed using default template")
 }
+
+func Test_NewTemplate_RendersSampleEvent(t *testing.T) {
+	_, err := NewTemplate("{{.Type")
+	assert.Error(t, err, "Template with syntax error should not be parsed")
+
+	_, err = NewTemplate("{{.Unknown}}")
+	assert.ErrorContains(t, err, "could not render sample event", "Template with unknown field should fail on sample event")
+
+	_, err = NewTemplate("{{.Related.Name}} {{.Series.Count}} {{index .Labels \"app\"}}")
+	assert.NoError(t, err, "Sample event should have all fields set")
+}
+
+func Test_NewTemplateFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "format.tmpl")
+	assert.NoError(t, os.WriteFile(path, []byte("{{.Type}} {{.Reason}}\n"), 0o600))
+	eventTemplate, err := NewTemplateFromFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "Normal Started", FormatEventWithTemplate(eventTemplate, test.EventPodLogging), "Trailing new line should be trimmed")
+
+	_, err = NewTemplateFromFile(filepath.Join(t.TempDir(), "missing.tmpl"))
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(path, []byte(" \n"), 0o600))
+	_, err = NewTemplateFromFile(path)
+	assert.Error(t, err, "Empty format file should not be used")
+}
@@ -0,0 +1,223 @@
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/aggregation"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// initAggregations prepares aggregation rules used by commonMessage once for all templates
+var initAggregations sync.Once
+
+// templateFuncs are functions available in all templates of events. Functions take the piped value as the last
+// argument, e.g. {{.Message | truncate 100}}
+var templateFuncs = template.FuncMap{
+	"cloudEvent":    formatCloudEvent,
+	"toJson":        toJSON,
+	"truncate":      truncate,
+	"lower":         strings.ToLower,
+	"upper":         strings.ToUpper,
+	"default":       defaultValue,
+	"since":         since,
+	"timestamp":     timestamp,
+	"label":         label,
+	"annotation":    annotation,
+	"commonMessage": commonMessage,
+	"env":           os.Getenv,
+	"regexReplace":  regexReplace,
+}
+
+// toJSON returns the value encoded in JSON, e.g. {{toJson .Labels}}
+func toJSON(value any) (string, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// truncate returns first length characters of the value, e.g. {{.Message | truncate 100}}
+func truncate(length int, value string) string {
+	if length < 0 {
+		return value
+	}
+	runes := []rune(value)
+	if len(runes) <= length {
+		return value
+	}
+	return string(runes[:length])
+}
+
+// defaultValue returns the default if the value is empty, e.g. {{.ReportingController | default "unknown"}}
+func defaultValue(defaultValue any, value any) any {
+	if value == nil {
+		return defaultValue
+	}
+	if v := reflect.ValueOf(value); v.IsZero() || (v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.Len() == 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// since returns time passed from the timestamp rounded to seconds, e.g. {{since .FirstTimestamp}}.
+// Zero duration is returned for zero timestamp
+func since(timestamp any) (time.Duration, error) {
+	var t time.Time
+	switch v := timestamp.(type) {
+	case time.Time:
+		t = v
+	case metav1.Time:
+		t = v.Time
+	case *metav1.Time:
+		if v != nil {
+			t = v.Time
+		}
+	case metav1.MicroTime:
+		t = v.Time
+	case *metav1.MicroTime:
+		if v != nil {
+			t = v.Time
+		}
+	default:
+		return 0, fmt.Errorf("since: unsupported type of timestamp %T", timestamp)
+	}
+	if t.IsZero() {
+		return 0, nil
+	}
+	return time.Since(t).Round(time.Second), nil
+}
+
+// timestamp returns the time of the last occurrence of Event resolved by ResolveTimestamp, e.g.
+// {{(timestamp .).Format "2006-01-02T15:04:05Z07:00"}} or {{(timestamp .).Observed}}
+func timestamp(event *corev1.Event) EventTimestamp {
+	return ResolveTimestamp(event)
+}
+
+// label returns the label of Event or empty string if the label is not set, e.g. {{label . "app"}}
+func label(event *corev1.Event, name string) string {
+	if event == nil {
+		return ""
+	}
+	return event.Labels[name]
+}
+
+// annotation returns the annotation of Event or empty string if the annotation is not set, e.g. {{annotation . "owner"}}
+func annotation(event *corev1.Event, name string) string {
+	if event == nil {
+		return ""
+	}
+	return event.Annotations[name]
+}
+
+// commonMessage returns message of Event without variable parts as it is used in labels of metrics, e.g. {{commonMessage .}}
+func commonMessage(event *corev1.Event) string {
+	if event == nil {
+		return ""
+	}
+	return aggregation.GetCommonMessage(event.InvolvedObject.Kind, event.Reason, event.Message)
+}
+
+// regexReplace replaces matches of the pattern in the value, e.g. {{.Message | regexReplace "[0-9]+" "N"}}.
+// The pattern is compiled on each call, ParseEventTemplate replaces the function with regexReplaceFunc
+func regexReplace(pattern string, replacement string, value string) (string, error) {
+	return regexReplaceFunc(nil)(pattern, replacement, value)
+}
+
+// regexReplaceFunc returns regexReplace using patterns compiled in advance. Patterns which are not constants of
+// the template, e.g. taken from labels of Event, are compiled on each call
+func regexReplaceFunc(patterns map[string]*regexp.Regexp) func(string, string, string) (string, error) {
+	return func(pattern string, replacement string, value string) (string, error) {
+		re, ok := patterns[pattern]
+		if !ok {
+			var err error
+			if re, err = regexp.Compile(pattern); err != nil {
+				return "", err
+			}
+		}
+		return re.ReplaceAllString(value, replacement), nil
+	}
+}
+
+// compilePatterns compiles constant patterns of regexReplace in the template and templates associated with it
+func compilePatterns(t *template.Template) (map[string]*regexp.Regexp, error) {
+	patterns := map[string]*regexp.Regexp{}
+	var walk func(node parse.Node) error
+	walkBranch := func(branch *parse.BranchNode) error {
+		for _, node := range []parse.Node{branch.Pipe, branch.List, branch.ElseList} {
+			if err := walk(node); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	walk = func(node parse.Node) error {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return nil
+			}
+			for _, child := range n.Nodes {
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		case *parse.ActionNode:
+			return walk(n.Pipe)
+		case *parse.IfNode:
+			return walkBranch(&n.BranchNode)
+		case *parse.RangeNode:
+			return walkBranch(&n.BranchNode)
+		case *parse.WithNode:
+			return walkBranch(&n.BranchNode)
+		case *parse.TemplateNode:
+			return walk(n.Pipe)
+		case *parse.ChainNode:
+			return walk(n.Node)
+		case *parse.PipeNode:
+			if n == nil {
+				return nil
+			}
+			for _, command := range n.Cmds {
+				if err := walk(command); err != nil {
+					return err
+				}
+			}
+		case *parse.CommandNode:
+			if function, ok := n.Args[0].(*parse.IdentifierNode); ok && function.Ident == "regexReplace" && len(n.Args) > 1 {
+				if pattern, ok := n.Args[1].(*parse.StringNode); ok {
+					re, err := regexp.Compile(pattern.Text)
+					if err != nil {
+						return fmt.Errorf("invalid pattern of regexReplace: %w", err)
+					}
+					patterns[pattern.Text] = re
+				}
+			}
+			for _, arg := range n.Args {
+				if err := walk(arg); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for _, associated := range t.Templates() {
+		if associated.Tree == nil {
+			continue
+		}
+		if err := walk(associated.Root); err != nil {
+			return nil, err
+		}
+	}
+	return patterns, nil
+}
@@ -0,0 +1,136 @@
+package format
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// render returns the event printed by the template
+func render(t *testing.T, text string, event *corev1.Event) string {
+	eventTemplate, err := NewTemplate(text)
+	assert.NoError(t, err, "No error should happen")
+	return FormatEventWithTemplate(eventTemplate, event.DeepCopy())
+}
+
+func Test_TemplateFuncs_ToJson(t *testing.T) {
+	event := test.EventPodLogging.DeepCopy()
+	event.Labels = map[string]string{"app": "nginx"}
+	event.Message = `line "one"` + "\nline two"
+	assert.Equal(t, `{"app":"nginx"}`, render(t, "{{toJson .Labels}}", event))
+	assert.Equal(t, `"line \"one\"\nline two"`, render(t, "{{.Message | toJson}}", event))
+	assert.Equal(t, `"Pod"`, render(t, "{{toJson .InvolvedObject.Kind}}", event))
+
+	_, err := toJSON(func() {})
+	assert.Error(t, err, "Functions cannot be encoded to JSON")
+}
+
+func Test_TemplateFuncs_Truncate(t *testing.T) {
+	assert.Equal(t, "Started", render(t, "{{.Message | truncate 7}}", test.EventPodLogging))
+	assert.Equal(t, "Started container test", render(t, "{{.Message | truncate 100}}", test.EventPodLogging))
+	assert.Equal(t, "Привет", truncate(6, "Привет, мир"), "Multibyte characters should not be split")
+	assert.Equal(t, "", truncate(0, "message"))
+	assert.Equal(t, "message", truncate(-1, "message"))
+}
+
+func Test_TemplateFuncs_LowerUpper(t *testing.T) {
+	assert.Equal(t, "normal", render(t, "{{lower .Type}}", test.EventPodLogging))
+	assert.Equal(t, "WARNING BACKOFF", render(t, "{{upper .Type}} {{.Reason | upper}}", test.EventPodTracing))
+}
+
+func Test_TemplateFuncs_Default(t *testing.T) {
+	event := test.EventPodLogging.DeepCopy()
+	event.ReportingController = ""
+	event.Labels = nil
+	assert.Equal(t, "unknown", render(t, `{{.ReportingController | default "unknown"}}`, event))
+	assert.Equal(t, "Started", render(t, `{{.Reason | default "unknown"}}`, event))
+	assert.Equal(t, "none", render(t, `{{.Labels | default "none"}}`, event))
+	assert.Equal(t, "0", render(t, `{{.Count | default 0}}`, &corev1.Event{}))
+	assert.Equal(t, "none", defaultValue("none", nil))
+	assert.Equal(t, "none", defaultValue("none", []string{}))
+	assert.Equal(t, 5, defaultValue(1, 5))
+}
+
+func Test_TemplateFuncs_Since(t *testing.T) {
+	event := test.EventPodLogging.DeepCopy()
+	event.FirstTimestamp = metav1.NewTime(time.Now().Add(-90 * time.Second))
+	event.EventTime = metav1.NewMicroTime(time.Now().Add(-time.Hour))
+	assert.Equal(t, "1m30s", render(t, "{{since .FirstTimestamp}}", event))
+	assert.Equal(t, "1h0m0s", render(t, "{{since .EventTime}}", event))
+
+	duration, err := since(time.Now().Add(-2 * time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Second, duration)
+
+	duration, err = since(metav1.Time{})
+	assert.NoError(t, err)
+	assert.Zero(t, duration, "Zero timestamp should give zero duration")
+
+	duration, err = since((*metav1.Time)(nil))
+	assert.NoError(t, err)
+	assert.Zero(t, duration)
+
+	_, err = since("2024-01-01")
+	assert.Error(t, err, "Strings are not supported")
+	_, err = NewTemplate("{{since .Message}}")
+	assert.Error(t, err, "Template with wrong argument of since should fail on sample event")
+}
+
+func Test_TemplateFuncs_LabelAnnotation(t *testing.T) {
+	event := test.EventPodLogging.DeepCopy()
+	event.Labels = map[string]string{"app": "nginx"}
+	event.Annotations = map[string]string{"owner": "team-a"}
+	assert.Equal(t, "nginx team-a", render(t, `{{label . "app"}} {{annotation . "owner"}}`, event))
+	assert.Equal(t, " ", render(t, `{{label . "missing"}} {{annotation . "missing"}}`, event), "Missing keys should give empty strings")
+	assert.Equal(t, " ", render(t, `{{label . "app"}} {{annotation . "owner"}}`, &corev1.Event{}), "Nil maps should give empty strings")
+	assert.Equal(t, "", label(nil, "app"))
+	assert.Equal(t, "", annotation(nil, "owner"))
+}
+
+func Test_TemplateFuncs_CommonMessage(t *testing.T) {
+	assert.Equal(t, "Created or started container", render(t, "{{commonMessage .}}", test.EventPodLogging))
+	assert.Equal(t, "", commonMessage(nil))
+}
+
+func Test_TemplateFuncs_Env(t *testing.T) {
+	t.Setenv("EVENTS_READER_TEST_CLUSTER", "prod")
+	assert.Equal(t, "prod/Normal", render(t, `{{env "EVENTS_READER_TEST_CLUSTER"}}/{{.Type}}`, test.EventPodLogging))
+	assert.Equal(t, "", render(t, `{{env "EVENTS_READER_TEST_NOT_SET"}}`, test.EventPodLogging))
+}
+
+func Test_TemplateFuncs_RegexReplace(t *testing.T) {
+	event := test.EventPodLogging.DeepCopy()
+	event.Message = "Scaled up replica set nginx-5d9c7 to 3"
+	assert.Equal(t, "Scaled up replica set nginx-N to N", render(t, `{{.Message | regexReplace "[0-9][0-9a-z]*" "N"}}`, event))
+	assert.Equal(t, "nginx", render(t, `{{.Message | regexReplace "^.* set ([a-z]+)-.*$" "$1"}}`, event), "Groups should be supported in replacement")
+
+	_, err := regexReplace("[", "", "value")
+	assert.Error(t, err)
+	_, err = NewTemplate(`{{.Message | regexReplace "(" ""}}`)
+	assert.Error(t, err, "Template with invalid pattern should fail on sample event")
+	_, err = NewTemplate(`{{if eq .Type "Unknown"}}{{regexReplace "(" "" .Message}}{{end}}`)
+	assert.Error(t, err, "Invalid pattern should be found in branches not executed for sample event")
+}
+
+func Test_CompilePatterns(t *testing.T) {
+	eventTemplate, err := template.New("test").Funcs(templateFuncs).Parse(
+		`{{define "name"}}{{regexReplace "-[0-9]+$" "" .}}{{end}}` +
+			`{{if .Message}}{{.Message | regexReplace "[0-9]+" "N" | upper}}{{else}}{{template "name" .InvolvedObject.Name}}{{end}}` +
+			`{{range .Labels}}{{(regexReplace "^a" "b" .) | lower}}{{end}}{{.Message | regexReplace .Reason "X"}}`)
+	assert.NoError(t, err)
+	patterns, err := compilePatterns(eventTemplate)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"-[0-9]+$", "[0-9]+", "^a"}, slices.Collect(maps.Keys(patterns)))
+
+	event := test.EventPodLogging.DeepCopy()
+	event.Message = "Started container 2"
+	assert.Equal(t, "STARTED CONTAINER N", render(t, `{{.Message | regexReplace "[0-9]+" "N" | upper}}`, event))
+	assert.Equal(t, "X container 2", render(t, `{{.Message | regexReplace .Reason "X"}}`, event), "Patterns of fields should be compiled on execution")
+}
@@ -0,0 +1,262 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Layouts of structured output of Event
+const (
+	LayoutJSON   = "json"
+	LayoutLogfmt = "logfmt"
+	LayoutECS    = "ecs"
+)
+
+// ECSVersion is the version of Elastic Common Schema used in ecs layout
+const ECSVersion = "8.11.0"
+
+// eventField describes a field of structured output: how to get its value from Event and where to put it in ECS layout.
+// Fields with nil value are omitted
+type eventField struct {
+	value   func(event *corev1.Event) any
+	ecsPath string
+}
+
+var eventFields = map[string]eventField{
+	"time":                          {func(e *corev1.Event) any { return formatTime(ResolveTimestamp(e).Time) }, "@timestamp"},
+	"timeSource":                    {func(e *corev1.Event) any { return ResolveTimestamp(e).Source }, "kubernetes.event.time_source"},
+	"timeObserved":                  {func(e *corev1.Event) any { return ResolveTimestamp(e).Observed }, "kubernetes.event.time_observed"},
+	"involvedObjectKind":            {func(e *corev1.Event) any { return e.InvolvedObject.Kind }, "orchestrator.resource.type"},
+	"involvedObjectNamespace":       {func(e *corev1.Event) any { return e.InvolvedObject.Namespace }, "orchestrator.namespace"},
+	"involvedObjectName":            {func(e *corev1.Event) any { return e.InvolvedObject.Name }, "orchestrator.resource.name"},
+	"involvedObjectUid":             {func(e *corev1.Event) any { return string(e.InvolvedObject.UID) }, "kubernetes.event.involved_object.uid"},
+	"involvedObjectApiVersion":      {func(e *corev1.Event) any { return e.InvolvedObject.APIVersion }, "orchestrator.api_version"},
+	"involvedObjectResourceVersion": {func(e *corev1.Event) any { return e.InvolvedObject.ResourceVersion }, "kubernetes.event.involved_object.resource_version"},
+	"involvedObjectFieldPath":       {func(e *corev1.Event) any { return e.InvolvedObject.FieldPath }, "kubernetes.event.involved_object.field_path"},
+	"reason":                        {func(e *corev1.Event) any { return e.Reason }, "event.reason"},
+	"type":                          {func(e *corev1.Event) any { return e.Type }, "kubernetes.event.type"},
+	"message":                       {func(e *corev1.Event) any { return e.Message }, "message"},
+	"kind":                          {func(*corev1.Event) any { return "KubernetesEvent" }, ""},
+	"name":                          {func(e *corev1.Event) any { return e.Name }, "kubernetes.event.metadata.name"},
+	"namespace":                     {func(e *corev1.Event) any { return e.Namespace }, "kubernetes.event.metadata.namespace"},
+	"uid":                           {func(e *corev1.Event) any { return string(e.UID) }, "event.id"},
+	"labels":                        {func(e *corev1.Event) any { return nilIfEmpty(e.Labels) }, "labels"},
+	"annotations":                   {func(e *corev1.Event) any { return nilIfEmpty(e.Annotations) }, "kubernetes.event.metadata.annotations"},
+	"source":                        {eventSource, "kubernetes.event.source"},
+	"reportingController":           {func(e *corev1.Event) any { return e.ReportingController }, "event.provider"},
+	"reportingInstance":             {func(e *corev1.Event) any { return e.ReportingInstance }, "kubernetes.event.reporting_instance"},
+	"action":                        {func(e *corev1.Event) any { return e.Action }, "event.action"},
+	"count":                         {func(e *corev1.Event) any { return e.Count }, "kubernetes.event.count"},
+	"firstTimestamp":                {func(e *corev1.Event) any { return formatTime(e.FirstTimestamp.Time) }, "event.start"},
+	"lastTimestamp":                 {func(e *corev1.Event) any { return formatTime(e.LastTimestamp.Time) }, "event.end"},
+	"eventTime":                     {func(e *corev1.Event) any { return formatTime(e.EventTime.Time) }, "event.created"},
+	"series":                        {eventSeries, "kubernetes.event.series"},
+	"cluster":                       {func(*corev1.Event) any { return ClusterName }, "orchestrator.cluster.name"},
+}
+
+// DefaultFields are fields of the default template of logs
+var DefaultFields = []string{
+	"time", "involvedObjectKind", "involvedObjectNamespace", "involvedObjectName", "involvedObjectUid",
+	"involvedObjectApiVersion", "involvedObjectResourceVersion", "reason", "type", "message", "kind",
+}
+
+// StructuredFormatter encodes Event in json, logfmt or ecs layout with encoders instead of text templates,
+// so the output is valid whatever the values of fields are
+type StructuredFormatter struct {
+	layout string
+	fields []string
+}
+
+// NewStructuredFormatter creates formatter with the given layout and fields. DefaultFields are used if fields are empty
+func NewStructuredFormatter(layout string, fields []string) (*StructuredFormatter, error) {
+	if layout != LayoutJSON && layout != LayoutLogfmt && layout != LayoutECS {
+		return nil, fmt.Errorf("layout is not supported: %s", layout)
+	}
+	if len(fields) == 0 {
+		fields = DefaultFields
+	}
+	for _, field := range fields {
+		if _, ok := eventFields[field]; !ok {
+			return nil, fmt.Errorf("field is not supported: %s. Supported fields: %s", field, strings.Join(slices.Sorted(maps.Keys(eventFields)), ", "))
+		}
+	}
+	return &StructuredFormatter{layout: layout, fields: fields}, nil
+}
+
+// Format returns Event encoded in the layout of the formatter
+func (sf *StructuredFormatter) Format(event *corev1.Event) (string, error) {
+	switch sf.layout {
+	case LayoutLogfmt:
+		return sf.formatLogfmt(event), nil
+	case LayoutECS:
+		return sf.formatECS(event)
+	}
+	return sf.formatJSON(event)
+}
+
+// formatJSON writes fields in the configured order. Values are encoded by JSON encoder
+func (sf *StructuredFormatter) formatJSON(event *corev1.Event) (string, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	buffer.WriteByte('{')
+	first := true
+	for _, field := range sf.fields {
+		value := eventFields[field].value(event)
+		if value == nil {
+			continue
+		}
+		if !first {
+			buffer.WriteByte(',')
+		}
+		first = false
+		if err := encoder.Encode(field); err != nil {
+			return "", err
+		}
+		trimNewline(&buffer)
+		buffer.WriteByte(':')
+		if err := encoder.Encode(value); err != nil {
+			return "", err
+		}
+		trimNewline(&buffer)
+	}
+	buffer.WriteByte('}')
+	return buffer.String(), nil
+}
+
+func trimNewline(buffer *bytes.Buffer) {
+	buffer.Truncate(buffer.Len() - 1)
+}
+
+// formatLogfmt writes fields as key=value pairs. Nested values are flattened with dot separated keys
+func (sf *StructuredFormatter) formatLogfmt(event *corev1.Event) string {
+	var pairs []string
+	for _, field := range sf.fields {
+		pairs = appendLogfmtPairs(pairs, field, eventFields[field].value(event))
+	}
+	return strings.Join(pairs, " ")
+}
+
+func appendLogfmtPairs(pairs []string, key string, value any) []string {
+	switch v := value.(type) {
+	case nil:
+		return pairs
+	case map[string]string:
+		for _, name := range slices.Sorted(maps.Keys(v)) {
+			pairs = appendLogfmtPairs(pairs, key+"."+name, v[name])
+		}
+		return pairs
+	case map[string]any:
+		for _, name := range slices.Sorted(maps.Keys(v)) {
+			pairs = appendLogfmtPairs(pairs, key+"."+name, v[name])
+		}
+		return pairs
+	case string:
+		return append(pairs, key+"="+logfmtValue(v))
+	}
+	return append(pairs, fmt.Sprintf("%s=%v", key, value))
+}
+
+// logfmtValue quotes the value if it is empty or contains spaces, quotes, equal signs or not printable characters
+func logfmtValue(value string) string {
+	if len(value) == 0 || strings.ContainsFunc(value, func(r rune) bool {
+		return r == '"' || r == '=' || r == '\\' || unicode.IsSpace(r) || !unicode.IsPrint(r)
+	}) {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// formatECS puts fields to their paths of Elastic Common Schema
+func (sf *StructuredFormatter) formatECS(event *corev1.Event) (string, error) {
+	document := map[string]any{}
+	setPath(document, "ecs.version", ECSVersion)
+	setPath(document, "event.kind", "event")
+	setPath(document, "event.dataset", "kubernetes.event")
+	setPath(document, "orchestrator.type", "kubernetes")
+	logLevel := "info"
+	if event.Type == corev1.EventTypeWarning {
+		logLevel = "warning"
+	}
+	setPath(document, "log.level", logLevel)
+	for _, field := range sf.fields {
+		eventField := eventFields[field]
+		if len(eventField.ecsPath) == 0 {
+			continue
+		}
+		if value := eventField.value(event); value != nil {
+			setPath(document, eventField.ecsPath, value)
+		}
+	}
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(document); err != nil {
+		return "", err
+	}
+	trimNewline(&buffer)
+	return buffer.String(), nil
+}
+
+// setPath sets value to the dot separated path creating nested objects
+func setPath(document map[string]any, path string, value any) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		nested, ok := document[key].(map[string]any)
+		if !ok {
+			nested = map[string]any{}
+			document[key] = nested
+		}
+		document = nested
+	}
+	document[keys[len(keys)-1]] = value
+}
+
+func eventSource(event *corev1.Event) any {
+	source := map[string]any{}
+	if len(event.Source.Component) > 0 {
+		source["component"] = event.Source.Component
+	}
+	if len(event.Source.Host) > 0 {
+		source["host"] = event.Source.Host
+	}
+	if len(source) == 0 {
+		return nil
+	}
+	return source
+}
+
+func eventSeries(event *corev1.Event) any {
+	if event.Series == nil {
+		return nil
+	}
+	series := map[string]any{"count": event.Series.Count}
+	if !event.Series.LastObservedTime.IsZero() {
+		series["lastObservedTime"] = formatTime(event.Series.LastObservedTime.Time)
+	}
+	return series
+}
+
+// formatTime returns time in RFC 3339 format with milliseconds in UTC or nil for zero time
+func formatTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+func nilIfEmpty(values map[string]string) any {
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
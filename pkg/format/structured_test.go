@@ -0,0 +1,155 @@
+package format
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// eventWithSpecialCharacters returns Event with values that break JSON built by text template
+func eventWithSpecialCharacters() *corev1.Event {
+	event := test.EventPodTracing.DeepCopy()
+	event.Reason = `Back"Off`
+	event.InvolvedObject.Name = "test-pod\nsecond line"
+	event.Message = "<b>message</b> with \"quotes\" and \\ backslash"
+	event.Labels = map[string]string{"app": "test app"}
+	event.Source = corev1.EventSource{Component: "kubelet", Host: "node-1"}
+	event.Series = &corev1.EventSeries{Count: 3, LastObservedTime: metav1.MicroTime{Time: test.LastTs.Time}}
+	return event
+}
+
+func Test_StructuredFormatter_JSON_DefaultFields(t *testing.T) {
+	formatter, err := NewStructuredFormatter(LayoutJSON, nil)
+	assert.NoError(t, err)
+	event := eventWithSpecialCharacters()
+	formatted, err := formatter.Format(event)
+	assert.NoError(t, err)
+
+	var decoded map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(formatted), &decoded), "Formatted event should be valid JSON: %s", formatted)
+	assert.Len(t, decoded, len(DefaultFields))
+	assert.Equal(t, `Back"Off`, decoded["reason"])
+	assert.Equal(t, "test-pod\nsecond line", decoded["involvedObjectName"])
+	assert.Equal(t, event.Message, decoded["message"])
+	assert.Equal(t, "KubernetesEvent", decoded["kind"])
+	assert.Equal(t, test.LastTs.UTC().Format("2006-01-02T15:04:05.000Z07:00"), decoded["time"])
+	assert.Regexp(t, `^\{"time":".*","involvedObjectKind":"Pod",`, formatted, "Fields should be written in configured order")
+}
+
+func Test_StructuredFormatter_JSON_CustomFields(t *testing.T) {
+	formatter, err := NewStructuredFormatter(LayoutJSON, []string{"message", "labels", "source", "count", "firstTimestamp", "eventTime", "series"})
+	assert.NoError(t, err)
+	formatted, err := formatter.Format(eventWithSpecialCharacters())
+	assert.NoError(t, err)
+
+	var decoded struct {
+		Message        string            `json:"message"`
+		Labels         map[string]string `json:"labels"`
+		Source         map[string]string `json:"source"`
+		Count          int32             `json:"count"`
+		FirstTimestamp string            `json:"firstTimestamp"`
+		EventTime      *string           `json:"eventTime"`
+		Series         struct {
+			Count            int32  `json:"count"`
+			LastObservedTime string `json:"lastObservedTime"`
+		} `json:"series"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(formatted), &decoded))
+	assert.Equal(t, map[string]string{"app": "test app"}, decoded.Labels)
+	assert.Equal(t, map[string]string{"component": "kubelet", "host": "node-1"}, decoded.Source)
+	assert.Equal(t, test.EventPodTracing.Count, decoded.Count)
+	assert.NotEmpty(t, decoded.FirstTimestamp)
+	assert.Nil(t, decoded.EventTime, "Zero eventTime should be omitted")
+	assert.Equal(t, int32(3), decoded.Series.Count)
+	assert.NotEmpty(t, decoded.Series.LastObservedTime)
+}
+
+func Test_StructuredFormatter_Logfmt(t *testing.T) {
+	formatter, err := NewStructuredFormatter(LayoutLogfmt, []string{"type", "reason", "involvedObjectName", "labels", "series", "count", "eventTime"})
+	assert.NoError(t, err)
+	formatted, err := formatter.Format(eventWithSpecialCharacters())
+	assert.NoError(t, err)
+	assert.Equal(t, `type=Warning reason="Back\"Off" involvedObjectName="test-pod\nsecond line" labels.app="test app" series.count=3 series.lastObservedTime=`+
+		test.LastTs.UTC().Format("2006-01-02T15:04:05.000Z07:00")+` count=3`, formatted)
+}
+
+func Test_StructuredFormatter_ECS(t *testing.T) {
+	ClusterName = "test-cluster"
+	defer func() { ClusterName = "" }()
+	formatter, err := NewStructuredFormatter(LayoutECS, append([]string{"labels", "cluster", "reportingController"}, DefaultFields...))
+	assert.NoError(t, err)
+	formatted, err := formatter.Format(eventWithSpecialCharacters())
+	assert.NoError(t, err)
+
+	var decoded struct {
+		Timestamp string            `json:"@timestamp"`
+		Message   string            `json:"message"`
+		Labels    map[string]string `json:"labels"`
+		ECS       struct {
+			Version string `json:"version"`
+		} `json:"ecs"`
+		Event struct {
+			Kind     string `json:"kind"`
+			Dataset  string `json:"dataset"`
+			Reason   string `json:"reason"`
+			Provider string `json:"provider"`
+		} `json:"event"`
+		Log struct {
+			Level string `json:"level"`
+		} `json:"log"`
+		Orchestrator struct {
+			Type      string `json:"type"`
+			Namespace string `json:"namespace"`
+			Cluster   struct {
+				Name string `json:"name"`
+			} `json:"cluster"`
+			Resource struct {
+				Type string `json:"type"`
+				Name string `json:"name"`
+			} `json:"resource"`
+		} `json:"orchestrator"`
+		Kubernetes struct {
+			Event struct {
+				Type string `json:"type"`
+			} `json:"event"`
+		} `json:"kubernetes"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(formatted), &decoded), formatted)
+	assert.NotEmpty(t, decoded.Timestamp)
+	assert.Equal(t, ECSVersion, decoded.ECS.Version)
+	assert.Equal(t, "event", decoded.Event.Kind)
+	assert.Equal(t, "kubernetes.event", decoded.Event.Dataset)
+	assert.Equal(t, `Back"Off`, decoded.Event.Reason)
+	assert.Equal(t, "kubelet", decoded.Event.Provider)
+	assert.Equal(t, "warning", decoded.Log.Level)
+	assert.Equal(t, "kubernetes", decoded.Orchestrator.Type)
+	assert.Equal(t, "tracing", decoded.Orchestrator.Namespace)
+	assert.Equal(t, "test-cluster", decoded.Orchestrator.Cluster.Name)
+	assert.Equal(t, "Pod", decoded.Orchestrator.Resource.Type)
+	assert.Equal(t, "Warning", decoded.Kubernetes.Event.Type)
+	assert.Equal(t, map[string]string{"app": "test app"}, decoded.Labels)
+	assert.NotContains(t, formatted, "KubernetesEvent", "Field kind has no ECS mapping")
+}
+
+func Test_NewStructuredFormatter_Invalid(t *testing.T) {
+	_, err := NewStructuredFormatter("xml", nil)
+	assert.Error(t, err)
+	_, err = NewStructuredFormatter(LayoutJSON, []string{"message", "unknown"})
+	assert.ErrorContains(t, err, "field is not supported: unknown")
+}
+
+func Test_StructuredFormatter_TimeSource(t *testing.T) {
+	event := test.EventPodLogging.DeepCopy()
+	event.LastTimestamp = metav1.Time{}
+	event.FirstTimestamp = metav1.Time{}
+	event.CreationTimestamp = metav1.NewTime(test.LastTs.Time)
+	formatter, err := NewStructuredFormatter(LayoutLogfmt, []string{"time", "timeSource", "timeObserved"})
+	assert.NoError(t, err)
+	formatted, err := formatter.Format(event)
+	assert.NoError(t, err)
+	assert.Equal(t, "time="+test.LastTs.UTC().Format("2006-01-02T15:04:05.000Z07:00")+" timeSource=metadata.creationTimestamp timeObserved=false", formatted)
+}
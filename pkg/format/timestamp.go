@@ -0,0 +1,53 @@
+package format
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Sources of EventTimestamp in the order of preference
+const (
+	TimestampSourceSeries            = "series.lastObservedTime"
+	TimestampSourceLastTimestamp     = "lastTimestamp"
+	TimestampSourceEventTime         = "eventTime"
+	TimestampSourceFirstTimestamp    = "firstTimestamp"
+	TimestampSourceCreationTimestamp = "metadata.creationTimestamp"
+	TimestampSourceNow               = "now"
+)
+
+// EventTimestamp is the time of the last occurrence of Event and the field it is taken from
+type EventTimestamp struct {
+	time.Time
+	// Source is the field of Event the time is taken from, one of TimestampSource constants
+	Source string
+	// Observed is true if the time is set by the reporting controller. It is false if the time is inferred
+	// from the creation time of Event object or the current time
+	Observed bool
+}
+
+// ResolveTimestamp returns the time of the last occurrence of Event. Fields are checked in the order of preference:
+//
+//  1. series.lastObservedTime - the last occurrence of the series of events.k8s.io/v1 API;
+//  2. lastTimestamp - the last occurrence of core/v1 API;
+//  3. eventTime - the first occurrence of events.k8s.io/v1 API, set by newer controllers instead of lastTimestamp;
+//  4. firstTimestamp - the first occurrence of core/v1 API;
+//  5. metadata.creationTimestamp - the time Event object is created by API server, inferred;
+//  6. the current time, inferred.
+//
+// Event is not changed, so the result can be used by all sinks sharing the object
+func ResolveTimestamp(event *corev1.Event) EventTimestamp {
+	switch {
+	case event.Series != nil && !event.Series.LastObservedTime.IsZero():
+		return EventTimestamp{Time: event.Series.LastObservedTime.Time, Source: TimestampSourceSeries, Observed: true}
+	case !event.LastTimestamp.IsZero():
+		return EventTimestamp{Time: event.LastTimestamp.Time, Source: TimestampSourceLastTimestamp, Observed: true}
+	case !event.EventTime.IsZero():
+		return EventTimestamp{Time: event.EventTime.Time, Source: TimestampSourceEventTime, Observed: true}
+	case !event.FirstTimestamp.IsZero():
+		return EventTimestamp{Time: event.FirstTimestamp.Time, Source: TimestampSourceFirstTimestamp, Observed: true}
+	case !event.CreationTimestamp.IsZero():
+		return EventTimestamp{Time: event.CreationTimestamp.Time, Source: TimestampSourceCreationTimestamp}
+	}
+	return EventTimestamp{Time: time.Now(), Source: TimestampSourceNow}
+}
@@ -0,0 +1,70 @@
+package format
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_ResolveTimestamp_OrderOfPreference(t *testing.T) {
+	series := time.Date(2024, 5, 1, 10, 0, 6, 0, time.UTC)
+	last := time.Date(2024, 5, 1, 10, 0, 5, 0, time.UTC)
+	eventTime := time.Date(2024, 5, 1, 10, 0, 4, 0, time.UTC)
+	first := time.Date(2024, 5, 1, 10, 0, 3, 0, time.UTC)
+	created := time.Date(2024, 5, 1, 10, 0, 2, 0, time.UTC)
+
+	event := &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)},
+		Series:         &corev1.EventSeries{Count: 2, LastObservedTime: metav1.NewMicroTime(series)},
+		LastTimestamp:  metav1.NewTime(last),
+		EventTime:      metav1.NewMicroTime(eventTime),
+		FirstTimestamp: metav1.NewTime(first),
+	}
+	for _, expected := range []EventTimestamp{
+		{Time: series, Source: TimestampSourceSeries, Observed: true},
+		{Time: last, Source: TimestampSourceLastTimestamp, Observed: true},
+		{Time: eventTime, Source: TimestampSourceEventTime, Observed: true},
+		{Time: first, Source: TimestampSourceFirstTimestamp, Observed: true},
+		{Time: created, Source: TimestampSourceCreationTimestamp, Observed: false},
+	} {
+		timestamp := ResolveTimestamp(event)
+		assert.Equal(t, expected.Source, timestamp.Source)
+		assert.True(t, expected.Equal(timestamp.Time), "Time should be taken from %s", expected.Source)
+		assert.Equal(t, expected.Observed, timestamp.Observed, expected.Source)
+
+		// remove the field used, so the next one is resolved
+		switch expected.Source {
+		case TimestampSourceSeries:
+			event.Series.LastObservedTime = metav1.MicroTime{}
+		case TimestampSourceLastTimestamp:
+			event.LastTimestamp = metav1.Time{}
+		case TimestampSourceEventTime:
+			event.EventTime = metav1.MicroTime{}
+		case TimestampSourceFirstTimestamp:
+			event.FirstTimestamp = metav1.Time{}
+		}
+	}
+
+	event.CreationTimestamp = metav1.Time{}
+	before := time.Now()
+	timestamp := ResolveTimestamp(event)
+	assert.Equal(t, TimestampSourceNow, timestamp.Source)
+	assert.False(t, timestamp.Observed)
+	assert.False(t, timestamp.Before(before), "Current time should be used if Event has no timestamps")
+}
+
+func Test_FormatEventWithTemplate_DoesNotChangeEvent(t *testing.T) {
+	event := test.EventPodLogging.DeepCopy()
+	event.LastTimestamp = metav1.Time{}
+	event.EventTime = metav1.NewMicroTime(test.LastTs.Time)
+	expected := event.DeepCopy()
+
+	eventTemplate, err := NewTemplate(`{{(timestamp .).UTC.Format "2006-01-02T15:04:05Z07:00"}} {{(timestamp .).Source}} {{(timestamp .).Observed}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, test.LastTs.UTC().Format("2006-01-02T15:04:05Z07:00")+" eventTime true", FormatEventWithTemplate(eventTemplate, event))
+	assert.Equal(t, expected, event, "Event should not be changed by formatting")
+}
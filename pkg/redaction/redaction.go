@@ -0,0 +1,258 @@
+package redaction
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	defaultReplacement = "[REDACTED]"
+	// secretGroup is the name of the group of the pattern which is replaced instead of the whole match
+	secretGroup = "secret"
+)
+
+type detector struct {
+	name    string
+	pattern string
+}
+
+// detectors are built-in rules applied in this order, so specific detectors go before generic ones, e.g. credentials
+// in URLs are found before emails. Patterns with the secret group keep the context of the secret, e.g. the name of the key
+var detectors = []detector{
+	{"jwt", `\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`},
+	{"bearerToken", `(?i)\bbearer\s+(?P<secret>[A-Za-z0-9\-._~+/]+=*)`},
+	{"urlCredentials", `(?i)\b[a-z][a-z0-9+.-]*://[^/\s:@]+:(?P<secret>[^/\s@]+)@`},
+	{"dockerAuth", `(?i)"auth"\s*:\s*"(?P<secret>[^"]+)"`},
+	{"secretAssignment", `(?i)\b(?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key)\s*[=:]\s*"?(?P<secret>[^\s,;"']+)`},
+	{"awsAccessKey", `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{"email", `\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`},
+	{"ipv4", `\b(?:(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\b`},
+}
+
+// eventField reads values of the field of Event and replaces them with redacted values
+type eventField struct {
+	values func(event *corev1.Event) []string
+	redact func(event *corev1.Event, redact func(string) string)
+}
+
+// fields are fields of Event which can be redacted in addition to message
+var fields = map[string]eventField{
+	"message": {
+		func(e *corev1.Event) []string { return []string{e.Message} },
+		func(e *corev1.Event, redact func(string) string) { e.Message = redact(e.Message) },
+	},
+	"reason": {
+		func(e *corev1.Event) []string { return []string{e.Reason} },
+		func(e *corev1.Event, redact func(string) string) { e.Reason = redact(e.Reason) },
+	},
+	"action": {
+		func(e *corev1.Event) []string { return []string{e.Action} },
+		func(e *corev1.Event, redact func(string) string) { e.Action = redact(e.Action) },
+	},
+	"involvedObjectName": {
+		func(e *corev1.Event) []string { return []string{e.InvolvedObject.Name} },
+		func(e *corev1.Event, redact func(string) string) {
+			e.InvolvedObject.Name = redact(e.InvolvedObject.Name)
+		},
+	},
+	"involvedObjectFieldPath": {
+		func(e *corev1.Event) []string { return []string{e.InvolvedObject.FieldPath} },
+		func(e *corev1.Event, redact func(string) string) {
+			e.InvolvedObject.FieldPath = redact(e.InvolvedObject.FieldPath)
+		},
+	},
+	"reportingInstance": {
+		func(e *corev1.Event) []string { return []string{e.ReportingInstance} },
+		func(e *corev1.Event, redact func(string) string) { e.ReportingInstance = redact(e.ReportingInstance) },
+	},
+	"sourceHost": {
+		func(e *corev1.Event) []string { return []string{e.Source.Host} },
+		func(e *corev1.Event, redact func(string) string) { e.Source.Host = redact(e.Source.Host) },
+	},
+	"labels": {
+		func(e *corev1.Event) []string { return slices.Collect(maps.Values(e.Labels)) },
+		func(e *corev1.Event, redact func(string) string) { redactValues(e.Labels, redact) },
+	},
+	"annotations": {
+		func(e *corev1.Event) []string { return slices.Collect(maps.Values(e.Annotations)) },
+		func(e *corev1.Event, redact func(string) string) { redactValues(e.Annotations, redact) },
+	},
+}
+
+type rule struct {
+	name        string
+	pattern     *regexp.Regexp
+	replacement string
+	// expand is true if the replacement can refer to groups of the pattern
+	expand bool
+}
+
+// Redactor replaces sensitive data in events by built-in detectors and custom rules
+type Redactor struct {
+	rules  []rule
+	fields []string
+	// redactions counts replaced matches of each rule
+	redactions *prometheus.CounterVec
+}
+
+// Detectors returns names of built-in detectors in the order they are applied
+func Detectors() []string {
+	names := make([]string, len(detectors))
+	for i, d := range detectors {
+		names[i] = d.name
+	}
+	return names
+}
+
+func findDetector(name string) (detector, bool) {
+	i := slices.IndexFunc(detectors, func(d detector) bool { return d.name == name })
+	if i < 0 {
+		return detector{}, false
+	}
+	return detectors[i], true
+}
+
+// NewRedactor creates Redactor by the configuration and registers its counter of redactions in the registerer if it is
+// set. Nil is returned if the configuration is not set
+func NewRedactor(config *filter.Redaction, registerer prometheus.Registerer) (*Redactor, error) {
+	if config == nil {
+		return nil, nil
+	}
+	replacement := config.Replacement
+	if len(replacement) == 0 {
+		replacement = defaultReplacement
+	}
+	for _, name := range config.Detectors {
+		if _, ok := findDetector(name); !ok {
+			return nil, fmt.Errorf("redaction detector is not supported: %s. Supported detectors: %s", name, strings.Join(Detectors(), ", "))
+		}
+	}
+	redactor := &Redactor{
+		fields: []string{"message"},
+		redactions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kube_events_redactions_total",
+			Help: "Count of sensitive data redacted from kubernetes events by rule",
+		},
+			[]string{"rule"},
+		),
+	}
+	for _, d := range detectors {
+		if config.Detectors == nil || slices.Contains(config.Detectors, d.name) {
+			redactor.rules = append(redactor.rules, rule{name: d.name, pattern: regexp.MustCompile(d.pattern), replacement: replacement})
+		}
+	}
+	for _, r := range config.Rules {
+		if len(r.Name) == 0 || len(r.Pattern) == 0 {
+			return nil, errors.New("redaction rule must have name and pattern")
+		}
+		if _, ok := findDetector(r.Name); ok || redactor.hasRule(r.Name) {
+			return nil, fmt.Errorf("redaction rule name is not unique: %s", r.Name)
+		}
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse pattern of redaction rule %s: %w", r.Name, err)
+		}
+		custom := rule{name: r.Name, pattern: pattern, replacement: replacement}
+		if len(r.Replacement) > 0 {
+			custom.replacement = r.Replacement
+			custom.expand = true
+		}
+		redactor.rules = append(redactor.rules, custom)
+	}
+	for _, field := range config.Fields {
+		if _, ok := fields[field]; !ok {
+			return nil, fmt.Errorf("redaction field is not supported: %s. Supported fields: %s", field, strings.Join(slices.Sorted(maps.Keys(fields)), ", "))
+		}
+		if !slices.Contains(redactor.fields, field) {
+			redactor.fields = append(redactor.fields, field)
+		}
+	}
+	if registerer != nil {
+		if err := registerer.Register(redactor.redactions); err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range redactor.rules {
+		redactor.redactions.WithLabelValues(r.name)
+	}
+	return redactor, nil
+}
+
+func (r *Redactor) hasRule(name string) bool {
+	return slices.ContainsFunc(r.rules, func(existing rule) bool { return existing.name == name })
+}
+
+// Redact returns a copy of the event with sensitive data replaced. The event itself is returned if nothing is found,
+// so the event shared by sinks is never changed and copied only when it is needed
+func (r *Redactor) Redact(event *corev1.Event) *corev1.Event {
+	if r == nil || !r.isSensitive(event) {
+		return event
+	}
+	redacted := event.DeepCopy()
+	for _, field := range r.fields {
+		fields[field].redact(redacted, r.redactValue)
+	}
+	return redacted
+}
+
+// isSensitive returns true if any rule matches any redacted field of the event
+func (r *Redactor) isSensitive(event *corev1.Event) bool {
+	for _, field := range r.fields {
+		for _, value := range fields[field].values(event) {
+			for _, rl := range r.rules {
+				if rl.pattern.MatchString(value) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// redactValue applies all rules to the value and counts replaced matches
+func (r *Redactor) redactValue(value string) string {
+	for _, rl := range r.rules {
+		matches := rl.pattern.FindAllStringSubmatchIndex(value, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		r.redactions.WithLabelValues(rl.name).Add(float64(len(matches)))
+		value = rl.replace(value, matches)
+	}
+	return value
+}
+
+// replace replaces the secret group of each match or the whole match if the pattern has no such group
+func (rl rule) replace(value string, matches [][]int) string {
+	if rl.expand {
+		return rl.pattern.ReplaceAllString(value, rl.replacement)
+	}
+	group := rl.pattern.SubexpIndex(secretGroup)
+	var builder strings.Builder
+	last := 0
+	for _, match := range matches {
+		start, end := match[0], match[1]
+		if group > 0 && match[2*group] >= 0 {
+			start, end = match[2*group], match[2*group+1]
+		}
+		builder.WriteString(value[last:start])
+		builder.WriteString(rl.replacement)
+		last = end
+	}
+	builder.WriteString(value[last:])
+	return builder.String()
+}
+
+func redactValues(values map[string]string, redact func(string) string) {
+	for key, value := range values {
+		values[key] = redact(value)
+	}
+}
@@ -0,0 +1,179 @@
+package sink
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const defaultActiveWarningQuietPeriod = 15 * time.Minute
+
+// defaultResolvedBy are reasons of normal events which clear active warnings with the reason on the same object
+var defaultResolvedBy = map[string][]string{
+	"BackOff":                {"Started"},
+	"Failed":                 {"Pulled", "Started"},
+	"FailedScheduling":       {"Scheduled"},
+	"FailedMount":            {"Started"},
+	"FailedAttachVolume":     {"SuccessfulAttachVolume"},
+	"FailedCreate":           {"SuccessfulCreate"},
+	"FailedDelete":           {"SuccessfulDelete"},
+	"ProvisioningFailed":     {"ProvisioningSucceeded"},
+	"NodeNotReady":           {"NodeReady"},
+	"FailedCreatePodSandBox": {"Started"},
+}
+
+type ActiveWarningsSettings struct {
+	// QuietPeriod is the time without repeated warning after which the warning is cleared
+	QuietPeriod metav1.Duration `json:"quietPeriod,omitempty"`
+	// ResolvedBy maps reasons of warnings to reasons of normal events clearing them on the same object
+	ResolvedBy map[string][]string `json:"resolvedBy,omitempty"`
+}
+
+type activeWarningKey struct {
+	namespace string
+	kind      string
+	object    string
+	reason    string
+}
+
+func (k activeWarningKey) labelValues() []string {
+	return []string{k.namespace, k.kind, k.object, k.reason}
+}
+
+type activeWarning struct {
+	last time.Time
+	// values are label values of the series of the warning. They are set to other if the warning is over the limit of
+	// series
+	values   []string
+	overflow bool
+}
+
+// activeWarnings sets the gauge of the warning on the object to 1 and removes it after the quiet period or when
+// the normal event resolving the warning happens on the same object
+type activeWarnings struct {
+	mu          sync.Mutex
+	gauge       *prometheus.GaugeVec
+	quietPeriod time.Duration
+	// resolves maps reasons of normal events to reasons of warnings they clear
+	resolves map[string][]string
+	// lastWarnings are warnings which are not cleared yet
+	lastWarnings map[activeWarningKey]*activeWarning
+	// overflowed is the number of active warnings over the limit of series, which is the value of the overflow series
+	overflowed int
+	// series limits the number of series of the gauge together with other metrics of the sink. It can be nil
+	series *seriesTracker
+	now    func() time.Time
+}
+
+func newActiveWarnings(prefix string, settings *ActiveWarningsSettings, series *seriesTracker) *activeWarnings {
+	resolvedBy := settings.ResolvedBy
+	if resolvedBy == nil {
+		resolvedBy = defaultResolvedBy
+	}
+	resolves := make(map[string][]string)
+	for warning, normals := range resolvedBy {
+		for _, normal := range normals {
+			resolves[normal] = append(resolves[normal], warning)
+		}
+	}
+	return &activeWarnings{
+		gauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: prefix + "_active_warning",
+			Help: "Warning on kubernetes object which is still going on. It is removed after the quiet period or when the normal event resolving it happens",
+		},
+			[]string{"namespace", "kind", "object", "reason"},
+		),
+		quietPeriod:  DurationOrDefault(settings.QuietPeriod, defaultActiveWarningQuietPeriod),
+		resolves:     resolves,
+		lastWarnings: make(map[activeWarningKey]*activeWarning),
+		series:       series,
+		now:          time.Now,
+	}
+}
+
+// observe sets the warning active or clears warnings resolved by the normal event
+func (w *activeWarnings) observe(eventObj *corev1.Event) {
+	key := activeWarningKey{
+		namespace: eventObj.InvolvedObject.Namespace,
+		kind:      eventObj.InvolvedObject.Kind,
+		object:    eventObj.InvolvedObject.Name,
+		reason:    eventObj.Reason,
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !strings.EqualFold(eventObj.Type, corev1.EventTypeNormal) {
+		warning, ok := w.lastWarnings[key]
+		if !ok {
+			warning = &activeWarning{values: key.labelValues()}
+			w.lastWarnings[key] = warning
+		}
+		warning.last = w.now()
+		w.series.update(w.gauge, warning.values, func(values []string) {
+			if !slices.Equal(values, warning.values) {
+				warning.values = values
+				warning.overflow = true
+				w.overflowed++
+			}
+			if warning.overflow {
+				w.gauge.WithLabelValues(values...).Set(float64(w.overflowed))
+			} else {
+				w.gauge.WithLabelValues(values...).Set(1)
+			}
+		})
+		return
+	}
+	for _, reason := range w.resolves[eventObj.Reason] {
+		key.reason = reason
+		w.clear(key)
+	}
+}
+
+// expire clears warnings which are not repeated for the quiet period
+func (w *activeWarnings) expire() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.now()
+	for key, warning := range w.lastWarnings {
+		if now.Sub(warning.last) >= w.quietPeriod {
+			w.clear(key)
+		}
+	}
+}
+
+// clear removes the series of the warning. The overflow series is decremented and removed with the last warning
+// counted by it
+func (w *activeWarnings) clear(key activeWarningKey) {
+	warning, ok := w.lastWarnings[key]
+	if !ok {
+		return
+	}
+	delete(w.lastWarnings, key)
+	if warning.overflow {
+		w.overflowed--
+		if w.overflowed > 0 {
+			w.gauge.WithLabelValues(warning.values...).Set(float64(w.overflowed))
+			return
+		}
+	}
+	w.series.delete(w.gauge, warning.values)
+}
+
+// expireQuiet clears quiet warnings until the context is done
+func (w *activeWarnings) expireQuiet(ctx context.Context) {
+	ticker := time.NewTicker(min(w.quietPeriod, maxExpiryInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.expire()
+		}
+	}
+}
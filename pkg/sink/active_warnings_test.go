@@ -0,0 +1,127 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// activeWarningsOf returns active warnings as kind/namespace/object/reason
+func activeWarningsOf(t *testing.T, w *activeWarnings) []string {
+	metrics := make(chan prometheus.Metric, 100)
+	w.gauge.Collect(metrics)
+	close(metrics)
+	var warnings []string
+	for metric := range metrics {
+		var m dto.Metric
+		assert.NoError(t, metric.Write(&m))
+		var values []string
+		for _, label := range m.GetLabel() {
+			values = append(values, label.GetValue())
+		}
+		assert.Equal(t, float64(1), m.GetGauge().GetValue())
+		warnings = append(warnings, strings.Join(values, "/"))
+	}
+	return warnings
+}
+
+func TestActiveWarnings_ResolvedByNormalEvent(t *testing.T) {
+	warnings := newActiveWarnings("kube_test_events", &ActiveWarningsSettings{}, nil)
+	backOff := test.EventPodTracing.DeepCopy()
+	warnings.observe(backOff)
+	assert.Equal(t, []string{"Pod/tracing/test-pod/BackOff"}, activeWarningsOf(t, warnings))
+
+	started := backOff.DeepCopy()
+	started.Type = corev1.EventTypeNormal
+	started.Reason = "Started"
+	started.InvolvedObject.Name = "other-pod"
+	warnings.observe(started)
+	assert.Len(t, activeWarningsOf(t, warnings), 1, "Normal event on other object should not clear the warning")
+
+	started.InvolvedObject.Name = backOff.InvolvedObject.Name
+	warnings.observe(started)
+	assert.Empty(t, activeWarningsOf(t, warnings), "Started should clear BackOff on the same object")
+}
+
+func TestActiveWarnings_QuietPeriod(t *testing.T) {
+	now := time.Now()
+	warnings := newActiveWarnings("kube_test_events", &ActiveWarningsSettings{ResolvedBy: map[string][]string{}}, nil)
+	warnings.now = func() time.Time { return now }
+	warnings.observe(test.EventPodTracing)
+	warnings.observe(test.EventDeploymentMonitoring)
+
+	now = now.Add(10 * time.Minute)
+	warnings.observe(test.EventPodTracing)
+	now = now.Add(10 * time.Minute)
+	warnings.expire()
+	assert.Equal(t, []string{"Pod/tracing/test-pod/BackOff"}, activeWarningsOf(t, warnings), "Only warnings without repeats for quiet period should be cleared")
+
+	now = now.Add(5 * time.Minute)
+	warnings.expire()
+	assert.Empty(t, activeWarningsOf(t, warnings))
+}
+
+func TestActiveWarnings_Overflow(t *testing.T) {
+	warnings := newActiveWarnings("kube_test_events", &ActiveWarningsSettings{}, newSeriesTracker(1))
+	backOff := test.EventPodTracing.DeepCopy()
+	warnings.observe(backOff)
+	failed := test.EventDeploymentMonitoring.DeepCopy()
+	failed.Type = corev1.EventTypeWarning
+	warnings.observe(failed)
+	other := backOff.DeepCopy()
+	other.InvolvedObject.Name = "other-pod"
+	warnings.observe(other)
+	warnings.observe(other)
+
+	overflowValue := func() float64 {
+		var m dto.Metric
+		assert.NoError(t, warnings.gauge.WithLabelValues("other", "other", "other", "other").Write(&m))
+		return m.GetGauge().GetValue()
+	}
+	assert.Equal(t, float64(2), overflowValue(), "Warnings over the limit should be counted by the overflow series")
+
+	for _, warning := range []*corev1.Event{failed, other} {
+		warnings.lastWarnings[activeWarningKey{
+			namespace: warning.InvolvedObject.Namespace,
+			kind:      warning.InvolvedObject.Kind,
+			object:    warning.InvolvedObject.Name,
+			reason:    warning.Reason,
+		}].last = time.Time{}
+	}
+	started := other.DeepCopy()
+	started.Type = corev1.EventTypeNormal
+	started.Reason = "Started"
+	warnings.observe(started)
+	assert.Equal(t, float64(1), overflowValue())
+
+	warnings.expire()
+	assert.Equal(t, []string{"Pod/tracing/test-pod/BackOff"}, activeWarningsOf(t, warnings), "Overflow series should be removed with the last warning")
+}
+
+func TestInitMetricsSink_ActiveWarnings(t *testing.T) {
+	settings := json.RawMessage(`{"prefix":"kube_active_events","activeWarnings":{"quietPeriod":"1h","resolvedBy":{"BackOff":["Pulled"]}}}`)
+	testSink, err := InitMetricsSink(context.Background(), nil, &filter.Sink{Name: "metrics", Settings: settings})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, testSink.counters.activeWarnings.quietPeriod)
+
+	for _, event := range test.TestEventsSlice {
+		assert.NoError(t, testSink.Release(event))
+	}
+	assert.ElementsMatch(t, []string{
+		"Deployment/monitoring/test-pod/BackOff",
+		"PersistentVolumeClaim/monitoring/test-pvc-0/ProvisioningFailed",
+		"Pod/tracing/test-pod/BackOff",
+	}, activeWarningsOf(t, testSink.counters.activeWarnings))
+
+	_, err = InitMetricsSink(context.Background(), nil, testSinkFilters("metrics", `{"activeWarnings":{"quietPeriod":"-1m"}}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,258 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/aggregation"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	alertsAPIPath              = "/api/v2/alerts"
+	defaultAlertName           = "KubernetesEvent"
+	defaultAlertTTL            = 15 * time.Minute
+	defaultAlertRepeatInterval = time.Minute
+	defaultAlertmanagerTimeout = 10 * time.Second
+	// defaultAlertEventType selects events posted as alerts if match rules are not set
+	defaultAlertEventType = "^Warning$"
+)
+
+type AlertmanagerSettings struct {
+	// URLs of Alertmanager instances. Alerts are sent to each instance
+	URLs      []string `json:"urls"`
+	AlertName string   `json:"alertName,omitempty"`
+	// TTL is added to the time of the last repeat of the event to calculate endsAt of the alert
+	TTL metav1.Duration `json:"ttl,omitempty"`
+	// RepeatInterval is the minimal interval between re-posting of the same alert
+	RepeatInterval  metav1.Duration   `json:"repeatInterval,omitempty"`
+	ExternalLabels  map[string]string `json:"externalLabels,omitempty"`
+	GeneratorURL    string            `json:"generatorURL,omitempty"`
+	BearerTokenFile string            `json:"bearerTokenFile,omitempty"`
+	Timeout         metav1.Duration   `json:"timeout,omitempty"`
+}
+
+type AlertmanagerSink struct {
+	*Sink
+	urls           []string
+	alertName      string
+	ttl            time.Duration
+	repeatInterval time.Duration
+	externalLabels map[string]string
+	generatorURL   string
+	bearerToken    string
+	client         *http.Client
+
+	mu     sync.Mutex
+	alerts map[string]*alertState
+}
+
+type alertState struct {
+	startsAt   time.Time
+	lastPosted time.Time
+}
+
+// postableAlert is the alert representation of Alertmanager API v2
+type postableAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+func init() {
+	Register(Registration{
+		Type:     "alertmanager",
+		Settings: AlertmanagerSettings{},
+		New: func(ctx context.Context, _ *Options, filters *filter.Sink) (ISink, error) {
+			return InitAlertmanagerSink(ctx, filters)
+		},
+	})
+}
+
+func InitAlertmanagerSink(ctx context.Context, filters *filter.Sink) (*AlertmanagerSink, error) {
+	var settings AlertmanagerSettings
+	if err := DecodeSettings(filters, &settings); err != nil {
+		return nil, err
+	}
+	if len(settings.URLs) == 0 {
+		return nil, fmt.Errorf("at least one url must be configured for alertmanager sink")
+	}
+	urls := make([]string, len(settings.URLs))
+	for i, url := range settings.URLs {
+		urls[i] = strings.TrimSuffix(url, "/") + alertsAPIPath
+	}
+	var bearerToken string
+	if len(settings.BearerTokenFile) > 0 {
+		token, err := ReadSecretFile(settings.BearerTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		bearerToken = token
+	}
+	aggregation.InitAggregations()
+	// Normal events are informational, so they are posted as alerts only if match rules select them explicitly
+	if len(filters.Match) == 0 {
+		warnings := *filters
+		warnings.Match = []filter.EventMatch{{Type: defaultAlertEventType}}
+		filters = &warnings
+	}
+	alertmanagerSink := &AlertmanagerSink{
+		Sink:           NewSinkWithFilters(filters),
+		urls:           urls,
+		alertName:      ValueOrDefault(settings.AlertName, defaultAlertName),
+		ttl:            DurationOrDefault(settings.TTL, defaultAlertTTL),
+		repeatInterval: DurationOrDefault(settings.RepeatInterval, defaultAlertRepeatInterval),
+		externalLabels: settings.ExternalLabels,
+		generatorURL:   settings.GeneratorURL,
+		bearerToken:    bearerToken,
+		client:         &http.Client{Timeout: DurationOrDefault(settings.Timeout, defaultAlertmanagerTimeout)},
+		alerts:         map[string]*alertState{},
+	}
+	go alertmanagerSink.runCleanup(ctx)
+	return alertmanagerSink, nil
+}
+
+func (as *AlertmanagerSink) Release(eventObj *corev1.Event) error {
+	if !as.IsEventAllowed(eventObj) {
+		return nil
+	}
+	labels := as.alertLabels(eventObj)
+	fingerprint := alertFingerprint(labels)
+	now := time.Now()
+
+	as.mu.Lock()
+	state, ok := as.alerts[fingerprint]
+	if ok && now.Sub(state.lastPosted) < as.repeatInterval {
+		as.mu.Unlock()
+		return nil
+	}
+	startsAt := now
+	if ok && now.Before(state.lastPosted.Add(as.ttl)) {
+		startsAt = state.startsAt
+	}
+	as.mu.Unlock()
+
+	alert := postableAlert{
+		Labels: labels,
+		Annotations: map[string]string{
+			"summary":     fmt.Sprintf("%s on %s %s/%s", eventObj.Reason, eventObj.InvolvedObject.Kind, eventObj.InvolvedObject.Namespace, eventObj.InvolvedObject.Name),
+			"description": eventObj.Message,
+		},
+		StartsAt:     startsAt,
+		EndsAt:       now.Add(as.ttl),
+		GeneratorURL: as.generatorURL,
+	}
+	if err := as.post([]postableAlert{alert}); err != nil {
+		return err
+	}
+
+	as.mu.Lock()
+	as.alerts[fingerprint] = &alertState{startsAt: startsAt, lastPosted: now}
+	as.mu.Unlock()
+	return nil
+}
+
+func (as *AlertmanagerSink) alertLabels(eventObj *corev1.Event) map[string]string {
+	labels := make(map[string]string, len(as.externalLabels)+7)
+	maps.Copy(labels, as.externalLabels)
+	labels["alertname"] = as.alertName
+	labels["severity"] = strings.ToLower(eventObj.Type)
+	labels["kind"] = eventObj.InvolvedObject.Kind
+	labels["namespace"] = eventObj.InvolvedObject.Namespace
+	labels["workload"] = aggregation.GetWorkloadName(eventObj.InvolvedObject.Kind, eventObj.InvolvedObject.Name)
+	labels["reason"] = eventObj.Reason
+	labels["message"] = aggregation.GetCommonMessage(eventObj.InvolvedObject.Kind, eventObj.Reason, eventObj.Message)
+	return labels
+}
+
+// alertFingerprint returns string which uniquely identifies alert by its labels
+func alertFingerprint(labels map[string]string) string {
+	fingerprint := strings.Builder{}
+	for _, name := range slices.Sorted(maps.Keys(labels)) {
+		fingerprint.WriteString(name)
+		fingerprint.WriteByte(0)
+		fingerprint.WriteString(labels[name])
+		fingerprint.WriteByte(0)
+	}
+	return fingerprint.String()
+}
+
+// post sends alerts to each Alertmanager instance. Error is returned only if no instance accepted alerts
+func (as *AlertmanagerSink) post(alerts []postableAlert) error {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+	var joinedErr error
+	accepted := false
+	for _, url := range as.urls {
+		if err = as.postToInstance(url, body); err != nil {
+			joinedErr = errors.Join(joinedErr, err)
+			continue
+		}
+		accepted = true
+	}
+	if accepted {
+		if joinedErr != nil {
+			slog.Warn("some alertmanager instances did not accept alerts", "error", joinedErr)
+		}
+		return nil
+	}
+	return joinedErr
+}
+
+func (as *AlertmanagerSink) postToInstance(url string, body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if len(as.bearerToken) > 0 {
+		request.Header.Set("Authorization", "Bearer "+as.bearerToken)
+	}
+	resp, err := as.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("could not send alerts to alertmanager %s: %w", url, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("alertmanager %s responded with status %s", url, resp.Status)
+	}
+	return nil
+}
+
+// runCleanup periodically forgets alerts which have already been resolved by Alertmanager
+func (as *AlertmanagerSink) runCleanup(ctx context.Context) {
+	ticker := time.NewTicker(as.ttl)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			as.mu.Lock()
+			for fingerprint, state := range as.alerts {
+				if now.After(state.lastPosted.Add(as.ttl)) {
+					delete(as.alerts, fingerprint)
+				}
+			}
+			as.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// postedAlerts returns alerts posted to the receiver
+func postedAlerts(t *testing.T, receiver *fakeReceiver) []postableAlert {
+	var posted []postableAlert
+	for _, request := range receiver.received() {
+		assert.Equal(t, "/api/v2/alerts", request.path)
+		var alerts []postableAlert
+		assert.NoError(t, json.Unmarshal(request.body, &alerts))
+		posted = append(posted, alerts...)
+	}
+	return posted
+}
+
+func TestAlertmanagerSink_Release(t *testing.T) {
+	alertmanager, server := newFakeReceiver(t)
+
+	tokenFile := t.TempDir() + "/token"
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("secret\n"), 0600))
+	testSink, err := InitAlertmanagerSink(t.Context(), testSinkFilters("alertmanager", fmt.Sprintf(`{"urls":["%s/"],"ttl":"30m","externalLabels":{"cluster":"test"},"bearerTokenFile":"%s"}`, server.URL, tokenFile)))
+	assert.NoError(t, err)
+
+	before := time.Now()
+	assert.NoError(t, testSink.Release(test.EventPodTracing))
+	assert.NoError(t, testSink.Release(test.EventPodTracing))
+
+	alerts := postedAlerts(t, alertmanager)
+	assert.Equal(t, 1, len(alerts), "Repeat inside of repeat interval should not be posted")
+	alert := alerts[0]
+	assert.Equal(t, map[string]string{
+		"alertname": "KubernetesEvent",
+		"cluster":   "test",
+		"severity":  "warning",
+		"kind":      "Pod",
+		"namespace": "tracing",
+		"workload":  "test-pod",
+		"reason":    "BackOff",
+		"message":   "Back-off restarting failed container",
+	}, alert.Labels)
+	assert.Equal(t, "Back-off restarting failed container", alert.Annotations["description"])
+	assert.True(t, alert.EndsAt.Sub(before) >= 30*time.Minute)
+	assert.Equal(t, "Bearer secret", alertmanager.received()[0].header.Get("Authorization"))
+}
+
+func TestAlertmanagerSink_Release_NormalEvents(t *testing.T) {
+	alertmanager, server := newFakeReceiver(t)
+
+	testSink, err := InitAlertmanagerSink(t.Context(), testSinkFilters("alertmanager", fmt.Sprintf(`{"urls":["%s"]}`, server.URL)))
+	assert.NoError(t, err)
+	assert.NoError(t, testSink.Release(test.EventPodLogging))
+	assert.Empty(t, postedAlerts(t, alertmanager), "Normal events should not be posted without match rules")
+
+	filters := testSinkFilters("alertmanager", fmt.Sprintf(`{"urls":["%s"]}`, server.URL))
+	filters.Match = []filter.EventMatch{{Namespace: "logging"}}
+	testSink, err = InitAlertmanagerSink(t.Context(), filters)
+	assert.NoError(t, err)
+	assert.NoError(t, testSink.Release(test.EventPodLogging))
+	assert.Equal(t, 1, len(postedAlerts(t, alertmanager)), "Normal events selected by match rules should be posted")
+}
+
+func TestAlertmanagerSink_Release_RepostKeepsStartsAt(t *testing.T) {
+	alertmanager, server := newFakeReceiver(t)
+
+	testSink, err := InitAlertmanagerSink(t.Context(), testSinkFilters("alertmanager", fmt.Sprintf(`{"urls":["%s"],"repeatInterval":"1ns"}`, server.URL)))
+	assert.NoError(t, err)
+
+	assert.NoError(t, testSink.Release(test.EventPvcMonitoring))
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, testSink.Release(test.EventPvcMonitoring))
+
+	alerts := postedAlerts(t, alertmanager)
+	assert.Equal(t, 2, len(alerts))
+	assert.True(t, alerts[0].StartsAt.Equal(alerts[1].StartsAt), "Re-posted alert should keep startsAt")
+	assert.True(t, alerts[1].EndsAt.After(alerts[0].EndsAt), "Re-posted alert should extend endsAt")
+}
+
+func TestAlertmanagerSink_Release_Errors(t *testing.T) {
+	alertmanager, server := newFakeReceiver(t)
+	failed, failedServer := newFakeReceiver(t)
+	failed.respond = func(w http.ResponseWriter, _ receivedRequest) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	testSink, err := InitAlertmanagerSink(t.Context(), testSinkFilters("alertmanager", fmt.Sprintf(`{"urls":["%s","%s"]}`, failedServer.URL, server.URL)))
+	assert.NoError(t, err)
+	assert.NoError(t, testSink.Release(test.EventPodTracing), "Alert accepted by one of instances should not be retried")
+	assert.Equal(t, 1, len(postedAlerts(t, alertmanager)))
+
+	testSink, err = InitAlertmanagerSink(t.Context(), testSinkFilters("alertmanager", fmt.Sprintf(`{"urls":["%s"]}`, failedServer.URL)))
+	assert.NoError(t, err)
+	assert.Error(t, testSink.Release(test.EventPodTracing))
+	assert.Equal(t, 0, len(testSink.alerts))
+
+	_, err = InitAlertmanagerSink(t.Context(), testSinkFilters("alertmanager", `{}`))
+	assert.Error(t, err)
+}
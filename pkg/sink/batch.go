@@ -0,0 +1,135 @@
+package sink
+
+import (
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// BatchSink is implemented by sinks that send several events with one call. The controller passes events to such sinks
+// through Batcher instead of calling Release for each event
+type BatchSink interface {
+	ISink
+	// BatchOptions returns limits of batches of the sink
+	BatchOptions() BatchOptions
+	// ReleaseBatch sends allowed events and returns an error for each event in the same order. The error is nil
+	// if the event is sent. Nil slice means all events are sent
+	ReleaseBatch(events []*corev1.Event) []error
+}
+
+// BatchOptions limits batches gathered by Batcher. The batch is sent when any limit is reached
+type BatchOptions struct {
+	// MaxEvents is the maximum number of events in one batch. One event is sent per batch if it is not set
+	MaxEvents int
+	// MaxBytes is the maximum approximate size of events in one batch. Size is not limited if it is not set
+	MaxBytes int
+	// Linger is the maximum time the first event of the batch waits for other events
+	Linger time.Duration
+}
+
+type batchItem struct {
+	event *corev1.Event
+	done  func(error)
+}
+
+// Batcher gathers events of BatchSink by count, size and linger time and sends them with one call.
+// The result of each event is reported by callback, so the caller does not wait for the batch to be gathered
+type Batcher struct {
+	sink    BatchSink
+	options BatchOptions
+
+	mu    sync.Mutex
+	items []batchItem
+	bytes int
+	// generation is incremented each time the batch is taken, so the timer of the sent batch does not flush the next one
+	generation uint64
+	timer      *time.Timer
+}
+
+func NewBatcher(sink BatchSink) *Batcher {
+	options := sink.BatchOptions()
+	options.MaxEvents = IntOrDefault(options.MaxEvents, 1)
+	return &Batcher{sink: sink, options: options}
+}
+
+// Add adds a copy of the event to the current batch. Events not allowed by filters of the sink are skipped.
+// A full batch is sent in the calling goroutine, so callers are slowed down if the sink does not keep up.
+// Not full batch is sent after linger time in a separate goroutine
+func (b *Batcher) Add(eventObj *corev1.Event, done func(error)) {
+	if !b.sink.IsEventAllowed(eventObj) {
+		done(nil)
+		return
+	}
+	item := batchItem{event: eventObj.DeepCopy(), done: done}
+	size := item.event.Size()
+
+	b.mu.Lock()
+	var batches [][]batchItem
+	if len(b.items) > 0 && b.options.MaxBytes > 0 && b.bytes+size > b.options.MaxBytes {
+		batches = append(batches, b.take())
+	}
+	b.items = append(b.items, item)
+	b.bytes += size
+	if len(b.items) >= b.options.MaxEvents || (b.options.MaxBytes > 0 && b.bytes >= b.options.MaxBytes) {
+		batches = append(batches, b.take())
+	} else if len(b.items) == 1 {
+		generation := b.generation
+		b.timer = time.AfterFunc(b.options.Linger, func() { b.flushGeneration(generation) })
+	}
+	b.mu.Unlock()
+
+	for _, batch := range batches {
+		b.send(batch)
+	}
+}
+
+// Flush sends the current batch immediately
+func (b *Batcher) Flush() {
+	b.mu.Lock()
+	batch := b.take()
+	b.mu.Unlock()
+	b.send(batch)
+}
+
+func (b *Batcher) flushGeneration(generation uint64) {
+	b.mu.Lock()
+	if generation != b.generation {
+		b.mu.Unlock()
+		return
+	}
+	batch := b.take()
+	b.mu.Unlock()
+	b.send(batch)
+}
+
+// take returns the current batch and starts the next one. It must be called with the lock held
+func (b *Batcher) take() []batchItem {
+	batch := b.items
+	b.items = nil
+	b.bytes = 0
+	b.generation++
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	return batch
+}
+
+func (b *Batcher) send(batch []batchItem) {
+	if len(batch) == 0 {
+		return
+	}
+	events := make([]*corev1.Event, len(batch))
+	for i, item := range batch {
+		events[i] = item.event
+	}
+	errs := b.sink.ReleaseBatch(events)
+	for i, item := range batch {
+		var err error
+		if i < len(errs) {
+			err = errs[i]
+		}
+		item.done(err)
+	}
+}
@@ -0,0 +1,138 @@
+package sink
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// fakeBatchSink records sent batches and fails events from namespaces listed in failedNamespaces
+type fakeBatchSink struct {
+	*Sink
+	options          BatchOptions
+	failedNamespaces []string
+
+	mu      sync.Mutex
+	batches [][]*corev1.Event
+}
+
+func (fs *fakeBatchSink) Release(eventObj *corev1.Event) error {
+	return fs.ReleaseBatch([]*corev1.Event{eventObj})[0]
+}
+
+func (fs *fakeBatchSink) BatchOptions() BatchOptions {
+	return fs.options
+}
+
+func (fs *fakeBatchSink) ReleaseBatch(events []*corev1.Event) []error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.batches = append(fs.batches, events)
+	errs := make([]error, len(events))
+	for i, eventObj := range events {
+		for _, namespace := range fs.failedNamespaces {
+			if eventObj.InvolvedObject.Namespace == namespace {
+				errs[i] = errors.New("failed")
+			}
+		}
+	}
+	return errs
+}
+
+func (fs *fakeBatchSink) batchSizes() []int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var sizes []int
+	for _, batch := range fs.batches {
+		sizes = append(sizes, len(batch))
+	}
+	return sizes
+}
+
+// results collects errors reported by Batcher for each event
+type results struct {
+	mu   sync.Mutex
+	errs map[string]error
+}
+
+func (r *results) done(eventObj *corev1.Event) func(error) {
+	return func(err error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.errs[eventObj.InvolvedObject.Namespace+"/"+eventObj.InvolvedObject.Kind] = err
+	}
+}
+
+func (r *results) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.errs)
+}
+
+func TestBatcher_MaxEvents(t *testing.T) {
+	testSink := &fakeBatchSink{Sink: &Sink{}, options: BatchOptions{MaxEvents: 2, Linger: time.Hour}, failedNamespaces: []string{"tracing"}}
+	batcher := NewBatcher(testSink)
+	res := &results{errs: map[string]error{}}
+	for _, event := range test.TestEventsSlice {
+		batcher.Add(event, res.done(event))
+	}
+
+	assert.Equal(t, []int{2, 2}, testSink.batchSizes())
+	assert.Equal(t, 4, res.len())
+	assert.NoError(t, res.errs["logging/Pod"])
+	assert.Error(t, res.errs["tracing/Pod"])
+	assert.NoError(t, res.errs["monitoring/Deployment"])
+	assert.NoError(t, res.errs["monitoring/PersistentVolumeClaim"])
+	assert.NotSame(t, test.EventPodLogging, testSink.batches[0][0], "Batcher should keep a copy of the event")
+}
+
+func TestBatcher_MaxBytes(t *testing.T) {
+	maxSize := 0
+	for _, event := range test.TestEventsSlice {
+		maxSize = max(maxSize, event.Size())
+	}
+	// Each event fits into the batch, but two events do not
+	testSink := &fakeBatchSink{Sink: &Sink{}, options: BatchOptions{MaxEvents: 100, MaxBytes: maxSize + 1, Linger: time.Hour}}
+	batcher := NewBatcher(testSink)
+	res := &results{errs: map[string]error{}}
+	for _, event := range test.TestEventsSlice {
+		batcher.Add(event, res.done(event))
+	}
+	assert.Equal(t, []int{1, 1, 1}, testSink.batchSizes(), "Event should not be added to the batch if it exceeds the size")
+
+	batcher.Flush()
+	assert.Equal(t, []int{1, 1, 1, 1}, testSink.batchSizes())
+	assert.Equal(t, 4, res.len())
+}
+
+func TestBatcher_Linger(t *testing.T) {
+	testSink := &fakeBatchSink{Sink: &Sink{}, options: BatchOptions{MaxEvents: 100, Linger: 50 * time.Millisecond}}
+	batcher := NewBatcher(testSink)
+	res := &results{errs: map[string]error{}}
+	for _, event := range test.TestEventsSlice[:3] {
+		batcher.Add(event, res.done(event))
+	}
+	assert.Empty(t, testSink.batchSizes())
+
+	assert.Eventually(t, func() bool { return res.len() == 3 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int{3}, testSink.batchSizes())
+}
+
+func TestBatcher_NotAllowedEvents(t *testing.T) {
+	testSink := &fakeBatchSink{Sink: NewSinkWithFilters(&filter.Sink{Match: []filter.EventMatch{{Type: "Warning"}}}), options: BatchOptions{MaxEvents: 100, Linger: time.Hour}}
+	batcher := NewBatcher(testSink)
+	res := &results{errs: map[string]error{}}
+	batcher.Add(test.EventPodLogging, res.done(test.EventPodLogging))
+	assert.Equal(t, 1, res.len(), "Not allowed event should be reported immediately")
+
+	batcher.Add(test.EventPodTracing, res.done(test.EventPodTracing))
+	batcher.Flush()
+	assert.Equal(t, []int{1}, testSink.batchSizes())
+	assert.Equal(t, "tracing", testSink.batches[0][0].InvolvedObject.Namespace)
+}
@@ -0,0 +1,372 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/aggregation"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/format"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	platformSlack      = "slack"
+	platformTeams      = "teams"
+	platformMattermost = "mattermost"
+
+	digestWindow       = time.Minute
+	maxDigestLines     = 20
+	defaultChatTimeout = 10 * time.Second
+	// chatMaxRetries is the number of retries of the message failed to post to one webhook
+	chatMaxRetries          = 3
+	initialChatRetryBackoff = time.Second
+)
+
+var defaultChatTemplates = map[string]string{
+	platformSlack:      "*{{.Type}}: {{.Reason}}* on {{.InvolvedObject.Kind}} `{{.InvolvedObject.Namespace}}/{{.InvolvedObject.Name}}`\n{{.Message}}",
+	platformMattermost: "**{{.Type}}: {{.Reason}}** on {{.InvolvedObject.Kind}} `{{.InvolvedObject.Namespace}}/{{.InvolvedObject.Name}}`\n{{.Message}}",
+	platformTeams:      "**{{.Type}}: {{.Reason}}** on {{.InvolvedObject.Kind}} {{.InvolvedObject.Namespace}}/{{.InvolvedObject.Name}}\n\n{{.Message}}",
+}
+
+type ChatSettings struct {
+	Webhooks []ChatWebhook `json:"webhooks"`
+	// Cooldown is the period during which repeated notifications about the same problem are suppressed
+	Cooldown metav1.Duration `json:"cooldown,omitempty"`
+	// DigestThreshold is the number of notifications per minute after which notifications are grouped into a digest
+	DigestThreshold int             `json:"digestThreshold,omitempty"`
+	Timeout         metav1.Duration `json:"timeout,omitempty"`
+}
+
+type ChatWebhook struct {
+	Platform string `json:"platform"`
+	URL      string `json:"url,omitempty"`
+	URLFile  string `json:"urlFile,omitempty"`
+	Template string `json:"template,omitempty"`
+}
+
+type chatWebhook struct {
+	platform string
+	url      string
+	template *template.Template
+}
+
+type ChatSink struct {
+	*Sink
+	webhooks        []*chatWebhook
+	client          *http.Client
+	cooldown        time.Duration
+	digestThreshold int
+	retryBackoff    time.Duration
+
+	// ctx is cancelled when the sink is closed, so posting in progress is aborted
+	ctx    context.Context
+	cancel context.CancelFunc
+	// stop is closed by Close to stop sending of digests, done is closed when it is stopped
+	stop chan struct{}
+	done chan struct{}
+	// posting counts retries in progress
+	posting sync.WaitGroup
+
+	mu           sync.Mutex
+	lastSent     map[string]time.Time
+	sentInWindow int
+	digest       map[string]int
+	// retries are timers of messages waiting for the retry, it is nil when the sink is closed
+	retries map[*time.Timer]struct{}
+}
+
+func init() {
+	Register(Registration{
+		Type:     "chat",
+		Settings: ChatSettings{},
+		New: func(_ context.Context, _ *Options, filters *filter.Sink) (ISink, error) {
+			return InitChatSink(filters)
+		},
+	})
+}
+
+func InitChatSink(filters *filter.Sink) (*ChatSink, error) {
+	var settings ChatSettings
+	if err := DecodeSettings(filters, &settings); err != nil {
+		return nil, err
+	}
+	if len(settings.Webhooks) == 0 {
+		return nil, fmt.Errorf("at least one webhook must be configured for chat sink")
+	}
+	webhooks := make([]*chatWebhook, len(settings.Webhooks))
+	for i, w := range settings.Webhooks {
+		webhook, err := newChatWebhook(w)
+		if err != nil {
+			return nil, err
+		}
+		webhooks[i] = webhook
+	}
+	aggregation.InitAggregations()
+	ctx, cancel := context.WithCancel(context.Background())
+	chatSink := &ChatSink{
+		Sink:            NewSinkWithFilters(filters),
+		webhooks:        webhooks,
+		client:          &http.Client{Timeout: DurationOrDefault(settings.Timeout, defaultChatTimeout)},
+		cooldown:        settings.Cooldown.Duration,
+		digestThreshold: settings.DigestThreshold,
+		retryBackoff:    initialChatRetryBackoff,
+		lastSent:        map[string]time.Time{},
+		digest:          map[string]int{},
+		retries:         map[*time.Timer]struct{}{},
+		ctx:             ctx,
+		cancel:          cancel,
+		stop:            make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+	go chatSink.runDigest()
+	return chatSink, nil
+}
+
+func newChatWebhook(settings ChatWebhook) (*chatWebhook, error) {
+	platform := strings.ToLower(settings.Platform)
+	text, ok := defaultChatTemplates[platform]
+	if !ok {
+		return nil, fmt.Errorf("chat platform is not supported: %s", settings.Platform)
+	}
+	url := settings.URL
+	if len(settings.URLFile) > 0 {
+		fileURL, err := ReadSecretFile(settings.URLFile)
+		if err != nil {
+			return nil, err
+		}
+		url = fileURL
+	}
+	if len(url) == 0 {
+		return nil, fmt.Errorf("webhook url is not set for chat platform %s", platform)
+	}
+	if len(strings.TrimSpace(settings.Template)) > 0 {
+		text = settings.Template
+	}
+	t, err := format.ParseEventTemplate(platform, text)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse template for chat platform %s: %w", platform, err)
+	}
+	return &chatWebhook{platform: platform, url: url, template: t}, nil
+}
+
+// Release posts the notification to all webhooks. The cooldown starts before posting, so concurrent repeats of the
+// event are suppressed. Errors are not returned, because the event must not be re-posted to webhooks which accepted it.
+// Failed webhooks are retried in background instead
+func (cs *ChatSink) Release(eventObj *corev1.Event) error {
+	if !cs.IsEventAllowed(eventObj) {
+		return nil
+	}
+	key := chatDedupKey(eventObj)
+	now := time.Now()
+
+	cs.mu.Lock()
+	if last, ok := cs.lastSent[key]; ok && cs.cooldown > 0 && now.Sub(last) < cs.cooldown {
+		cs.mu.Unlock()
+		return nil
+	}
+	cs.lastSent[key] = now
+	if cs.digestThreshold > 0 && cs.sentInWindow >= cs.digestThreshold {
+		cs.digest[key]++
+		cs.mu.Unlock()
+		return nil
+	}
+	cs.sentInWindow++
+	cs.mu.Unlock()
+
+	for _, w := range cs.webhooks {
+		text := strings.Builder{}
+		if err := w.template.Execute(&text, eventObj); err != nil {
+			slog.Error("could not execute template for chat platform", "platform", w.platform, "error", err)
+			continue
+		}
+		cs.postWithRetries(w, text.String(), 0)
+	}
+	return nil
+}
+
+// postWithRetries posts the message to the webhook and schedules the retry with exponential backoff if it fails
+func (cs *ChatSink) postWithRetries(w *chatWebhook, text string, retries int) {
+	err := cs.post(w, text)
+	if err == nil {
+		return
+	}
+	if retries >= chatMaxRetries {
+		slog.Error("dropping chat message after failed attempts to post it", "platform", w.platform, "error", err)
+		return
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.retries == nil {
+		slog.Error("dropping chat message failed to post on shutdown", "platform", w.platform, "error", err)
+		return
+	}
+	slog.Warn("could not post chat message, it will be retried", "platform", w.platform, "retries", retries, "error", err)
+	var timer *time.Timer
+	timer = time.AfterFunc(cs.retryBackoff<<retries, func() {
+		cs.mu.Lock()
+		_, scheduled := cs.retries[timer]
+		delete(cs.retries, timer)
+		if scheduled {
+			cs.posting.Add(1)
+		}
+		cs.mu.Unlock()
+		if !scheduled {
+			return
+		}
+		defer cs.posting.Done()
+		cs.postWithRetries(w, text, retries+1)
+	})
+	cs.retries[timer] = struct{}{}
+}
+
+// Close sends the last digest, drops messages waiting for the retry and waits for retries in progress.
+// Posting is aborted when the context is done
+func (cs *ChatSink) Close(ctx context.Context) error {
+	defer cs.cancel()
+	stop := context.AfterFunc(ctx, cs.cancel)
+	defer stop()
+	cs.mu.Lock()
+	for timer := range cs.retries {
+		timer.Stop()
+	}
+	if len(cs.retries) > 0 {
+		slog.Error("dropping chat messages waiting for the retry on shutdown", "messages", len(cs.retries))
+	}
+	cs.retries = nil
+	cs.mu.Unlock()
+	close(cs.stop)
+	<-cs.done
+	cs.flushDigest()
+	cs.posting.Wait()
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("chat messages are not sent: %w", err)
+	}
+	return nil
+}
+
+// chatDedupKey builds the key for suppressing repeated notifications
+// from namespace, involved object and aggregated message of the event
+func chatDedupKey(eventObj *corev1.Event) string {
+	message := aggregation.GetCommonMessage(eventObj.InvolvedObject.Kind, eventObj.Reason, eventObj.Message)
+	return strings.Join([]string{eventObj.InvolvedObject.Namespace, eventObj.InvolvedObject.Kind, eventObj.InvolvedObject.Name, message}, "/")
+}
+
+// runDigest resets the notifications counter every minute and sends grouped notifications until the sink is closed
+func (cs *ChatSink) runDigest() {
+	defer close(cs.done)
+	ticker := time.NewTicker(digestWindow)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cs.stop:
+			return
+		case <-ticker.C:
+			cs.flushDigest()
+		}
+	}
+}
+
+func (cs *ChatSink) flushDigest() {
+	cs.mu.Lock()
+	cs.sentInWindow = 0
+	digest := cs.digest
+	cs.digest = map[string]int{}
+	cs.pruneLastSent(time.Now())
+	cs.mu.Unlock()
+
+	if len(digest) == 0 {
+		return
+	}
+	text := formatDigest(digest)
+	for _, w := range cs.webhooks {
+		if err := cs.post(w, text); err != nil {
+			slog.Error("could not send digest to chat", "platform", w.platform, "error", err)
+		}
+	}
+}
+
+// pruneLastSent removes entries with expired cooldown. It must be called with locked mutex
+func (cs *ChatSink) pruneLastSent(now time.Time) {
+	for key, last := range cs.lastSent {
+		if now.Sub(last) >= cs.cooldown {
+			delete(cs.lastSent, key)
+		}
+	}
+}
+
+func formatDigest(digest map[string]int) string {
+	keys := make([]string, 0, len(digest))
+	total := 0
+	for key, count := range digest {
+		keys = append(keys, key)
+		total += count
+	}
+	sort.Strings(keys)
+	text := strings.Builder{}
+	fmt.Fprintf(&text, "%d more Kubernetes events in the last minute:", total)
+	for i, key := range keys {
+		if i == maxDigestLines {
+			fmt.Fprintf(&text, "\n... and %d more", len(keys)-maxDigestLines)
+			break
+		}
+		fmt.Fprintf(&text, "\n%s (x%d)", key, digest[key])
+	}
+	return text.String()
+}
+
+func (cs *ChatSink) post(w *chatWebhook, text string) error {
+	body, err := json.Marshal(chatPayload(w.platform, text))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(cs.ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	resp, err := cs.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("could not send message to chat platform %s: %w", w.platform, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("chat platform %s responded with status %s", w.platform, resp.Status)
+	}
+	return nil
+}
+
+// chatPayload wraps text into the webhook payload expected by the platform
+func chatPayload(platform string, text string) any {
+	if platform == platformTeams {
+		return map[string]any{
+			"type": "message",
+			"attachments": []map[string]any{{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]any{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body": []map[string]any{{
+						"type": "TextBlock",
+						"text": text,
+						"wrap": true,
+					}},
+				},
+			}},
+		}
+	}
+	return map[string]string{"text": text}
+}
@@ -0,0 +1,123 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatSink_Release_SlackWithCooldown(t *testing.T) {
+	webhook, server := newFakeReceiver(t)
+
+	testSink, err := InitChatSink(testSinkFilters("chat", fmt.Sprintf(`{"cooldown":"10m","webhooks":[{"platform":"slack","url":"%s"}]}`, server.URL)))
+	assert.NoError(t, err)
+
+	assert.NoError(t, testSink.Release(test.EventPodTracing))
+	assert.NoError(t, testSink.Release(test.EventPodTracing))
+	assert.NoError(t, testSink.Release(test.EventPvcMonitoring))
+
+	assert.Equal(t, 2, len(webhook.bodies()), "Repeated event should be suppressed during cooldown")
+	var payload map[string]string
+	assert.NoError(t, json.Unmarshal(webhook.received()[0].body, &payload))
+	assert.Equal(t, "*Warning: BackOff* on Pod `tracing/test-pod`\nBack-off restarting failed container", payload["text"])
+}
+
+func TestChatSink_Release_TeamsCustomTemplate(t *testing.T) {
+	webhook, server := newFakeReceiver(t)
+
+	testSink, err := InitChatSink(testSinkFilters("chat", fmt.Sprintf(`{"webhooks":[{"platform":"teams","url":"%s","template":"{{.Reason}} {{.InvolvedObject.Name}}"}]}`, server.URL)))
+	assert.NoError(t, err)
+
+	assert.NoError(t, testSink.Release(test.EventPodTracing))
+	messages := webhook.bodies()
+	assert.Equal(t, 1, len(messages))
+	assert.True(t, strings.Contains(messages[0], `"contentType":"application/vnd.microsoft.card.adaptive"`))
+	assert.True(t, strings.Contains(messages[0], `"text":"BackOff test-pod"`))
+}
+
+func TestChatSink_Release_Digest(t *testing.T) {
+	webhook, server := newFakeReceiver(t)
+
+	testSink, err := InitChatSink(testSinkFilters("chat", fmt.Sprintf(`{"digestThreshold":1,"webhooks":[{"platform":"mattermost","url":"%s"}]}`, server.URL)))
+	assert.NoError(t, err)
+
+	for _, event := range test.TestEventsSlice {
+		assert.NoError(t, testSink.Release(event))
+	}
+	assert.Equal(t, 1, len(webhook.bodies()), "Only threshold number of messages should be sent in a minute")
+
+	testSink.flushDigest()
+	messages := webhook.bodies()
+	assert.Equal(t, 2, len(messages))
+	assert.True(t, strings.Contains(messages[1], "3 more Kubernetes events in the last minute"))
+	assert.True(t, strings.Contains(messages[1], "monitoring/PersistentVolumeClaim/test-pvc-0/storageclass not found (x1)"))
+}
+
+func TestChatSink_Release_RetriesFailedWebhook(t *testing.T) {
+	webhook, server := newFakeReceiver(t)
+	failed, failedServer := newFakeReceiver(t)
+	failed.failures = 2
+
+	testSink, err := InitChatSink(testSinkFilters("chat", fmt.Sprintf(`{"cooldown":"10m","webhooks":[{"platform":"slack","url":"%s"},{"platform":"slack","url":"%s"}]}`, server.URL, failedServer.URL)))
+	assert.NoError(t, err)
+	testSink.retryBackoff = time.Millisecond
+	assert.NoError(t, testSink.Release(test.EventPodTracing), "Failed webhook should not re-queue the event")
+	assert.Eventually(t, func() bool { return len(failed.received()) == 3 }, 5*time.Second, time.Millisecond, "Failed webhook should be retried")
+	assert.Equal(t, 1, len(webhook.bodies()), "Message should not be re-posted to webhook which accepted it")
+	assert.NoError(t, testSink.Release(test.EventPodTracing))
+	assert.Equal(t, 3, len(failed.received()), "Cooldown should start even if the webhook failed")
+}
+
+func TestChatSink_Close(t *testing.T) {
+	webhook, server := newFakeReceiver(t)
+	failed, failedServer := newFakeReceiver(t)
+	failed.failures = 1
+
+	testSink, err := InitChatSink(testSinkFilters("chat", fmt.Sprintf(`{"digestThreshold":1,"webhooks":[{"platform":"slack","url":"%s"},{"platform":"slack","url":"%s"}]}`, server.URL, failedServer.URL)))
+	assert.NoError(t, err)
+	testSink.retryBackoff = time.Hour
+	for _, event := range test.TestEventsSlice {
+		assert.NoError(t, testSink.Release(event))
+	}
+	assert.NoError(t, testSink.Close(t.Context()))
+
+	messages := webhook.bodies()
+	assert.Equal(t, 2, len(messages), "Digest should be sent when the sink is closed")
+	assert.True(t, strings.Contains(messages[1], "3 more Kubernetes events in the last minute"))
+	assert.Equal(t, 2, len(failed.received()), "Message waiting for the retry should be dropped when the sink is closed")
+	testSink.mu.Lock()
+	defer testSink.mu.Unlock()
+	assert.Nil(t, testSink.retries)
+}
+
+func TestChatSink_Release_ConcurrentRepeats(t *testing.T) {
+	webhook, server := newFakeReceiver(t)
+
+	testSink, err := InitChatSink(testSinkFilters("chat", fmt.Sprintf(`{"cooldown":"10m","webhooks":[{"platform":"slack","url":"%s"}]}`, server.URL)))
+	assert.NoError(t, err)
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			assert.NoError(t, testSink.Release(test.EventPodTracing))
+		})
+	}
+	wg.Wait()
+	assert.Equal(t, 1, len(webhook.bodies()), "Concurrent repeats should be suppressed by cooldown")
+}
+
+func TestInitChatSink_InvalidSettings(t *testing.T) {
+	_, err := InitChatSink(testSinkFilters("chat", `{}`))
+	assert.Error(t, err)
+	_, err = InitChatSink(testSinkFilters("chat", `{"webhooks":[{"platform":"irc","url":"http://localhost"}]}`))
+	assert.Error(t, err)
+	_, err = InitChatSink(testSinkFilters("chat", `{"webhooks":[{"platform":"slack"}]}`))
+	assert.Error(t, err)
+	_, err = InitChatSink(testSinkFilters("chat", `{"unknown":true}`))
+	assert.Error(t, err)
+}
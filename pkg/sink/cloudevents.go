@@ -0,0 +1,212 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/format"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	cloudEventsModeBinary     = "binary"
+	cloudEventsModeStructured = "structured"
+	cloudEventsModeBatched    = "batched"
+
+	defaultCloudEventsTimeout    = 10 * time.Second
+	defaultCloudEventsBatchSize  = 100
+	defaultCloudEventsBatchBytes = 1024 * 1024
+	defaultCloudEventsLinger     = time.Second
+)
+
+type CloudEventsSettings struct {
+	URL string `json:"url"`
+	// Mode is HTTP content mode of CloudEvents: binary, structured or batched
+	Mode            string            `json:"mode,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	BearerTokenFile string            `json:"bearerTokenFile,omitempty"`
+	Timeout         metav1.Duration   `json:"timeout,omitempty"`
+	// BatchSize, BatchBytes and Linger limit batches in batched mode
+	BatchSize  int             `json:"batchSize,omitempty"`
+	BatchBytes int             `json:"batchBytes,omitempty"`
+	Linger     metav1.Duration `json:"linger,omitempty"`
+}
+
+type CloudEventsSink struct {
+	*Sink
+	url         string
+	mode        string
+	headers     map[string]string
+	bearerToken string
+	client      *http.Client
+	batch       BatchOptions
+}
+
+func init() {
+	Register(Registration{
+		Type:     "cloudevents",
+		Settings: CloudEventsSettings{},
+		New: func(_ context.Context, _ *Options, filters *filter.Sink) (ISink, error) {
+			return InitCloudEventsSink(filters)
+		},
+	})
+}
+
+func InitCloudEventsSink(filters *filter.Sink) (*CloudEventsSink, error) {
+	var settings CloudEventsSettings
+	if err := DecodeSettings(filters, &settings); err != nil {
+		return nil, err
+	}
+	if len(settings.URL) == 0 {
+		return nil, fmt.Errorf("url must be configured for cloudevents sink")
+	}
+	mode := strings.ToLower(ValueOrDefault(settings.Mode, cloudEventsModeBinary))
+	if mode != cloudEventsModeBinary && mode != cloudEventsModeStructured && mode != cloudEventsModeBatched {
+		return nil, fmt.Errorf("cloudevents mode is not supported: %s", settings.Mode)
+	}
+	var bearerToken string
+	if len(settings.BearerTokenFile) > 0 {
+		token, err := ReadSecretFile(settings.BearerTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		bearerToken = token
+	}
+	// Each event is sent by separate request in binary and structured modes
+	batch := BatchOptions{MaxEvents: 1}
+	if mode == cloudEventsModeBatched {
+		batch = BatchOptions{
+			MaxEvents: IntOrDefault(settings.BatchSize, defaultCloudEventsBatchSize),
+			MaxBytes:  IntOrDefault(settings.BatchBytes, defaultCloudEventsBatchBytes),
+			Linger:    DurationOrDefault(settings.Linger, defaultCloudEventsLinger),
+		}
+	}
+	return &CloudEventsSink{
+		Sink:        NewSinkWithFilters(filters),
+		url:         settings.URL,
+		mode:        mode,
+		headers:     settings.Headers,
+		bearerToken: bearerToken,
+		client:      &http.Client{Timeout: DurationOrDefault(settings.Timeout, defaultCloudEventsTimeout)},
+		batch:       batch,
+	}, nil
+}
+
+func (cs *CloudEventsSink) Release(eventObj *corev1.Event) error {
+	if !cs.IsEventAllowed(eventObj) {
+		return nil
+	}
+	return cs.ReleaseBatch([]*corev1.Event{eventObj})[0]
+}
+
+func (cs *CloudEventsSink) BatchOptions() BatchOptions {
+	return cs.batch
+}
+
+// ReleaseBatch sends events with one request in batched mode. In other modes events are sent one by one
+func (cs *CloudEventsSink) ReleaseBatch(events []*corev1.Event) []error {
+	errs := make([]error, len(events))
+	if cs.mode != cloudEventsModeBatched {
+		for i, eventObj := range events {
+			request, err := cs.newRequest(format.NewCloudEvent(eventObj))
+			if err == nil {
+				err = cs.send(request)
+			}
+			errs[i] = err
+		}
+		return errs
+	}
+	cloudEvents := make([]*format.CloudEvent, len(events))
+	for i, eventObj := range events {
+		cloudEvents[i] = format.NewCloudEvent(eventObj)
+	}
+	request, err := cs.newBatchRequest(cloudEvents)
+	if err == nil {
+		err = cs.send(request)
+	}
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+func (cs *CloudEventsSink) send(request *http.Request) error {
+	resp, err := cs.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("could not send cloud event to %s: %w", cs.url, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("cloud events receiver %s responded with status %s", cs.url, resp.Status)
+	}
+	return nil
+}
+
+// newBatchRequest creates HTTP request with cloud events encoded as JSON array in batched content mode
+func (cs *CloudEventsSink) newBatchRequest(cloudEvents []*format.CloudEvent) (*http.Request, error) {
+	body, err := json.Marshal(cloudEvents)
+	if err != nil {
+		return nil, err
+	}
+	request, err := cs.newPostRequest(body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/cloudevents-batch+json; charset=utf-8")
+	return request, nil
+}
+
+func (cs *CloudEventsSink) newPostRequest(body []byte) (*http.Request, error) {
+	request, err := http.NewRequest(http.MethodPost, cs.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range cs.headers {
+		request.Header.Set(name, value)
+	}
+	if len(cs.bearerToken) > 0 {
+		request.Header.Set("Authorization", "Bearer "+cs.bearerToken)
+	}
+	return request, nil
+}
+
+// newRequest creates HTTP request with cloud event encoded according to the content mode
+func (cs *CloudEventsSink) newRequest(cloudEvent *format.CloudEvent) (*http.Request, error) {
+	var body []byte
+	var err error
+	if cs.mode == cloudEventsModeStructured {
+		body, err = json.Marshal(cloudEvent)
+	} else {
+		body, err = json.Marshal(cloudEvent.Data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	request, err := cs.newPostRequest(body)
+	if err != nil {
+		return nil, err
+	}
+	if cs.mode == cloudEventsModeStructured {
+		request.Header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+		return request, nil
+	}
+	request.Header.Set("Content-Type", cloudEvent.DataContentType)
+	request.Header.Set("ce-specversion", cloudEvent.SpecVersion)
+	request.Header.Set("ce-id", cloudEvent.ID)
+	request.Header.Set("ce-source", cloudEvent.Source)
+	request.Header.Set("ce-type", cloudEvent.Type)
+	request.Header.Set("ce-subject", cloudEvent.Subject)
+	if cloudEvent.Time != nil {
+		request.Header.Set("ce-time", cloudEvent.Time.UTC().Format(time.RFC3339Nano))
+	}
+	return request, nil
+}
@@ -0,0 +1,106 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestCloudEventsSink_Release_Binary(t *testing.T) {
+	receiver, server := newFakeReceiver(t)
+	receiver.respond = func(w http.ResponseWriter, _ receivedRequest) {
+		w.WriteHeader(http.StatusAccepted)
+	}
+
+	testSink, err := InitCloudEventsSink(testSinkFilters("cloudevents", fmt.Sprintf(`{"url":"%s","headers":{"X-Tenant":"events"}}`, server.URL)))
+	assert.NoError(t, err)
+	assert.NoError(t, testSink.Release(test.EventPodTracing))
+
+	header := receiver.received()[0].header
+	assert.Equal(t, "1.0", header.Get("ce-specversion"))
+	assert.Equal(t, "io.k8s.event.warning.BackOff", header.Get("ce-type"))
+	assert.Equal(t, "/namespaces/tracing", header.Get("ce-source"))
+	assert.Equal(t, "Pod/test-pod", header.Get("ce-subject"))
+	assert.NotEmpty(t, header.Get("ce-time"))
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Equal(t, "events", header.Get("X-Tenant"))
+
+	var data corev1.Event
+	assert.NoError(t, json.Unmarshal(receiver.received()[0].body, &data))
+	assert.Equal(t, test.EventPodTracing.Message, data.Message)
+}
+
+func TestCloudEventsSink_Release_Structured(t *testing.T) {
+	receiver, server := newFakeReceiver(t)
+
+	testSink, err := InitCloudEventsSink(testSinkFilters("cloudevents", fmt.Sprintf(`{"url":"%s","mode":"structured"}`, server.URL)))
+	assert.NoError(t, err)
+	assert.NoError(t, testSink.Release(test.EventPvcMonitoring))
+
+	request := receiver.received()[0]
+	var cloudEvent map[string]any
+	assert.NoError(t, json.Unmarshal(request.body, &cloudEvent))
+	assert.Equal(t, "application/cloudevents+json; charset=utf-8", request.header.Get("Content-Type"))
+	assert.Equal(t, "1.0", cloudEvent["specversion"])
+	assert.Equal(t, "io.k8s.event.warning.ProvisioningFailed", cloudEvent["type"])
+	assert.Equal(t, "PersistentVolumeClaim/test-pvc-0", cloudEvent["subject"])
+	assert.NotNil(t, cloudEvent["data"])
+}
+
+func TestCloudEventsSink_Release_Error(t *testing.T) {
+	receiver, server := newFakeReceiver(t)
+	receiver.respond = func(w http.ResponseWriter, _ receivedRequest) {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	testSink, err := InitCloudEventsSink(testSinkFilters("cloudevents", fmt.Sprintf(`{"url":"%s"}`, server.URL)))
+	assert.NoError(t, err)
+	assert.Error(t, testSink.Release(test.EventPodTracing))
+
+	_, err = InitCloudEventsSink(testSinkFilters("cloudevents", `{"url":"http://localhost","mode":"batch"}`))
+	assert.Error(t, err)
+	_, err = InitCloudEventsSink(testSinkFilters("cloudevents", `{}`))
+	assert.Error(t, err)
+}
+
+func TestCloudEventsSink_ReleaseBatch_Batched(t *testing.T) {
+	receiver, server := newFakeReceiver(t)
+
+	testSink, err := InitCloudEventsSink(testSinkFilters("cloudevents", fmt.Sprintf(`{"url":"%s","mode":"batched","batchSize":10,"linger":"100ms"}`, server.URL)))
+	assert.NoError(t, err)
+	assert.Equal(t, BatchOptions{MaxEvents: 10, MaxBytes: defaultCloudEventsBatchBytes, Linger: 100 * time.Millisecond}, testSink.BatchOptions())
+	errs := testSink.ReleaseBatch(test.TestEventsSlice)
+	assert.Equal(t, make([]error, len(test.TestEventsSlice)), errs)
+
+	request := receiver.received()[0]
+	var cloudEvents []map[string]any
+	assert.NoError(t, json.Unmarshal(request.body, &cloudEvents))
+	assert.Equal(t, "application/cloudevents-batch+json; charset=utf-8", request.header.Get("Content-Type"))
+	assert.Len(t, cloudEvents, len(test.TestEventsSlice))
+	assert.Equal(t, "io.k8s.event.normal.Started", cloudEvents[0]["type"])
+	assert.Equal(t, "/namespaces/tracing", cloudEvents[1]["source"])
+}
+
+func TestCloudEventsSink_ReleaseBatch_Binary(t *testing.T) {
+	receiver, server := newFakeReceiver(t)
+	receiver.respond = func(w http.ResponseWriter, request receivedRequest) {
+		if request.header.Get("ce-source") == "/namespaces/tracing" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+
+	testSink, err := InitCloudEventsSink(testSinkFilters("cloudevents", fmt.Sprintf(`{"url":"%s"}`, server.URL)))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, testSink.BatchOptions().MaxEvents)
+	errs := testSink.ReleaseBatch(test.TestEventsSlice)
+	assert.Len(t, receiver.received(), len(test.TestEventsSlice), "Each event should be sent by separate request")
+	assert.NoError(t, errs[0])
+	assert.Error(t, errs[1])
+	assert.NoError(t, errs[2])
+}
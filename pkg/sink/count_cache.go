@@ -0,0 +1,66 @@
+package sink
+
+import (
+	"container/list"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const defaultCountCacheSize = 10000
+
+// countCache keeps the last count of events by UID, so the number of occurrences between updates of Event can be
+// counted. The least recently updated events are evicted when the cache is full
+type countCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[types.UID]*list.Element
+	// order contains *countEntry from the most to the least recently updated
+	order *list.List
+}
+
+type countEntry struct {
+	uid   types.UID
+	count int32
+}
+
+func newCountCache(size int) *countCache {
+	return &countCache{size: size, entries: make(map[types.UID]*list.Element), order: list.New()}
+}
+
+// eventCount returns the number of occurrences of Event, series.count of events.k8s.io/v1 API takes precedence
+func eventCount(eventObj *corev1.Event) int32 {
+	if eventObj.Series != nil && eventObj.Series.Count > 0 {
+		return eventObj.Series.Count
+	}
+	return eventObj.Count
+}
+
+// delta returns the number of occurrences since the last update of the event. The first update seen is counted once,
+// as previous occurrences can be counted before restart or eviction. Events without UID or count are counted once
+func (c *countCache) delta(eventObj *corev1.Event) int32 {
+	count := eventCount(eventObj)
+	if count <= 0 || len(eventObj.UID) == 0 {
+		return 1
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[eventObj.UID]; ok {
+		c.order.MoveToFront(element)
+		entry := element.Value.(*countEntry)
+		if count <= entry.count {
+			return 0
+		}
+		delta := count - entry.count
+		entry.count = count
+		return delta
+	}
+	c.entries[eventObj.UID] = c.order.PushFront(&countEntry{uid: eventObj.UID, count: count})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*countEntry).uid)
+	}
+	return 1
+}
@@ -0,0 +1,48 @@
+package sink
+
+import (
+	"testing"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestCountCache_Delta(t *testing.T) {
+	cache := newCountCache(10)
+	event := test.EventPodTracing.DeepCopy()
+	event.UID = "uid-1"
+	event.Count = 3
+	assert.Equal(t, int32(1), cache.delta(event), "The first update should be counted once")
+
+	event.Count = 7
+	assert.Equal(t, int32(4), cache.delta(event), "Repeats folded into one update should be counted")
+	assert.Equal(t, int32(0), cache.delta(event), "Update without increase of count should not be counted")
+
+	event.Series = &corev1.EventSeries{Count: 9}
+	assert.Equal(t, int32(2), cache.delta(event), "Count of series should take precedence")
+
+	assert.Equal(t, int32(1), cache.delta(test.EventPodLogging), "Event without UID should be counted once")
+}
+
+func TestCountCache_Eviction(t *testing.T) {
+	cache := newCountCache(2)
+	events := make([]*corev1.Event, 3)
+	for i, uid := range []string{"uid-1", "uid-2", "uid-3"} {
+		events[i] = test.EventPodTracing.DeepCopy()
+		events[i].UID = types.UID(uid)
+	}
+	cache.delta(events[0])
+	cache.delta(events[1])
+	events[0].Count++
+	assert.Equal(t, int32(1), cache.delta(events[0]))
+	cache.delta(events[2])
+	assert.Len(t, cache.entries, 2)
+
+	events[0].Count += 2
+	assert.Equal(t, int32(2), cache.delta(events[0]), "Recently updated event should stay in the cache")
+	events[1].Count += 2
+	assert.Equal(t, int32(1), cache.delta(events[1]), "The least recently updated event should be evicted and counted once")
+	assert.Equal(t, 2, cache.order.Len())
+}
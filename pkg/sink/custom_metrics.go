@@ -0,0 +1,242 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/aggregation"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Types of custom metrics
+const (
+	CustomMetricCounter   = "counter"
+	CustomMetricGauge     = "gauge"
+	CustomMetricHistogram = "histogram"
+)
+
+// customMetricFields are fields of Event which can be used as values of labels of custom metrics
+var customMetricFields = map[string]func(eventObj *corev1.Event) string{
+	"type":               func(e *corev1.Event) string { return e.Type },
+	"reason":             func(e *corev1.Event) string { return e.Reason },
+	"kind":               func(e *corev1.Event) string { return e.InvolvedObject.Kind },
+	"namespace":          func(e *corev1.Event) string { return e.InvolvedObject.Namespace },
+	"object":             func(e *corev1.Event) string { return e.InvolvedObject.Name },
+	"controller":         func(e *corev1.Event) string { return e.ReportingController },
+	"controllerInstance": func(e *corev1.Event) string { return e.ReportingInstance },
+	"action":             func(e *corev1.Event) string { return e.Action },
+	"sourceComponent":    func(e *corev1.Event) string { return e.Source.Component },
+	"sourceHost":         func(e *corev1.Event) string { return e.Source.Host },
+	"message": func(e *corev1.Event) string {
+		return aggregation.GetCommonMessage(e.InvolvedObject.Kind, e.Reason, e.Message)
+	},
+}
+
+// CustomMetric is the metric declared in settings of metrics sink
+type CustomMetric struct {
+	// Name is the full name of the metric, prefix of the sink is not added
+	Name string `json:"name"`
+	// Type is one of counter, gauge or histogram
+	Type string `json:"type"`
+	Help string `json:"help,omitempty"`
+	// Match and Exclude select events in the same way as rules of sinks
+	Match   []filter.EventMatch `json:"match,omitempty"`
+	Exclude []filter.EventMatch `json:"exclude,omitempty"`
+	// MessagePattern is the regular expression with named groups used by labels and value. Events with messages not
+	// matching the pattern are skipped
+	MessagePattern string              `json:"messagePattern,omitempty"`
+	Labels         []CustomMetricLabel `json:"labels,omitempty"`
+	// Value is the group of MessagePattern with a number or a duration in seconds, e.g. 1m5.5s. It is required for
+	// histograms. Counters are incremented by 1 and gauges are set to 1 if it is not set
+	Value string `json:"value,omitempty"`
+	// Buckets of histogram, default buckets of Prometheus are used if it is not set
+	Buckets []float64 `json:"buckets,omitempty"`
+}
+
+// CustomMetricLabel takes the value of the label from the field of Event or from the group of MessagePattern
+type CustomMetricLabel struct {
+	Name  string `json:"name"`
+	Field string `json:"field,omitempty"`
+	Group string `json:"group,omitempty"`
+}
+
+type customLabel struct {
+	field func(eventObj *corev1.Event) string
+	// group is the index of the group of the message pattern if field is nil
+	group int
+}
+
+// customMetric updates the metric with events selected by rules
+type customMetric struct {
+	*Sink
+	name    string
+	pattern *regexp.Regexp
+	labels  []customLabel
+	value   int
+	// counter rejects negative values, because counters can only increase
+	counter   bool
+	collector prometheus.Collector
+	update    func(labelValues []string, value float64)
+}
+
+// newCustomMetric creates the metric with series limited by the tracker together with other metrics of the sink. The
+// tracker can be nil
+func newCustomMetric(config CustomMetric, series *seriesTracker) (*customMetric, error) {
+	if !metricsPrefixValidator.MatchString(config.Name) {
+		return nil, fmt.Errorf("name of custom metric is not valid: %q", config.Name)
+	}
+	for _, match := range slices.Concat(config.Match, config.Exclude) {
+		if err := validateEventMatch(match); err != nil {
+			return nil, fmt.Errorf("invalid rule of custom metric %s: %w", config.Name, err)
+		}
+	}
+	metric := &customMetric{
+		Sink: NewSinkWithFilters(&filter.Sink{Match: config.Match, Exclude: config.Exclude}),
+		name: config.Name,
+	}
+	if len(config.MessagePattern) > 0 {
+		var err error
+		if metric.pattern, err = regexp.Compile(config.MessagePattern); err != nil {
+			return nil, fmt.Errorf("could not parse message pattern of custom metric %s: %w", config.Name, err)
+		}
+	}
+	group := func(name string) (int, error) {
+		if metric.pattern == nil || metric.pattern.SubexpIndex(name) < 0 {
+			return 0, fmt.Errorf("group %s is not found in message pattern of custom metric %s", name, config.Name)
+		}
+		return metric.pattern.SubexpIndex(name), nil
+	}
+	var labelNames []string
+	for _, label := range config.Labels {
+		if slices.Contains(labelNames, label.Name) {
+			return nil, fmt.Errorf("label %s of custom metric %s is not unique", label.Name, config.Name)
+		}
+		labelNames = append(labelNames, label.Name)
+		switch {
+		case len(label.Field) > 0 && len(label.Group) > 0:
+			return nil, fmt.Errorf("only one of field and group can be set for label %s of custom metric %s", label.Name, config.Name)
+		case len(label.Field) > 0:
+			field, ok := customMetricFields[label.Field]
+			if !ok {
+				return nil, fmt.Errorf("field %s is not supported by custom metrics. Supported fields: %s", label.Field, strings.Join(slices.Sorted(maps.Keys(customMetricFields)), ", "))
+			}
+			metric.labels = append(metric.labels, customLabel{field: field})
+		case len(label.Group) > 0:
+			i, err := group(label.Group)
+			if err != nil {
+				return nil, err
+			}
+			metric.labels = append(metric.labels, customLabel{group: i})
+		default:
+			return nil, fmt.Errorf("field or group must be set for label %s of custom metric %s", label.Name, config.Name)
+		}
+	}
+	metric.value = -1
+	if len(config.Value) > 0 {
+		var err error
+		if metric.value, err = group(config.Value); err != nil {
+			return nil, err
+		}
+	}
+	help := ValueOrDefault(config.Help, "Custom metric of kubernetes events")
+	switch config.Type {
+	case CustomMetricCounter:
+		vec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: config.Name, Help: help}, labelNames)
+		metric.collector = vec
+		metric.counter = true
+		metric.update = func(labelValues []string, value float64) {
+			series.update(vec, labelValues, func(values []string) { vec.WithLabelValues(values...).Add(value) })
+		}
+	case CustomMetricGauge:
+		vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: config.Name, Help: help}, labelNames)
+		metric.collector = vec
+		metric.update = func(labelValues []string, value float64) {
+			series.update(vec, labelValues, func(values []string) { vec.WithLabelValues(values...).Set(value) })
+		}
+	case CustomMetricHistogram:
+		if metric.value < 0 {
+			return nil, fmt.Errorf("value must be set for histogram %s", config.Name)
+		}
+		if !slices.IsSorted(config.Buckets) || len(slices.Compact(slices.Clone(config.Buckets))) != len(config.Buckets) {
+			return nil, fmt.Errorf("buckets of histogram %s must be in increasing order: %v", config.Name, config.Buckets)
+		}
+		vec := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: config.Name, Help: help, Buckets: config.Buckets}, labelNames)
+		metric.collector = vec
+		metric.update = func(labelValues []string, value float64) {
+			series.update(vec, labelValues, func(values []string) { vec.WithLabelValues(values...).Observe(value) })
+		}
+	default:
+		return nil, fmt.Errorf("type of custom metric %s must be one of %s, %s, %s", config.Name, CustomMetricCounter, CustomMetricGauge, CustomMetricHistogram)
+	}
+	return metric, nil
+}
+
+// release updates the metric if the event is selected by rules and its message matches the pattern
+func (m *customMetric) release(eventObj *corev1.Event) {
+	if !m.IsEventAllowed(eventObj) {
+		return
+	}
+	var groups []string
+	if m.pattern != nil {
+		if groups = m.pattern.FindStringSubmatch(eventObj.Message); groups == nil {
+			return
+		}
+	}
+	value := 1.0
+	if m.value >= 0 {
+		var err error
+		if value, err = parseCustomMetricValue(groups[m.value]); err != nil {
+			slog.Debug("could not parse value of custom metric", "metric", m.name, "error", err)
+			return
+		}
+		if m.counter && value < 0 {
+			slog.Debug("negative value of custom counter is skipped", "metric", m.name, "value", value)
+			return
+		}
+	}
+	labelValues := make([]string, len(m.labels))
+	for i, label := range m.labels {
+		if label.field != nil {
+			labelValues[i] = label.field(eventObj)
+		} else {
+			labelValues[i] = groups[label.group]
+		}
+	}
+	m.update(labelValues, value)
+}
+
+// parseCustomMetricValue parses a finite number or a duration in seconds
+func parseCustomMetricValue(value string) (float64, error) {
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		if math.IsNaN(number) || math.IsInf(number, 0) {
+			return 0, fmt.Errorf("value %q is not a finite number", value)
+		}
+		return number, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("value %q is neither a number nor a duration", value)
+	}
+	return duration.Seconds(), nil
+}
+
+// validateEventMatch checks regular expressions of the rule, so invalid rules fail the sink instead of panic
+func validateEventMatch(match filter.EventMatch) error {
+	var errs error
+	for _, pattern := range []string{match.Type, match.Kind, match.Namespace, match.Reason, match.Message, match.ReportingController, match.ReportingInstance} {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = errors.Join(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,112 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestPrometheusMetricsSink_CustomMetrics(t *testing.T) {
+	settings := json.RawMessage(`{"prefix":"kube_custom_events","metrics":[
+		{"name":"kube_image_pull_duration_seconds","type":"histogram","buckets":[1,10,60],
+		 "match":[{"reason":"^Pulled$"}],
+		 "messagePattern":"Successfully pulled image \"(?P<image>[^\"]+)\" in (?P<duration>[0-9.hms]+)",
+		 "labels":[{"name":"namespace","field":"namespace"},{"name":"image","group":"image"}],"value":"duration"},
+		{"name":"kube_failed_mount_total","type":"counter",
+		 "match":[{"reason":"^FailedMount$"}],
+		 "messagePattern":"MountVolume.SetUp failed for volume \"(?P<volume>[^\"]+)\"",
+		 "labels":[{"name":"volume","group":"volume"}]},
+		{"name":"kube_last_restart_count","type":"gauge",
+		 "match":[{"reason":"^BackOff$"}],"exclude":[{"namespace":"monitoring"}],
+		 "messagePattern":"restart (?P<count>[0-9]+)",
+		 "labels":[{"name":"object","field":"object"}],"value":"count"}
+	]}`)
+	endpoint, server := startMetricsServer(t)
+	testSink, err := InitMetricsSink(context.Background(), endpoint, &filter.Sink{Name: "metrics", Settings: settings})
+	assert.NoError(t, err)
+
+	pulled := test.EventPodLogging.DeepCopy()
+	pulled.Reason = "Pulled"
+	pulled.Message = `Successfully pulled image "nginx:1.27" in 1m5.5s (1m5.5s including waiting). Image size: 72099501 bytes.`
+	notPulled := pulled.DeepCopy()
+	notPulled.Message = `Container image "nginx:1.27" already present on machine`
+	failedMount := test.EventPodTracing.DeepCopy()
+	failedMount.Reason = "FailedMount"
+	failedMount.Message = `MountVolume.SetUp failed for volume "config" : configmap "app-config" not found`
+	backOff := test.EventPodTracing.DeepCopy()
+	backOff.Message = "Back-off restarting failed container, restart 7"
+	backOffMonitoring := backOff.DeepCopy()
+	backOffMonitoring.InvolvedObject.Namespace = "monitoring"
+	backOffMonitoring.Message = "Back-off restarting failed container, restart 9"
+	for _, event := range []*corev1.Event{pulled, notPulled, failedMount, failedMount, backOff, backOffMonitoring} {
+		assert.NoError(t, testSink.Release(event))
+	}
+
+	resp, err := server.Client().Get(server.URL)
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, resp.Body.Close())
+	}()
+	responseBody, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(responseBody), `kube_image_pull_duration_seconds_bucket{image="nginx:1.27",namespace="logging",le="60"} 0`)
+	assert.Contains(t, string(responseBody), `kube_image_pull_duration_seconds_sum{image="nginx:1.27",namespace="logging"} 65.5`)
+	assert.Contains(t, string(responseBody), `kube_image_pull_duration_seconds_count{image="nginx:1.27",namespace="logging"} 1`, "Events with messages not matching the pattern should be skipped")
+	assert.Contains(t, string(responseBody), `kube_failed_mount_total{volume="config"} 2`)
+	assert.Contains(t, string(responseBody), `kube_last_restart_count{object="test-pod"} 7`, "Events excluded by rules of metric should be skipped")
+}
+
+func TestInitMetricsSink_InvalidCustomMetrics(t *testing.T) {
+	for _, metric := range []string{
+		`{"name":"kube-invalid","type":"counter"}`,
+		`{"name":"kube_invalid","type":"summary"}`,
+		`{"name":"kube_invalid","type":"histogram"}`,
+		`{"name":"kube_invalid","type":"histogram","messagePattern":"(?P<v>[0-9]+)","value":"v","buckets":[10,1]}`,
+		`{"name":"kube_invalid","type":"counter","match":[{"reason":"("}]}`,
+		`{"name":"kube_invalid","type":"counter","messagePattern":"("}`,
+		`{"name":"kube_invalid","type":"counter","labels":[{"name":"volume","group":"volume"}]}`,
+		`{"name":"kube_invalid","type":"counter","labels":[{"name":"pod","field":"pod"}]}`,
+		`{"name":"kube_invalid","type":"counter","labels":[{"name":"kind"}]}`,
+		`{"name":"kube_invalid","type":"counter","labels":[{"name":"kind","field":"kind"},{"name":"kind","field":"reason"}]}`,
+	} {
+		settings := json.RawMessage(`{"prefix":"kube_invalid_custom","metrics":[` + metric + `]}`)
+		_, err := InitMetricsSink(context.Background(), nil, &filter.Sink{Name: "metrics", Settings: settings})
+		assert.Error(t, err, metric)
+	}
+}
+
+func TestParseCustomMetricValue(t *testing.T) {
+	for value, expected := range map[string]float64{"42": 42, "0.5": 0.5, "1m5.5s": 65.5, "250ms": 0.25} {
+		parsed, err := parseCustomMetricValue(value)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, parsed, value)
+	}
+	for _, value := range []string{"abc", "NaN", "Inf", "-Inf"} {
+		_, err := parseCustomMetricValue(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestCustomMetric_CounterSkipsInvalidValues(t *testing.T) {
+	metric, err := newCustomMetric(CustomMetric{Name: "kube_retries_total", Type: CustomMetricCounter, MessagePattern: "retries (?P<retries>\\S+)", Value: "retries"}, nil)
+	require.NoError(t, err)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metric.collector)
+	for _, message := range []string{"retries 2", "retries -5", "retries NaN", "retries +Inf", "retries 1.5"} {
+		event := test.EventPodLogging.DeepCopy()
+		event.Message = message
+		assert.NotPanics(t, func() { metric.release(event) }, message)
+	}
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+	assert.Equal(t, 3.5, families[0].GetMetric()[0].GetCounter().GetValue(), "Negative and non-finite values should be skipped")
+}
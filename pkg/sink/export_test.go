@@ -0,0 +1,8 @@
+package sink
+
+// Unregister removes the registered type, so tests of package sink_test do not leave their sinks in the registry
+func Unregister(sinkType string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	delete(registry, sinkType)
+}
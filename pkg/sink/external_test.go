@@ -0,0 +1,75 @@
+package sink_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/sink"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type recordingSettings struct {
+	Prefix   string          `json:"prefix,omitempty"`
+	Interval metav1.Duration `json:"interval,omitempty"`
+}
+
+// recordingSink is the sink defined outside of the package in the same way as third party sinks
+type recordingSink struct {
+	*sink.Sink
+	prefix   string
+	interval time.Duration
+	released []string
+}
+
+func (rs *recordingSink) Release(eventObj *corev1.Event) error {
+	if rs.IsEventAllowed(eventObj) {
+		rs.released = append(rs.released, rs.prefix+eventObj.Reason)
+	}
+	return nil
+}
+
+func TestRegister_ExternalSink(t *testing.T) {
+	sink.Register(sink.Registration{
+		Type:     "test-recording",
+		Settings: recordingSettings{},
+		New: func(_ context.Context, _ *sink.Options, filters *filter.Sink) (sink.ISink, error) {
+			var settings recordingSettings
+			if err := sink.DecodeSettings(filters, &settings); err != nil {
+				return nil, err
+			}
+			return &recordingSink{
+				Sink:     sink.NewSinkWithFilters(filters),
+				prefix:   sink.ValueOrDefault(settings.Prefix, "event:"),
+				interval: sink.DurationOrDefault(settings.Interval, time.Minute),
+			}, nil
+		},
+	})
+	defer sink.Unregister("test-recording")
+	assert.Contains(t, sink.Types(), "test-recording")
+	filters := &filter.Sink{
+		Name:     "recording",
+		Type:     "test-recording",
+		Match:    []filter.EventMatch{{Type: "Warning"}},
+		Settings: json.RawMessage(`{"interval":"5s"}`),
+	}
+	require.NoError(t, sink.ValidateFilters(&filter.Filters{Sinks: []*filter.Sink{filters}}))
+	created, err := sink.New(context.Background(), "test-recording", nil, filters)
+	require.NoError(t, err)
+	recording := created.(*recordingSink)
+	assert.Equal(t, 5*time.Second, recording.interval)
+
+	assert.NoError(t, recording.Release(test.EventPodLogging))
+	assert.NoError(t, recording.Release(test.EventPodTracing))
+	assert.Equal(t, []string{"event:BackOff"}, recording.released, "Rules of filters should be applied by the embedded Sink")
+
+	filters.Settings = json.RawMessage(`{"unknown":true}`)
+	_, err = sink.New(context.Background(), "test-recording", nil, filters)
+	assert.Error(t, err, "Unknown settings should be rejected by DecodeSettings")
+}
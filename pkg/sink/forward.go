@@ -0,0 +1,483 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/format"
+	"github.com/vmihailenco/msgpack/v5"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	forwardSinkName = "forward"
+
+	forwardCompressionGzip = "gzip"
+	forwardCompressionNone = "none"
+
+	// forwardEventTimeExtType is msgpack extension type of EventTime in Forward protocol
+	forwardEventTimeExtType = 0
+
+	defaultForwardTag           = "kube.events.{{.InvolvedObject.Namespace}}"
+	defaultForwardBatchSize     = 100
+	defaultForwardFlushInterval = 5 * time.Second
+	defaultForwardAckTimeout    = 30 * time.Second
+	defaultForwardTimeout       = 10 * time.Second
+)
+
+type FluentForwardSettings struct {
+	// Address is host:port of Fluentd or Fluent Bit forward input
+	Address string `json:"address"`
+	// Tag is a template of the tag of events. Events are grouped by tag in PackedForward messages
+	Tag string `json:"tag,omitempty"`
+	// SharedKey enables the handshake with the server using shared key authentication
+	SharedKey     string `json:"sharedKey,omitempty"`
+	SharedKeyFile string `json:"sharedKeyFile,omitempty"`
+	SelfHostname  string `json:"selfHostname,omitempty"`
+	// Username and Password are used if the server requires user authentication during the handshake
+	Username           string `json:"username,omitempty"`
+	Password           string `json:"password,omitempty"`
+	PasswordFile       string `json:"passwordFile,omitempty"`
+	TLS                bool   `json:"tls,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+	// Compression of PackedForward entries: gzip or none
+	Compression string `json:"compression,omitempty"`
+	// Ack enables at-least-once delivery. Batch is re-sent if the server does not acknowledge it in AckTimeout
+	Ack           bool            `json:"ack,omitempty"`
+	AckTimeout    metav1.Duration `json:"ackTimeout,omitempty"`
+	BatchSize     int             `json:"batchSize,omitempty"`
+	FlushInterval metav1.Duration `json:"flushInterval,omitempty"`
+	Timeout       metav1.Duration `json:"timeout,omitempty"`
+}
+
+type FluentForwardSink struct {
+	*Sink
+	address      string
+	tag          *template.Template
+	sharedKey    string
+	selfHostname string
+	username     string
+	password     string
+	tlsConfig    *tls.Config
+	compression  string
+	ack          bool
+	ackTimeout   time.Duration
+	timeout      time.Duration
+	batch        BatchOptions
+	// ctx is canceled by Close, so the connection is closed even while the batch waits for the acknowledgement
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mu guards conn, so messages of batches sent concurrently are not interleaved
+	mu   sync.Mutex
+	conn *forwardConn
+}
+
+type forwardConn struct {
+	net.Conn
+	decoder   *msgpack.Decoder
+	keepalive bool
+	// stop stops closing of the connection on cancellation of the context of the sink
+	stop func() bool
+}
+
+func init() {
+	Register(Registration{
+		Type:     forwardSinkName,
+		Settings: FluentForwardSettings{},
+		New: func(_ context.Context, _ *Options, filters *filter.Sink) (ISink, error) {
+			return InitFluentForwardSink(filters)
+		},
+	})
+}
+
+func InitFluentForwardSink(filters *filter.Sink) (*FluentForwardSink, error) {
+	var settings FluentForwardSettings
+	if err := DecodeSettings(filters, &settings); err != nil {
+		return nil, err
+	}
+	if len(settings.Address) == 0 {
+		return nil, fmt.Errorf("address must be configured for forward sink")
+	}
+	tag, err := format.ParseEventTemplate(forwardSinkName, ValueOrDefault(settings.Tag, defaultForwardTag))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse tag template of forward sink: %w", err)
+	}
+	compression := strings.ToLower(ValueOrDefault(settings.Compression, forwardCompressionNone))
+	if compression != forwardCompressionGzip && compression != forwardCompressionNone {
+		return nil, fmt.Errorf("forward compression is not supported: %s", settings.Compression)
+	}
+	sharedKey := settings.SharedKey
+	if len(settings.SharedKeyFile) > 0 {
+		if sharedKey, err = ReadSecretFile(settings.SharedKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	password := settings.Password
+	if len(settings.PasswordFile) > 0 {
+		if password, err = ReadSecretFile(settings.PasswordFile); err != nil {
+			return nil, err
+		}
+	}
+	selfHostname := settings.SelfHostname
+	if len(selfHostname) == 0 {
+		selfHostname, _ = os.Hostname()
+	}
+	var tlsConfig *tls.Config
+	if settings.TLS {
+		tlsConfig = &tls.Config{InsecureSkipVerify: settings.InsecureSkipVerify} // #nosec G402 -- configured explicitly by user
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &FluentForwardSink{
+		Sink:         NewSinkWithFilters(filters),
+		address:      settings.Address,
+		tag:          tag,
+		sharedKey:    sharedKey,
+		selfHostname: selfHostname,
+		username:     settings.Username,
+		password:     password,
+		tlsConfig:    tlsConfig,
+		compression:  compression,
+		ack:          settings.Ack,
+		ackTimeout:   DurationOrDefault(settings.AckTimeout, defaultForwardAckTimeout),
+		timeout:      DurationOrDefault(settings.Timeout, defaultForwardTimeout),
+		batch: BatchOptions{
+			MaxEvents: IntOrDefault(settings.BatchSize, defaultForwardBatchSize),
+			Linger:    DurationOrDefault(settings.FlushInterval, defaultForwardFlushInterval),
+		},
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+func (fs *FluentForwardSink) Release(eventObj *corev1.Event) error {
+	if !fs.IsEventAllowed(eventObj) {
+		return nil
+	}
+	return fs.ReleaseBatch([]*corev1.Event{eventObj})[0]
+}
+
+func (fs *FluentForwardSink) BatchOptions() BatchOptions {
+	return fs.batch
+}
+
+// ReleaseBatch sends one PackedForward message per tag. Events of failed messages are returned to the controller, which
+// retries them
+func (fs *FluentForwardSink) ReleaseBatch(events []*corev1.Event) []error {
+	errs := make([]error, len(events))
+	var tags []string
+	indexes := make(map[string][]int)
+	for i, eventObj := range events {
+		tag, err := fs.renderTag(eventObj)
+		if err != nil {
+			errs[i] = Permanent(fmt.Errorf("could not render tag of event for forward sink: %w", err))
+			continue
+		}
+		if _, ok := indexes[tag]; !ok {
+			tags = append(tags, tag)
+		}
+		indexes[tag] = append(indexes[tag], i)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for _, tag := range tags {
+		batch := make([]*corev1.Event, len(indexes[tag]))
+		for j, i := range indexes[tag] {
+			batch[j] = events[i]
+		}
+		message, chunk, err := fs.encode(tag, batch)
+		if err != nil {
+			err = Permanent(fmt.Errorf("could not encode events for forward sink: %w", err))
+		} else {
+			err = fs.send(message, chunk)
+		}
+		for _, i := range indexes[tag] {
+			errs[i] = err
+		}
+	}
+	if fs.conn != nil && !fs.conn.keepalive {
+		fs.closeConn()
+	}
+	return errs
+}
+
+// Close closes the connection to the server. The batch waiting for the acknowledgement fails
+func (fs *FluentForwardSink) Close(context.Context) error {
+	fs.cancel()
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.conn != nil {
+		fs.closeConn()
+	}
+	return nil
+}
+
+func (fs *FluentForwardSink) renderTag(eventObj *corev1.Event) (string, error) {
+	tag := strings.Builder{}
+	if err := fs.tag.Execute(&tag, eventObj); err != nil {
+		return "", err
+	}
+	return strings.Trim(tag.String(), "."), nil
+}
+
+// encode builds PackedForward (or CompressedPackedForward) message: [tag, entries, option].
+// The chunk option is set only if acknowledgement is enabled
+func (fs *FluentForwardSink) encode(tag string, batch []*corev1.Event) ([]byte, string, error) {
+	entries := bytes.Buffer{}
+	encoder := msgpack.NewEncoder(&entries)
+	for _, eventObj := range batch {
+		record, err := forwardRecord(eventObj)
+		if err != nil {
+			return nil, "", err
+		}
+		if err = encoder.EncodeArrayLen(2); err != nil {
+			return nil, "", err
+		}
+		if err = encodeForwardEventTime(encoder, format.ResolveTimestamp(eventObj).Time); err != nil {
+			return nil, "", err
+		}
+		if err = encoder.Encode(record); err != nil {
+			return nil, "", err
+		}
+	}
+	packed := entries.Bytes()
+	option := map[string]any{"size": len(batch)}
+	if fs.compression == forwardCompressionGzip {
+		compressed := bytes.Buffer{}
+		writer := gzip.NewWriter(&compressed)
+		if _, err := writer.Write(packed); err != nil {
+			return nil, "", err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, "", err
+		}
+		packed = compressed.Bytes()
+		option["compressed"] = forwardCompressionGzip
+	}
+	var chunk string
+	if fs.ack {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return nil, "", err
+		}
+		chunk = base64.StdEncoding.EncodeToString(id)
+		option["chunk"] = chunk
+	}
+	message, err := msgpack.Marshal([]any{tag, packed, option})
+	return message, chunk, err
+}
+
+// encodeForwardEventTime writes EventTime extension with seconds and nanoseconds as big-endian uint32
+func encodeForwardEventTime(encoder *msgpack.Encoder, timestamp time.Time) error {
+	if err := encoder.EncodeExtHeader(forwardEventTimeExtType, 8); err != nil {
+		return err
+	}
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data[:4], uint32(timestamp.Unix()))       // #nosec G115 -- EventTime is defined as uint32 seconds
+	binary.BigEndian.PutUint32(data[4:], uint32(timestamp.Nanosecond())) // #nosec G115 -- nanoseconds are always in uint32 range
+	_, err := encoder.Writer().Write(data)
+	return err
+}
+
+// forwardRecord converts event to the map with the same keys as in JSON representation of the event
+func forwardRecord(eventObj *corev1.Event) (map[string]any, error) {
+	data, err := json.Marshal(eventObj)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var record map[string]any
+	if err = decoder.Decode(&record); err != nil {
+		return nil, err
+	}
+	return normalizeJSONNumbers(record).(map[string]any), nil
+}
+
+// normalizeJSONNumbers replaces json.Number values with int64 or float64, so they are encoded as msgpack numbers
+func normalizeJSONNumbers(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = normalizeJSONNumbers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = normalizeJSONNumbers(item)
+		}
+	case json.Number:
+		if number, err := v.Int64(); err == nil {
+			return number
+		}
+		number, _ := v.Float64()
+		return number
+	}
+	return value
+}
+
+// send writes message to the server and waits for the acknowledgement if chunk is set.
+// Connection is re-established on the next attempt after any error. It must be called with the lock held
+func (fs *FluentForwardSink) send(message []byte, chunk string) error {
+	if fs.conn == nil {
+		conn, err := fs.connect()
+		if err != nil {
+			return err
+		}
+		fs.conn = conn
+	}
+	if err := fs.conn.SetWriteDeadline(time.Now().Add(fs.timeout)); err != nil {
+		fs.closeConn()
+		return err
+	}
+	if _, err := fs.conn.Write(message); err != nil {
+		fs.closeConn()
+		return fmt.Errorf("could not send events to forward server %s: %w", fs.address, err)
+	}
+	if len(chunk) == 0 {
+		return nil
+	}
+	if err := fs.conn.SetReadDeadline(time.Now().Add(fs.ackTimeout)); err != nil {
+		fs.closeConn()
+		return err
+	}
+	response, err := fs.conn.decoder.DecodeMap()
+	if err != nil {
+		fs.closeConn()
+		return fmt.Errorf("events were not acknowledged by forward server %s: %w", fs.address, err)
+	}
+	if ack, _ := response["ack"].(string); ack != chunk {
+		fs.closeConn()
+		return fmt.Errorf("forward server %s acknowledged unexpected chunk %q", fs.address, ack)
+	}
+	return nil
+}
+
+func (fs *FluentForwardSink) closeConn() {
+	fs.conn.stop()
+	_ = fs.conn.Close()
+	fs.conn = nil
+}
+
+func (fs *FluentForwardSink) connect() (*forwardConn, error) {
+	dialer := &net.Dialer{Timeout: fs.timeout}
+	var conn net.Conn
+	var err error
+	if fs.tlsConfig != nil {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: fs.tlsConfig}).DialContext(fs.ctx, "tcp", fs.address)
+	} else {
+		conn, err = dialer.DialContext(fs.ctx, "tcp", fs.address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to forward server %s: %w", fs.address, err)
+	}
+	// reads and writes in progress fail when the connection is closed
+	stop := context.AfterFunc(fs.ctx, func() {
+		_ = conn.Close()
+	})
+	forwardConn := &forwardConn{Conn: conn, decoder: msgpack.NewDecoder(conn), keepalive: true, stop: stop}
+	if len(fs.sharedKey) > 0 {
+		if err = fs.handshake(forwardConn); err != nil {
+			stop()
+			_ = conn.Close()
+			return nil, fmt.Errorf("handshake with forward server %s failed: %w", fs.address, err)
+		}
+	}
+	return forwardConn, nil
+}
+
+// handshake authenticates the client with shared key: the server sends HELO, the client answers with PING
+// and the server confirms authentication with PONG
+func (fs *FluentForwardSink) handshake(conn *forwardConn) error {
+	if err := conn.SetDeadline(time.Now().Add(fs.timeout)); err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.SetDeadline(time.Time{})
+	}()
+	helo, err := decodeForwardMessage(conn.decoder, "HELO", 2)
+	if err != nil {
+		return err
+	}
+	options, _ := helo[1].(map[string]any)
+	nonce := forwardString(options["nonce"])
+	authSalt := forwardString(options["auth"])
+	if keepalive, ok := options["keepalive"].(bool); ok {
+		conn.keepalive = keepalive
+	}
+
+	salt := make([]byte, 16)
+	if _, err = rand.Read(salt); err != nil {
+		return err
+	}
+	sharedKeySalt := hex.EncodeToString(salt)
+	var username, passwordDigest string
+	if len(authSalt) > 0 {
+		username = fs.username
+		passwordDigest = sha512Hex(authSalt, fs.username, fs.password)
+	}
+	ping, err := msgpack.Marshal([]any{"PING", fs.selfHostname, sharedKeySalt, sha512Hex(sharedKeySalt, fs.selfHostname, nonce, fs.sharedKey), username, passwordDigest})
+	if err != nil {
+		return err
+	}
+	if _, err = conn.Write(ping); err != nil {
+		return err
+	}
+
+	pong, err := decodeForwardMessage(conn.decoder, "PONG", 5)
+	if err != nil {
+		return err
+	}
+	if ok, _ := pong[1].(bool); !ok {
+		return fmt.Errorf("authentication failed: %s", forwardString(pong[2]))
+	}
+	serverHostname := forwardString(pong[3])
+	if forwardString(pong[4]) != sha512Hex(sharedKeySalt, serverHostname, nonce, fs.sharedKey) {
+		return fmt.Errorf("shared key of server %s does not match", serverHostname)
+	}
+	return nil
+}
+
+func decodeForwardMessage(decoder *msgpack.Decoder, messageType string, minLength int) ([]any, error) {
+	value, err := decoder.DecodeInterface()
+	if err != nil {
+		return nil, err
+	}
+	message, ok := value.([]any)
+	if !ok || len(message) < minLength || forwardString(message[0]) != messageType {
+		return nil, fmt.Errorf("unexpected message from server, %s is expected", messageType)
+	}
+	return message, nil
+}
+
+// forwardString returns value of msgpack str or bin type as string
+func forwardString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return ""
+}
+
+func sha512Hex(values ...string) string {
+	hash := sha512.Sum512([]byte(strings.Join(values, "")))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,255 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+	corev1 "k8s.io/api/core/v1"
+)
+
+type forwardEntry struct {
+	time   time.Time
+	record map[string]any
+}
+
+type forwardMessage struct {
+	tag     string
+	entries []forwardEntry
+	option  map[string]any
+}
+
+// fakeForwardServer accepts one connection, performs the handshake if shared key is set,
+// decodes PackedForward messages and acknowledges chunks
+type fakeForwardServer struct {
+	listener  net.Listener
+	sharedKey string
+	messages  chan forwardMessage
+}
+
+func newFakeForwardServer(t *testing.T, sharedKey string) *fakeForwardServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := &fakeForwardServer{listener: listener, sharedKey: sharedKey, messages: make(chan forwardMessage, 10)}
+	go server.serve(t)
+	return server
+}
+
+func (fs *fakeForwardServer) close() {
+	_ = fs.listener.Close()
+}
+
+func (fs *fakeForwardServer) serve(t *testing.T) {
+	conn, err := fs.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	decoder := msgpack.NewDecoder(conn)
+	encoder := msgpack.NewEncoder(conn)
+	if len(fs.sharedKey) > 0 {
+		nonce := "test-nonce"
+		assert.NoError(t, encoder.Encode([]any{"HELO", map[string]any{"nonce": []byte(nonce), "auth": "", "keepalive": true}}))
+		var ping []string
+		assert.NoError(t, decoder.Decode(&ping))
+		assert.Equal(t, "PING", ping[0])
+		authenticated := ping[3] == sha512Hex(ping[2], ping[1], nonce, fs.sharedKey)
+		assert.NoError(t, encoder.Encode([]any{"PONG", authenticated, "", "server", sha512Hex(ping[2], "server", nonce, fs.sharedKey)}))
+		if !authenticated {
+			return
+		}
+	}
+	for {
+		message, err := decodePackedForward(decoder)
+		if err != nil {
+			return
+		}
+		fs.messages <- message
+		if chunk, ok := message.option["chunk"]; ok {
+			assert.NoError(t, encoder.Encode(map[string]any{"ack": chunk}))
+		}
+	}
+}
+
+func decodePackedForward(decoder *msgpack.Decoder) (forwardMessage, error) {
+	var message forwardMessage
+	if _, err := decoder.DecodeArrayLen(); err != nil {
+		return message, err
+	}
+	tag, err := decoder.DecodeString()
+	if err != nil {
+		return message, err
+	}
+	entries, err := decoder.DecodeBytes()
+	if err != nil {
+		return message, err
+	}
+	option, err := decoder.DecodeMap()
+	if err != nil {
+		return message, err
+	}
+	if option["compressed"] == "gzip" {
+		reader, err := gzip.NewReader(bytes.NewReader(entries))
+		if err != nil {
+			return message, err
+		}
+		if entries, err = io.ReadAll(reader); err != nil {
+			return message, err
+		}
+	}
+	message = forwardMessage{tag: tag, option: option}
+	entriesDecoder := msgpack.NewDecoder(bytes.NewReader(entries))
+	for {
+		if _, err = entriesDecoder.DecodeArrayLen(); err == io.EOF {
+			return message, nil
+		} else if err != nil {
+			return message, err
+		}
+		extID, extLen, err := entriesDecoder.DecodeExtHeader()
+		if err != nil || extID != forwardEventTimeExtType || extLen != 8 {
+			return message, fmt.Errorf("unexpected event time: %d, %d, %w", extID, extLen, err)
+		}
+		data := make([]byte, 8)
+		if err = entriesDecoder.ReadFull(data); err != nil {
+			return message, err
+		}
+		record, err := entriesDecoder.DecodeMap()
+		if err != nil {
+			return message, err
+		}
+		timestamp := time.Unix(int64(binary.BigEndian.Uint32(data[:4])), int64(binary.BigEndian.Uint32(data[4:])))
+		message.entries = append(message.entries, forwardEntry{time: timestamp, record: record})
+	}
+}
+
+func (fs *fakeForwardServer) receive(t *testing.T) forwardMessage {
+	select {
+	case message := <-fs.messages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not received")
+	}
+	return forwardMessage{}
+}
+
+func TestFluentForwardSink_Release(t *testing.T) {
+	server := newFakeForwardServer(t, "")
+	defer server.close()
+
+	testSink, err := InitFluentForwardSink(testSinkFilters("forward", fmt.Sprintf(`{"address":"%s","batchSize":4,"flushInterval":"1h"}`, server.listener.Addr().String())))
+	assert.NoError(t, err)
+	assert.Equal(t, BatchOptions{MaxEvents: 4, Linger: time.Hour}, testSink.BatchOptions())
+	for _, err = range testSink.ReleaseBatch(test.TestEventsSlice) {
+		assert.NoError(t, err)
+	}
+
+	messages := map[string]forwardMessage{}
+	for range 3 {
+		message := server.receive(t)
+		messages[message.tag] = message
+	}
+	assert.Len(t, messages["kube.events.monitoring"].entries, 2, "Events should be grouped by tag")
+	assert.Len(t, messages["kube.events.logging"].entries, 1)
+	assert.Len(t, messages["kube.events.tracing"].entries, 1)
+	assert.Equal(t, int8(2), messages["kube.events.monitoring"].option["size"])
+
+	message := messages["kube.events.tracing"]
+	assert.NotContains(t, message.option, "chunk")
+	entry := message.entries[0]
+	assert.Equal(t, test.LastTs.Unix(), entry.time.Unix())
+	assert.Equal(t, "BackOff", entry.record["reason"])
+	assert.Equal(t, "Back-off restarting failed container", entry.record["message"])
+	assert.Equal(t, "Pod", entry.record["involvedObject"].(map[string]any)["kind"])
+}
+
+func TestFluentForwardSink_Release_AckCompressionHandshake(t *testing.T) {
+	server := newFakeForwardServer(t, "secret")
+	defer server.close()
+
+	testSink, err := InitFluentForwardSink(testSinkFilters("forward", fmt.Sprintf(`{"address":"%s","tag":"k8s.{{.Type}}","sharedKey":"secret","ack":true,"compression":"gzip","flushInterval":"10ms"}`, server.listener.Addr().String())))
+	assert.NoError(t, err)
+	assert.NoError(t, testSink.Release(test.EventPodTracing))
+
+	message := server.receive(t)
+	assert.Equal(t, "k8s.Warning", message.tag)
+	assert.Equal(t, "gzip", message.option["compressed"])
+	assert.NotEmpty(t, message.option["chunk"])
+	assert.Len(t, message.entries, 1)
+	assert.Equal(t, "tracing", message.entries[0].record["metadata"].(map[string]any)["namespace"])
+}
+
+func TestFluentForwardSink_Handshake_WrongSharedKey(t *testing.T) {
+	server := newFakeForwardServer(t, "secret")
+	defer server.close()
+
+	testSink := &FluentForwardSink{address: server.listener.Addr().String(), sharedKey: "wrong", selfHostname: "test", timeout: 5 * time.Second, ctx: t.Context()}
+	assert.Error(t, testSink.send([]byte{}, ""))
+}
+
+func TestFluentForwardSink_ReleaseBatch_Error(t *testing.T) {
+	server := newFakeForwardServer(t, "")
+	address := server.listener.Addr().String()
+	server.close()
+
+	testSink, err := InitFluentForwardSink(testSinkFilters("forward", fmt.Sprintf(`{"address":"%s"}`, address)))
+	assert.NoError(t, err)
+	errs := testSink.ReleaseBatch([]*corev1.Event{test.EventPodTracing, test.EventPodLogging})
+	assert.Len(t, errs, 2)
+	for _, err = range errs {
+		assert.Error(t, err, "Events of failed messages should be returned to the controller")
+	}
+}
+
+func TestFluentForwardSink_Close_CancelsAck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+	// the server reads messages and never acknowledges them
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	testSink, err := InitFluentForwardSink(testSinkFilters("forward", fmt.Sprintf(`{"address":"%s","ack":true,"ackTimeout":"1h"}`, listener.Addr().String())))
+	assert.NoError(t, err)
+	time.AfterFunc(100*time.Millisecond, func() {
+		assert.NoError(t, testSink.Close(context.Background()))
+	})
+	released := make(chan error)
+	go func() {
+		released <- testSink.Release(test.EventPodTracing)
+	}()
+	select {
+	case err = <-released:
+		assert.Error(t, err, "Not acknowledged batch should fail")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close should cancel the wait for acknowledgement")
+	}
+}
+
+func TestInitFluentForwardSink_InvalidSettings(t *testing.T) {
+	for _, settings := range []string{
+		`{"tag":"kube.events"}`,
+		`{"address":"localhost:24224","tag":"{{.Unknown"}`,
+		`{"address":"localhost:24224","compression":"zstd"}`,
+	} {
+		_, err := InitFluentForwardSink(testSinkFilters("forward", settings))
+		assert.Error(t, err, settings)
+	}
+}
@@ -0,0 +1,361 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/aggregation"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/format"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	gelfProtocolUDP  = "udp"
+	gelfProtocolTCP  = "tcp"
+	gelfProtocolHTTP = "http"
+
+	gelfCompressionGzip = "gzip"
+	gelfCompressionZlib = "zlib"
+	gelfCompressionNone = "none"
+
+	gelfVersion          = "1.1"
+	gelfChunkHeaderSize  = 12
+	gelfMaxChunks        = 128
+	defaultGELFChunkSize = 1420
+	defaultGELFTimeout   = 10 * time.Second
+)
+
+// Syslog severity levels used by GELF
+const (
+	gelfLevelWarning       = 4
+	gelfLevelNotice        = 5
+	gelfLevelInformational = 6
+)
+
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+type GELFSettings struct {
+	// Protocol is the transport of GELF messages: udp, tcp or http
+	Protocol string `json:"protocol"`
+	// Address is host:port of Graylog input for udp and tcp protocols
+	Address string `json:"address,omitempty"`
+	// URL of Graylog GELF HTTP input
+	URL string `json:"url,omitempty"`
+	// Compression of messages: gzip, zlib or none. It is not supported by tcp protocol
+	Compression string `json:"compression,omitempty"`
+	// ChunkSize is the maximum size of UDP datagram
+	ChunkSize          int               `json:"chunkSize,omitempty"`
+	Host               string            `json:"host,omitempty"`
+	ExtraFields        map[string]string `json:"extraFields,omitempty"`
+	TLS                bool              `json:"tls,omitempty"`
+	InsecureSkipVerify bool              `json:"insecureSkipVerify,omitempty"`
+	Timeout            metav1.Duration   `json:"timeout,omitempty"`
+}
+
+type GELFSink struct {
+	*Sink
+	protocol    string
+	address     string
+	url         string
+	compression string
+	chunkSize   int
+	host        string
+	extraFields map[string]any
+	tlsConfig   *tls.Config
+	timeout     time.Duration
+	client      *http.Client
+
+	// conn is the persistent connection of udp or tcp protocol
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func init() {
+	Register(Registration{
+		Type:     "gelf",
+		Settings: GELFSettings{},
+		New: func(_ context.Context, _ *Options, filters *filter.Sink) (ISink, error) {
+			return InitGELFSink(filters)
+		},
+	})
+}
+
+func InitGELFSink(filters *filter.Sink) (*GELFSink, error) {
+	var settings GELFSettings
+	if err := DecodeSettings(filters, &settings); err != nil {
+		return nil, err
+	}
+	protocol := strings.ToLower(ValueOrDefault(settings.Protocol, gelfProtocolUDP))
+	defaultCompression := gelfCompressionNone
+	switch protocol {
+	case gelfProtocolUDP:
+		if settings.TLS {
+			return nil, fmt.Errorf("tls is not supported for udp protocol of gelf sink")
+		}
+		defaultCompression = gelfCompressionGzip
+		fallthrough
+	case gelfProtocolTCP:
+		if len(settings.Address) == 0 {
+			return nil, fmt.Errorf("address must be configured for gelf sink with %s protocol", protocol)
+		}
+	case gelfProtocolHTTP:
+		if len(settings.URL) == 0 {
+			return nil, fmt.Errorf("url must be configured for gelf sink with http protocol")
+		}
+	default:
+		return nil, fmt.Errorf("gelf protocol is not supported: %s", settings.Protocol)
+	}
+	compression := strings.ToLower(ValueOrDefault(settings.Compression, defaultCompression))
+	switch {
+	case compression != gelfCompressionGzip && compression != gelfCompressionZlib && compression != gelfCompressionNone:
+		return nil, fmt.Errorf("gelf compression is not supported: %s", settings.Compression)
+	case protocol == gelfProtocolTCP && compression != gelfCompressionNone:
+		return nil, fmt.Errorf("gelf compression is not supported for tcp protocol")
+	case protocol == gelfProtocolHTTP && compression == gelfCompressionZlib:
+		return nil, fmt.Errorf("only gzip compression is supported for http protocol")
+	}
+	chunkSize := settings.ChunkSize
+	if chunkSize <= gelfChunkHeaderSize {
+		chunkSize = defaultGELFChunkSize
+	}
+	host := settings.Host
+	if len(host) == 0 {
+		host, _ = os.Hostname()
+	}
+	extraFields := make(map[string]any, len(settings.ExtraFields))
+	for name, value := range settings.ExtraFields {
+		extraFields["_"+strings.TrimPrefix(name, "_")] = value
+	}
+	var tlsConfig *tls.Config
+	// TLS of http protocol is enabled by https scheme of the url
+	if settings.TLS || protocol == gelfProtocolHTTP {
+		tlsConfig = &tls.Config{InsecureSkipVerify: settings.InsecureSkipVerify} // #nosec G402 -- configured explicitly by user
+	}
+	timeout := DurationOrDefault(settings.Timeout, defaultGELFTimeout)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	aggregation.InitAggregations()
+	return &GELFSink{
+		Sink:        NewSinkWithFilters(filters),
+		protocol:    protocol,
+		address:     settings.Address,
+		url:         settings.URL,
+		compression: compression,
+		chunkSize:   chunkSize,
+		host:        host,
+		extraFields: extraFields,
+		tlsConfig:   tlsConfig,
+		timeout:     timeout,
+		client:      &http.Client{Timeout: timeout, Transport: transport},
+	}, nil
+}
+
+// Close closes the persistent connection of udp or tcp protocol and idle connections of http protocol
+func (gs *GELFSink) Close(context.Context) error {
+	gs.client.CloseIdleConnections()
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if gs.conn == nil {
+		return nil
+	}
+	err := gs.conn.Close()
+	gs.conn = nil
+	return err
+}
+
+func (gs *GELFSink) Release(eventObj *corev1.Event) error {
+	if !gs.IsEventAllowed(eventObj) {
+		return nil
+	}
+	message, err := json.Marshal(gs.gelfMessage(eventObj))
+	if err != nil {
+		return err
+	}
+	switch gs.protocol {
+	case gelfProtocolTCP:
+		return gs.sendTCP(message)
+	case gelfProtocolHTTP:
+		return gs.sendHTTP(message)
+	default:
+		return gs.sendUDP(message)
+	}
+}
+
+func (gs *GELFSink) gelfMessage(eventObj *corev1.Event) map[string]any {
+	message := make(map[string]any, len(gs.extraFields)+16)
+	maps.Copy(message, gs.extraFields)
+	message["version"] = gelfVersion
+	message["host"] = gs.host
+	message["short_message"] = aggregation.GetCommonMessage(eventObj.InvolvedObject.Kind, eventObj.Reason, eventObj.Message)
+	message["full_message"] = eventObj.Message
+	message["timestamp"] = float64(format.ResolveTimestamp(eventObj).Time.UnixMilli()) / 1000
+	message["level"] = gelfLevel(eventObj.Type)
+	message["_namespace"] = eventObj.InvolvedObject.Namespace
+	message["_kind"] = eventObj.InvolvedObject.Kind
+	message["_name"] = eventObj.InvolvedObject.Name
+	message["_uid"] = string(eventObj.InvolvedObject.UID)
+	message["_reason"] = eventObj.Reason
+	message["_type"] = eventObj.Type
+	message["_count"] = eventObj.Count
+	message["_reporting_controller"] = eventObj.ReportingController
+	message["_reporting_instance"] = eventObj.ReportingInstance
+	message["_source_component"] = eventObj.Source.Component
+	return message
+}
+
+func gelfLevel(eventType string) int {
+	switch {
+	case strings.EqualFold(eventType, corev1.EventTypeWarning):
+		return gelfLevelWarning
+	case strings.EqualFold(eventType, corev1.EventTypeNormal):
+		return gelfLevelInformational
+	}
+	return gelfLevelNotice
+}
+
+func (gs *GELFSink) compress(message []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	var writer io.WriteCloser
+	switch gs.compression {
+	case gelfCompressionGzip:
+		writer = gzip.NewWriter(&compressed)
+	case gelfCompressionZlib:
+		writer = zlib.NewWriter(&compressed)
+	default:
+		return message, nil
+	}
+	if _, err := writer.Write(message); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+// sendUDP sends message in one datagram or splits it into GELF chunks if it exceeds chunk size.
+// The socket is kept open between messages as the connection of tcp protocol
+func (gs *GELFSink) sendUDP(message []byte) error {
+	message, err := gs.compress(message)
+	if err != nil {
+		return err
+	}
+	chunks, err := gs.chunks(message)
+	if err != nil {
+		return err
+	}
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if gs.conn == nil {
+		conn, err := net.DialTimeout(gelfProtocolUDP, gs.address, gs.timeout)
+		if err != nil {
+			return fmt.Errorf("could not connect to graylog %s: %w", gs.address, err)
+		}
+		gs.conn = conn
+	}
+	for _, chunk := range chunks {
+		if _, err = gs.conn.Write(chunk); err != nil {
+			_ = gs.conn.Close()
+			gs.conn = nil
+			return fmt.Errorf("could not send message to graylog %s: %w", gs.address, err)
+		}
+	}
+	return nil
+}
+
+func (gs *GELFSink) chunks(message []byte) ([][]byte, error) {
+	if len(message) <= gs.chunkSize {
+		return [][]byte{message}, nil
+	}
+	dataSize := gs.chunkSize - gelfChunkHeaderSize
+	count := (len(message) + dataSize - 1) / dataSize
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("gelf message is too large: %d bytes", len(message))
+	}
+	messageID := make([]byte, 8)
+	if _, err := rand.Read(messageID); err != nil {
+		return nil, err
+	}
+	chunks := make([][]byte, count)
+	for i := range count {
+		chunk := make([]byte, 0, gs.chunkSize)
+		chunk = append(chunk, gelfChunkMagic...)
+		chunk = append(chunk, messageID...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, message[i*dataSize:min((i+1)*dataSize, len(message))]...)
+		chunks[i] = chunk
+	}
+	return chunks, nil
+}
+
+// sendTCP sends null-byte terminated message using persistent connection
+func (gs *GELFSink) sendTCP(message []byte) error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if gs.conn == nil {
+		conn, err := gs.dialTCP()
+		if err != nil {
+			return fmt.Errorf("could not connect to graylog %s: %w", gs.address, err)
+		}
+		gs.conn = conn
+	}
+	if err := gs.conn.SetWriteDeadline(time.Now().Add(gs.timeout)); err != nil {
+		return err
+	}
+	if _, err := gs.conn.Write(append(message, 0)); err != nil {
+		_ = gs.conn.Close()
+		gs.conn = nil
+		return fmt.Errorf("could not send message to graylog %s: %w", gs.address, err)
+	}
+	return nil
+}
+
+func (gs *GELFSink) dialTCP() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: gs.timeout}
+	if gs.tlsConfig != nil {
+		return tls.DialWithDialer(dialer, gelfProtocolTCP, gs.address, gs.tlsConfig)
+	}
+	return dialer.Dial(gelfProtocolTCP, gs.address)
+}
+
+func (gs *GELFSink) sendHTTP(message []byte) error {
+	message, err := gs.compress(message)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodPost, gs.url, bytes.NewReader(message))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if gs.compression == gelfCompressionGzip {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
+	resp, err := gs.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("could not send message to graylog %s: %w", gs.url, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("graylog %s responded with status %s", gs.url, resp.Status)
+	}
+	return nil
+}
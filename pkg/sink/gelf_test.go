@@ -0,0 +1,183 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGELFSink_Release_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	testSink, err := InitGELFSink(testSinkFilters("gelf", fmt.Sprintf(`{"protocol":"udp","address":"%s","host":"test-host","extraFields":{"cluster":"test"}}`, conn.LocalAddr().String())))
+	assert.NoError(t, err)
+	assert.NoError(t, testSink.Release(test.EventPodTracing))
+	assert.NoError(t, testSink.Release(test.EventPodTracing))
+
+	buffer := make([]byte, 65536)
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, from, err := conn.ReadFrom(buffer)
+	assert.NoError(t, err)
+	_, repeatFrom, err := conn.ReadFrom(make([]byte, 65536))
+	assert.NoError(t, err)
+	assert.Equal(t, from.String(), repeatFrom.String(), "Messages should be sent from the same socket")
+	reader, err := gzip.NewReader(bytes.NewReader(buffer[:n]))
+	assert.NoError(t, err)
+	var message map[string]any
+	assert.NoError(t, json.NewDecoder(reader).Decode(&message))
+
+	assert.Equal(t, "1.1", message["version"])
+	assert.Equal(t, "test-host", message["host"])
+	assert.Equal(t, "Back-off restarting failed container", message["short_message"])
+	assert.Equal(t, float64(4), message["level"])
+	assert.Equal(t, "tracing", message["_namespace"])
+	assert.Equal(t, "Pod", message["_kind"])
+	assert.Equal(t, "BackOff", message["_reason"])
+	assert.Equal(t, "test", message["_cluster"])
+	assert.Equal(t, float64(test.LastTs.UnixMilli())/1000, message["timestamp"])
+}
+
+func TestGELFSink_Release_UDPChunked(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	testSink, err := InitGELFSink(testSinkFilters("gelf", fmt.Sprintf(`{"protocol":"udp","address":"%s","compression":"none","chunkSize":100}`, conn.LocalAddr().String())))
+	assert.NoError(t, err)
+	assert.NoError(t, testSink.Release(test.EventPvcMonitoring))
+
+	buffer := make([]byte, 65536)
+	var chunks [][]byte
+	for {
+		assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err := conn.ReadFrom(buffer)
+		assert.NoError(t, err)
+		chunk := bytes.Clone(buffer[:n])
+		assert.True(t, n <= 100, "Chunk should not exceed chunk size")
+		assert.Equal(t, gelfChunkMagic, chunk[:2])
+		chunks = append(chunks, chunk)
+		if len(chunks) == int(chunk[11]) {
+			break
+		}
+	}
+	message := bytes.Buffer{}
+	for i, chunk := range chunks {
+		assert.Equal(t, chunks[0][2:10], chunk[2:10], "Chunks should have the same message id")
+		assert.Equal(t, byte(i), chunk[10])
+		message.Write(chunk[gelfChunkHeaderSize:])
+	}
+	var decoded map[string]any
+	assert.NoError(t, json.Unmarshal(message.Bytes(), &decoded))
+	assert.Equal(t, "storageclass not found", decoded["short_message"])
+	assert.Equal(t, test.EventPvcMonitoring.Message, decoded["full_message"])
+}
+
+func TestGELFSink_Release_TCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+	received := make(chan []byte, 2)
+	closed := make(chan struct{})
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() {
+			_ = conn.Close()
+			close(closed)
+		}()
+		reader := bufio.NewReader(conn)
+		for {
+			message, err := reader.ReadBytes(0)
+			if err != nil {
+				return
+			}
+			received <- message
+		}
+	}()
+
+	testSink, err := InitGELFSink(testSinkFilters("gelf", fmt.Sprintf(`{"protocol":"tcp","address":"%s"}`, listener.Addr().String())))
+	assert.NoError(t, err)
+	assert.NoError(t, testSink.Release(test.EventPodLogging))
+	assert.NoError(t, testSink.Release(test.EventPodTracing))
+
+	for _, expectedLevel := range []float64{6, 4} {
+		select {
+		case message := <-received:
+			var decoded map[string]any
+			assert.NoError(t, json.Unmarshal(bytes.TrimSuffix(message, []byte{0}), &decoded))
+			assert.Equal(t, expectedLevel, decoded["level"])
+		case <-time.After(5 * time.Second):
+			t.Fatal("message was not received")
+		}
+	}
+	assert.NoError(t, testSink.Close(t.Context()))
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection was not closed")
+	}
+}
+
+func TestGELFSink_Release_HTTP(t *testing.T) {
+	receiver, server := newFakeReceiver(t)
+	testSink, err := InitGELFSink(testSinkFilters("gelf", fmt.Sprintf(`{"protocol":"http","url":"%s/gelf","compression":"gzip"}`, server.URL)))
+	assert.NoError(t, err)
+	assert.NoError(t, testSink.Release(test.EventDeploymentMonitoring))
+
+	request := receiver.received()[0]
+	assert.Equal(t, "/gelf", request.path)
+	assert.Equal(t, "gzip", request.header.Get("Content-Encoding"))
+	reader, err := gzip.NewReader(bytes.NewReader(request.body))
+	assert.NoError(t, err)
+	var message map[string]any
+	assert.NoError(t, json.NewDecoder(reader).Decode(&message))
+	assert.Equal(t, "Deployment", message["_kind"])
+}
+
+func TestGELFSink_Release_HTTPS(t *testing.T) {
+	receiver := &fakeReceiver{}
+	server := httptest.NewTLSServer(receiver.handler(t))
+	defer server.Close()
+
+	testSink, err := InitGELFSink(testSinkFilters("gelf", fmt.Sprintf(`{"protocol":"http","url":"%s/gelf"}`, server.URL)))
+	assert.NoError(t, err)
+	assert.Error(t, testSink.Release(test.EventDeploymentMonitoring), "Certificate of the server should be verified")
+
+	testSink, err = InitGELFSink(testSinkFilters("gelf", fmt.Sprintf(`{"protocol":"http","url":"%s/gelf","insecureSkipVerify":true}`, server.URL)))
+	assert.NoError(t, err)
+	assert.NoError(t, testSink.Release(test.EventDeploymentMonitoring))
+	assert.Len(t, receiver.received(), 1)
+}
+
+func TestInitGELFSink_InvalidSettings(t *testing.T) {
+	for _, settings := range []string{
+		`{"protocol":"udp"}`,
+		`{"protocol":"http"}`,
+		`{"protocol":"amqp","address":"localhost:12201"}`,
+		`{"protocol":"tcp","address":"localhost:12201","compression":"gzip"}`,
+		`{"protocol":"udp","address":"localhost:12201","compression":"lz4"}`,
+		`{"protocol":"udp","address":"localhost:12201","tls":true}`,
+	} {
+		_, err := InitGELFSink(testSinkFilters("gelf", settings))
+		assert.Error(t, err, settings)
+	}
+}
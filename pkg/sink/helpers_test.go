@@ -0,0 +1,77 @@
+package sink
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/stretchr/testify/assert"
+)
+
+// testSinkFilters returns filters of the sink with the given name and settings and without match rules
+func testSinkFilters(name string, settings string) *filter.Sink {
+	return &filter.Sink{Name: name, Settings: json.RawMessage(settings)}
+}
+
+// receivedRequest is the request recorded by fakeReceiver
+type receivedRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// fakeReceiver records all requests sent by sinks over HTTP. The next failures requests are answered with 503, other
+// requests are answered by respond if it is set and with 200 otherwise
+type fakeReceiver struct {
+	mu       sync.Mutex
+	requests []receivedRequest
+	failures int
+	respond  func(w http.ResponseWriter, request receivedRequest)
+}
+
+// newFakeReceiver starts the HTTP server of the receiver, which is closed when the test ends
+func newFakeReceiver(t *testing.T) (*fakeReceiver, *httptest.Server) {
+	receiver := &fakeReceiver{}
+	server := httptest.NewServer(receiver.handler(t))
+	t.Cleanup(server.Close)
+	return receiver, server
+}
+
+func (fr *fakeReceiver) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		request := receivedRequest{method: r.Method, path: r.URL.Path, header: r.Header, body: body}
+		fr.mu.Lock()
+		defer fr.mu.Unlock()
+		fr.requests = append(fr.requests, request)
+		switch {
+		case fr.failures > 0:
+			fr.failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case fr.respond != nil:
+			fr.respond(w, request)
+		}
+	}
+}
+
+// received returns requests received so far
+func (fr *fakeReceiver) received() []receivedRequest {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	return append([]receivedRequest(nil), fr.requests...)
+}
+
+// bodies returns bodies of requests received so far
+func (fr *fakeReceiver) bodies() []string {
+	var bodies []string
+	for _, request := range fr.received() {
+		bodies = append(bodies, string(request.body))
+	}
+	return bodies
+}
@@ -0,0 +1,84 @@
+package sink
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/format"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	defaultDeliveryLagBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+	defaultQueueWaitBuckets   = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 5, 10, 30}
+)
+
+type LagSettings struct {
+	// DeliveryBuckets are upper bounds of buckets of the lag of delivery in seconds
+	DeliveryBuckets []float64 `json:"deliveryBuckets,omitempty"`
+	// QueueBuckets are upper bounds of buckets of the wait in workqueue in seconds
+	QueueBuckets []float64 `json:"queueBuckets,omitempty"`
+}
+
+// LagSink is implemented by sinks measuring how late events are delivered
+type LagSink interface {
+	// LagObserver returns nil if the lag is not measured by the sink
+	LagObserver() *LagObserver
+}
+
+// LagObserver observes the lag of delivery of events to sinks and the wait of events in workqueue
+type LagObserver struct {
+	delivery *prometheus.HistogramVec
+	queue    prometheus.Histogram
+}
+
+func newLagObserver(prefix string, settings *LagSettings) (*LagObserver, error) {
+	for _, buckets := range [][]float64{settings.DeliveryBuckets, settings.QueueBuckets} {
+		for i := 1; i < len(buckets); i++ {
+			if buckets[i] <= buckets[i-1] {
+				return nil, fmt.Errorf("buckets of lag must be in increasing order: %v", buckets)
+			}
+		}
+	}
+	return &LagObserver{
+		delivery: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    prefix + "_delivery_lag_seconds",
+			Help:    "Time from the last occurrence of kubernetes event to the end of its release by the sink",
+			Buckets: bucketsOrDefault(settings.DeliveryBuckets, defaultDeliveryLagBuckets),
+		},
+			[]string{"sink"},
+		),
+		queue: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    prefix + "_queue_wait_seconds",
+			Help:    "Time from adding kubernetes event to workqueue to the start of its processing",
+			Buckets: bucketsOrDefault(settings.QueueBuckets, defaultQueueWaitBuckets),
+		}),
+	}, nil
+}
+
+// ObserveDelivery observes the time from the last occurrence of the event to the time it is released by the sink.
+// Events without time set by the reporting controller or by API server are not observed
+func (o *LagObserver) ObserveDelivery(sinkName string, eventObj *corev1.Event, released time.Time) {
+	timestamp := format.ResolveTimestamp(eventObj)
+	if timestamp.Source == format.TimestampSourceNow {
+		return
+	}
+	o.delivery.WithLabelValues(sinkName).Observe(max(released.Sub(timestamp.Time), 0).Seconds())
+}
+
+// ObserveQueue observes the time the event waits in workqueue
+func (o *LagObserver) ObserveQueue(wait time.Duration) {
+	o.queue.Observe(wait.Seconds())
+}
+
+func (o *LagObserver) collectors() []prometheus.Collector {
+	return []prometheus.Collector{o.delivery, o.queue}
+}
+
+func bucketsOrDefault(buckets []float64, defaultBuckets []float64) []float64 {
+	if len(buckets) == 0 {
+		return defaultBuckets
+	}
+	return buckets
+}
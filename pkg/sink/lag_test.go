@@ -0,0 +1,37 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestLagObserver_ObserveDelivery(t *testing.T) {
+	observer, err := newLagObserver("kube_test_events", &LagSettings{DeliveryBuckets: []float64{1, 10}})
+	assert.NoError(t, err)
+
+	event := test.EventPodLogging.DeepCopy()
+	observer.ObserveDelivery("logs", event, event.LastTimestamp.Add(5*time.Second))
+	observer.ObserveDelivery("logs", event, event.LastTimestamp.Add(-time.Second))
+	observer.ObserveDelivery("logs", &corev1.Event{}, time.Now())
+
+	var metric dto.Metric
+	assert.NoError(t, observer.delivery.WithLabelValues("logs").(prometheus.Metric).Write(&metric))
+	assert.Equal(t, uint64(2), metric.GetHistogram().GetSampleCount(), "Events without time should not be observed")
+	assert.Equal(t, float64(5), metric.GetHistogram().GetSampleSum(), "Lag of events from the future should be zero")
+	assert.Equal(t, uint64(1), metric.GetHistogram().GetBucket()[0].GetCumulativeCount())
+}
+
+func TestInitMetricsSink_InvalidLagBuckets(t *testing.T) {
+	settings := json.RawMessage(`{"prefix":"kube_invalid_lag","lag":{"deliveryBuckets":[10,1]}}`)
+	_, err := InitMetricsSink(context.Background(), nil, &filter.Sink{Name: "metrics", Settings: settings})
+	assert.Error(t, err)
+}
@@ -2,127 +2,297 @@ package sink
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"log/slog"
-	"net"
-	"net/http"
+	"regexp"
+	"slices"
 	"strings"
-	"time"
 
 	"github.com/Netcracker/qubership-kube-events-reader/pkg/aggregation"
 	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
-	"github.com/Netcracker/qubership-kube-events-reader/pkg/utils"
 	"github.com/prometheus/client_golang/prometheus"
-	versionCollector "github.com/prometheus/client_golang/prometheus/collectors/version"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const defaultMetricsPrefix = "kube_events"
+
+var metricsPrefixValidator = regexp.MustCompile("^[a-zA-Z_:][a-zA-Z0-9_:]*$")
+
 var (
-	versionGauge   = versionCollector.NewCollector("kube_events_exporter")
-	SummaryCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: "kube_events_total",
+	summaryLabels             = []string{"kind", "event_namespace", "type"}
+	aggregatedLabels          = []string{"kind", "event_object", "event_namespace", "reason", "controller", "controller_instance", "message"}
+	reportingControllerLabels = []string{"controller", "controller_instance", "kind", "event_namespace"}
+)
+
+// eventCounters are counters of one metrics sink
+type eventCounters struct {
+	summary                    *seriesCounter
+	normal                     *seriesCounter
+	warning                    *seriesCounter
+	reportingControllerNormal  *seriesCounter
+	reportingControllerWarning *seriesCounter
+	// lag is nil if histograms of lag are not enabled
+	lag *LagObserver
+	// activeWarnings is nil if the gauge of active warnings is not enabled
+	activeWarnings *activeWarnings
+	custom         []*customMetric
+	// series is nil if the number and lifetime of series are not limited
+	series *seriesTracker
+}
+
+// counterDefinition describes the counter of eventCounters and its labels before they are dropped
+type counterDefinition struct {
+	counter **seriesCounter
+	// name is the name of the metric without prefix, it is the key of MetricsSettings.Labels
+	name   string
+	labels []string
+	new    func(labels []string) *prometheus.CounterVec
+}
+
+func newEventCounters(prefix string, settings *MetricsSettings) (*eventCounters, error) {
+	counters := &eventCounters{}
+	if settings.MaxSeries > 0 || settings.SeriesTTL.Duration > 0 {
+		counters.series = newSeriesTracker(settings.MaxSeries)
+	}
+	if settings.Lag != nil {
+		var err error
+		if counters.lag, err = newLagObserver(prefix, settings.Lag); err != nil {
+			return nil, err
+		}
+	}
+	if settings.ActiveWarnings != nil {
+		counters.activeWarnings = newActiveWarnings(prefix, settings.ActiveWarnings, counters.series)
+	}
+	for _, config := range settings.Metrics {
+		metric, err := newCustomMetric(config, counters.series)
+		if err != nil {
+			return nil, err
+		}
+		counters.custom = append(counters.custom, metric)
+	}
+	definitions := []counterDefinition{
+		{&counters.summary, "total", summaryLabels, func(labels []string) *prometheus.CounterVec {
+			return newSummaryCounter(prefix, labels)
+		}},
+		{&counters.normal, "normal_total", aggregatedLabels, func(labels []string) *prometheus.CounterVec {
+			return newAggregatedCounter(prefix, corev1.EventTypeNormal, labels)
+		}},
+		{&counters.warning, "warning_total", aggregatedLabels, func(labels []string) *prometheus.CounterVec {
+			return newAggregatedCounter(prefix, corev1.EventTypeWarning, labels)
+		}},
+		{&counters.reportingControllerNormal, "reporting_controller_normal_total", reportingControllerLabels, func(labels []string) *prometheus.CounterVec {
+			return newReportingControllerCounter(prefix, corev1.EventTypeNormal, labels)
+		}},
+		{&counters.reportingControllerWarning, "reporting_controller_warning_total", reportingControllerLabels, func(labels []string) *prometheus.CounterVec {
+			return newReportingControllerCounter(prefix, corev1.EventTypeWarning, labels)
+		}},
+	}
+	for name := range settings.Labels {
+		if !slices.ContainsFunc(definitions, func(d counterDefinition) bool { return d.name == name }) {
+			return nil, fmt.Errorf("labels cannot be configured for unknown metric %s", name)
+		}
+	}
+	for _, definition := range definitions {
+		counter, err := newSeriesCounter(definition.labels, settings.Labels[definition.name], definition.new, counters.series)
+		if err != nil {
+			return nil, fmt.Errorf("invalid labels of metric %s: %w", definition.name, err)
+		}
+		*definition.counter = counter
+	}
+	return counters, nil
+}
+
+func newSummaryCounter(prefix string, labels []string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: prefix + "_total",
 		Help: "Count of kubernetes events",
 	},
-		[]string{"kind", "event_namespace", "type"},
-	)
-	NormalCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: "kube_events_normal_total",
-		Help: "Count of kubernetes events with type normal aggregated by message",
-	},
-		[]string{"kind", "event_object", "event_namespace", "reason", "controller", "controller_instance", "message"},
+		labels,
 	)
-	WarningCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: "kube_events_warning_total",
-		Help: "Count of kubernetes events with type warning aggregated by message",
-	},
-		[]string{"kind", "event_object", "event_namespace", "reason", "controller", "controller_instance", "message"},
-	)
-	ReportingControllerNormalCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: "kube_events_reporting_controller_normal_total",
-		Help: "Count of kubernetes events with type normal",
+}
+
+func newAggregatedCounter(prefix string, eventType string, labels []string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: fmt.Sprintf("%s_%s_total", prefix, strings.ToLower(eventType)),
+		Help: fmt.Sprintf("Count of kubernetes events with type %s aggregated by message", strings.ToLower(eventType)),
 	},
-		[]string{"controller", "controller_instance", "kind", "event_namespace"},
+		labels,
 	)
-	ReportingControllerWarningCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: "kube_events_reporting_controller_warning_total",
-		Help: "Count of kubernetes events with type warning",
+}
+
+func newReportingControllerCounter(prefix string, eventType string, labels []string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: fmt.Sprintf("%s_reporting_controller_%s_total", prefix, strings.ToLower(eventType)),
+		Help: "Count of kubernetes events with type " + strings.ToLower(eventType),
 	},
-		[]string{"controller", "controller_instance", "kind", "event_namespace"},
+		labels,
 	)
-)
+}
+
+type MetricsSettings struct {
+	// Prefix of names of metrics. Each metrics sink must have unique prefix
+	Prefix string `json:"prefix,omitempty"`
+	// RemoteWrite enables pushing of metrics by Prometheus remote write protocol
+	RemoteWrite *RemoteWriteSettings `json:"remoteWrite,omitempty"`
+	// Labels configures labels by name of metric without prefix, e.g. warning_total
+	Labels map[string]MetricLabels `json:"labels,omitempty"`
+	// MaxSeries limits the number of series of all metrics of the sink with labels taken from events, including custom
+	// metrics and active warnings. Events of new series over the limit update the series with all labels set to other.
+	// Histograms of lag are not limited, as their labels are names of sinks. The number of series is not limited if it
+	// is 0
+	MaxSeries int `json:"maxSeries,omitempty"`
+	// SeriesTTL is the time after the last update the series is removed. Series never expire if it is 0
+	SeriesTTL metav1.Duration `json:"seriesTTL,omitempty"`
+	// Lag enables histograms of the lag of delivery of events to sinks and the wait of events in workqueue
+	Lag *LagSettings `json:"lag,omitempty"`
+	// ActiveWarnings enables the gauge of warnings which are still going on
+	ActiveWarnings *ActiveWarningsSettings `json:"activeWarnings,omitempty"`
+	// CountUpdates makes counters count each update of Event as one occurrence instead of the increase of its count
+	CountUpdates bool `json:"countUpdates,omitempty"`
+	// CountCacheSize is the number of events which last counts are kept to count the increase
+	CountCacheSize int `json:"countCacheSize,omitempty"`
+	// Metrics are custom metrics updated by events selected by their rules in addition to rules of the sink
+	Metrics []CustomMetric `json:"metrics,omitempty"`
+}
 
 type PrometheusMetricsSink struct {
 	*Sink
+	// registry contains metrics of the sink only, so sinks can be created and tested independently
+	registry *prometheus.Registry
+	counters *eventCounters
+	// counts is nil if each update of Event is counted as one occurrence
+	counts *countCache
+	// writer is nil if metrics are not pushed by remote write
+	writer *remoteWriter
+}
+
+func init() {
+	Register(Registration{
+		Type:     "metrics",
+		Settings: MetricsSettings{},
+		New: func(ctx context.Context, options *Options, filters *filter.Sink) (ISink, error) {
+			return InitMetricsSink(ctx, options.MetricsEndpoint, filters)
+		},
+	})
 }
 
-func InitMetricsSink(ctx context.Context, port string, metricsPath string, filters *filter.Sink, startHttpEndpoint func(context.Context, string)) (*PrometheusMetricsSink, error) {
-	if !utils.IsPortValid(port) {
-		return nil, fmt.Errorf("port is not valid for metrics endpoint. Given value: %v", port)
+// InitMetricsSink creates the sink with its own registry of metrics. The registry is exposed on the endpoint if it is set
+func InitMetricsSink(ctx context.Context, endpoint *MetricsEndpoint, filters *filter.Sink) (*PrometheusMetricsSink, error) {
+	var settings MetricsSettings
+	if err := DecodeSettings(filters, &settings); err != nil {
+		return nil, err
+	}
+	prefix := ValueOrDefault(settings.Prefix, defaultMetricsPrefix)
+	if !metricsPrefixValidator.MatchString(prefix) {
+		return nil, fmt.Errorf("metrics prefix is not valid: %s", prefix)
+	}
+	if settings.MaxSeries < 0 || settings.SeriesTTL.Duration < 0 {
+		return nil, fmt.Errorf("maxSeries and seriesTTL of metrics cannot be negative")
+	}
+	if settings.CountCacheSize < 0 {
+		return nil, fmt.Errorf("countCacheSize of metrics cannot be negative")
+	}
+	if settings.ActiveWarnings != nil && settings.ActiveWarnings.QuietPeriod.Duration < 0 {
+		return nil, fmt.Errorf("quietPeriod of active warnings cannot be negative")
+	}
+	counters, err := newEventCounters(prefix, &settings)
+	if err != nil {
+		return nil, err
+	}
+	registry := prometheus.NewRegistry()
+	for _, collector := range counters.collectors() {
+		if err := registry.Register(collector); err != nil {
+			return nil, fmt.Errorf("could not register metrics with prefix %s: %w", prefix, err)
+		}
+	}
+	var writer *remoteWriter
+	if settings.RemoteWrite != nil {
+		version := prometheus.NewRegistry()
+		version.MustRegister(versionGauge)
+		if writer, err = newRemoteWriter(settings.RemoteWrite, prometheus.Gatherers{version, registry}); err != nil {
+			return nil, err
+		}
+	}
+	if endpoint != nil {
+		if err := endpoint.addSink(registry, counters.collectors()); err != nil {
+			return nil, err
+		}
 	}
-	sink := initializeSinkWithFilters(filters)
-	registerMetrics()
-	if startHttpEndpoint == nil {
-		startMetricsEndpoint(ctx, port, metricsPath)
-	} else {
-		startHttpEndpoint(ctx, port)
+	sink := NewSinkWithFilters(filters)
+	if writer != nil {
+		go writer.run(ctx)
+	}
+	if settings.SeriesTTL.Duration > 0 {
+		go counters.series.expireIdle(ctx, settings.SeriesTTL.Duration)
+	}
+	if counters.activeWarnings != nil {
+		go counters.activeWarnings.expireQuiet(ctx)
 	}
 	aggregation.InitAggregations()
-	return &PrometheusMetricsSink{Sink: sink}, nil
+	metricsSink := &PrometheusMetricsSink{Sink: sink, registry: registry, counters: counters, writer: writer}
+	if !settings.CountUpdates {
+		metricsSink.counts = newCountCache(IntOrDefault(settings.CountCacheSize, defaultCountCacheSize))
+	}
+	return metricsSink, nil
 }
 
-func startMetricsEndpoint(ctx context.Context, port string, path string) {
-	mux := http.NewServeMux()
-	mux.Handle(path, promhttp.Handler())
-	srv := http.Server{
-		Addr:         fmt.Sprintf(":%v", port),
-		Handler:      mux,
-		WriteTimeout: time.Second * 15,
-		ReadTimeout:  time.Second * 15,
-		IdleTimeout:  time.Second * 30,
-		BaseContext: func(_ net.Listener) context.Context {
-			return ctx
-		},
+// Close pushes the last values of metrics if remote write is enabled
+func (ms *PrometheusMetricsSink) Close(ctx context.Context) error {
+	if ms.writer != nil {
+		ms.writer.push(ctx)
 	}
-	go func() {
-		exit := srv.ListenAndServe()
-		if !errors.Is(exit, http.ErrServerClosed) {
-			slog.Error(fmt.Sprintf("failed to start HTTP server. Error: %s", exit))
-		}
-	}()
+	return nil
 }
 
 func (ms *PrometheusMetricsSink) Release(eventObj *corev1.Event) error {
 	if !ms.IsEventAllowed(eventObj) {
 		return nil
 	}
-	SummaryCounter.WithLabelValues(eventObj.InvolvedObject.Kind, eventObj.InvolvedObject.Namespace, eventObj.Type).Inc()
-	message := aggregation.GetCommonMessage(eventObj.InvolvedObject.Kind, eventObj.Reason, eventObj.Message)
-	if strings.EqualFold(eventObj.Type, corev1.EventTypeNormal) {
-		ReportingControllerNormalCounter.WithLabelValues(eventObj.ReportingController, eventObj.ReportingInstance, eventObj.InvolvedObject.Kind, eventObj.InvolvedObject.Namespace).Inc()
-		NormalCounter.WithLabelValues(eventObj.InvolvedObject.Kind, eventObj.InvolvedObject.Name, eventObj.InvolvedObject.Namespace, eventObj.Reason, eventObj.ReportingController, eventObj.ReportingInstance, message).Inc()
-	} else {
-		ReportingControllerWarningCounter.WithLabelValues(eventObj.ReportingController, eventObj.ReportingInstance, eventObj.InvolvedObject.Kind, eventObj.InvolvedObject.Namespace).Inc()
-		WarningCounter.WithLabelValues(eventObj.InvolvedObject.Kind, eventObj.InvolvedObject.Name, eventObj.InvolvedObject.Namespace, eventObj.Reason, eventObj.ReportingController, eventObj.ReportingInstance, message).Inc()
+	// occurrences is the increase of count of Event since its last update, so repeats folded into one update are counted
+	occurrences := float64(1)
+	if ms.counts != nil {
+		occurrences = float64(ms.counts.delta(eventObj))
+	}
+	if occurrences > 0 {
+		ms.counters.summary.add(occurrences, eventObj.InvolvedObject.Kind, eventObj.InvolvedObject.Namespace, eventObj.Type)
+		message := aggregation.GetCommonMessage(eventObj.InvolvedObject.Kind, eventObj.Reason, eventObj.Message)
+		if strings.EqualFold(eventObj.Type, corev1.EventTypeNormal) {
+			ms.counters.reportingControllerNormal.add(occurrences, eventObj.ReportingController, eventObj.ReportingInstance, eventObj.InvolvedObject.Kind, eventObj.InvolvedObject.Namespace)
+			ms.counters.normal.add(occurrences, eventObj.InvolvedObject.Kind, eventObj.InvolvedObject.Name, eventObj.InvolvedObject.Namespace, eventObj.Reason, eventObj.ReportingController, eventObj.ReportingInstance, message)
+		} else {
+			ms.counters.reportingControllerWarning.add(occurrences, eventObj.ReportingController, eventObj.ReportingInstance, eventObj.InvolvedObject.Kind, eventObj.InvolvedObject.Namespace)
+			ms.counters.warning.add(occurrences, eventObj.InvolvedObject.Kind, eventObj.InvolvedObject.Name, eventObj.InvolvedObject.Namespace, eventObj.Reason, eventObj.ReportingController, eventObj.ReportingInstance, message)
+		}
+	}
+	if ms.counters.activeWarnings != nil {
+		ms.counters.activeWarnings.observe(eventObj)
+	}
+	for _, metric := range ms.counters.custom {
+		metric.release(eventObj)
 	}
 	return nil
 }
 
-func registerMetrics() {
-	prometheus.MustRegister(versionGauge, SummaryCounter, NormalCounter, WarningCounter, ReportingControllerNormalCounter, ReportingControllerWarningCounter)
+// Registry returns the registry of metrics of the sink
+func (ms *PrometheusMetricsSink) Registry() *prometheus.Registry {
+	return ms.registry
+}
+
+// LagObserver returns the observer of lag if it is enabled by settings of the sink
+func (ms *PrometheusMetricsSink) LagObserver() *LagObserver {
+	return ms.counters.lag
 }
 
-func UnregisterMetrics() {
-	prometheus.Unregister(versionGauge)
-	prometheus.Unregister(SummaryCounter)
-	prometheus.Unregister(NormalCounter)
-	prometheus.Unregister(WarningCounter)
-	prometheus.Unregister(ReportingControllerNormalCounter)
-	prometheus.Unregister(ReportingControllerWarningCounter)
-	SummaryCounter.Reset()
-	NormalCounter.Reset()
-	WarningCounter.Reset()
-	ReportingControllerNormalCounter.Reset()
-	ReportingControllerWarningCounter.Reset()
+func (c *eventCounters) collectors() []prometheus.Collector {
+	collectors := []prometheus.Collector{c.summary.vec, c.normal.vec, c.warning.vec, c.reportingControllerNormal.vec, c.reportingControllerWarning.vec}
+	if c.lag != nil {
+		collectors = append(collectors, c.lag.collectors()...)
+	}
+	if c.activeWarnings != nil {
+		collectors = append(collectors, c.activeWarnings.gauge)
+	}
+	for _, metric := range c.custom {
+		collectors = append(collectors, metric.collector)
+	}
+	return collectors
 }
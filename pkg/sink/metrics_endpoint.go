@@ -0,0 +1,113 @@
+package sink
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	versionCollector "github.com/prometheus/client_golang/prometheus/collectors/version"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var versionGauge = versionCollector.NewCollector("kube_events_exporter")
+
+// MetricsEndpointOptions enable collectors of the application exposed with metrics of sinks
+type MetricsEndpointOptions struct {
+	// GoCollector enables metrics of Go runtime
+	GoCollector bool
+	// ProcessCollector enables metrics of CPU, memory and file descriptors of the process
+	ProcessCollector bool
+}
+
+// MetricsEndpoint exposes metrics of the application and registries of metrics sinks on one HTTP path. It is the
+// registerer of metrics of the application. Metrics with the same name cannot be exposed by several sinks or by a sink
+// and the application
+type MetricsEndpoint struct {
+	// registry contains metrics of the application, e.g. version of the exporter or redactions
+	registry *prometheus.Registry
+	mu       sync.RWMutex
+	sinks    prometheus.Gatherers
+	// descriptors contains collectors of the application and of all exposed sinks. It is not gathered and is used to
+	// check that descriptors of all registries are unique
+	descriptors *prometheus.Registry
+}
+
+func NewMetricsEndpoint(options MetricsEndpointOptions) *MetricsEndpoint {
+	endpoint := &MetricsEndpoint{registry: prometheus.NewRegistry(), descriptors: prometheus.NewRegistry()}
+	endpoint.MustRegister(versionGauge)
+	if options.GoCollector {
+		endpoint.MustRegister(collectors.NewGoCollector())
+	}
+	if options.ProcessCollector {
+		endpoint.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	}
+	return endpoint
+}
+
+// Register registers the collector of the application. It fails if metrics of the collector are exposed by a sink
+func (e *MetricsEndpoint) Register(collector prometheus.Collector) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.descriptors.Register(collector); err != nil {
+		return err
+	}
+	if err := e.registry.Register(collector); err != nil {
+		e.descriptors.Unregister(collector)
+		return err
+	}
+	return nil
+}
+
+// MustRegister registers collectors of the application and panics on error
+func (e *MetricsEndpoint) MustRegister(collectors ...prometheus.Collector) {
+	for _, collector := range collectors {
+		if err := e.Register(collector); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Unregister removes the collector of the application
+func (e *MetricsEndpoint) Unregister(collector prometheus.Collector) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.descriptors.Unregister(collector)
+	return e.registry.Unregister(collector)
+}
+
+// addSink exposes the registry of the sink with the given collectors. Descriptors of collectors are compared with ones
+// of the application and of other sinks, so the sink is not exposed if any of its metrics is already exposed
+func (e *MetricsEndpoint) addSink(registry *prometheus.Registry, collectors []prometheus.Collector) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, collector := range collectors {
+		if err := e.descriptors.Register(collector); err != nil {
+			for _, registered := range collectors[:i] {
+				e.descriptors.Unregister(registered)
+			}
+			return fmt.Errorf("metrics of the sink are already exposed on the endpoint: %w", err)
+		}
+	}
+	e.sinks = append(e.sinks, registry)
+	return nil
+}
+
+// Gather gathers metrics of the application and all exposed sinks
+func (e *MetricsEndpoint) Gather() ([]*dto.MetricFamily, error) {
+	e.mu.RLock()
+	gatherers := append(prometheus.Gatherers{e.registry}, e.sinks...)
+	e.mu.RUnlock()
+	return gatherers.Gather()
+}
+
+// Handler serves metrics of the endpoint. Metrics which can be gathered are served even if gathering of others fails
+func (e *MetricsEndpoint) Handler() http.Handler {
+	return promhttp.HandlerFor(e, promhttp.HandlerOpts{
+		ErrorLog:      slog.NewLogLogger(slog.Default().Handler(), slog.LevelError),
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+}
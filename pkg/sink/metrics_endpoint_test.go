@@ -0,0 +1,68 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+// familyNames returns names of metric families gathered by the endpoint
+func familyNames(t *testing.T, endpoint *MetricsEndpoint) []string {
+	families, err := endpoint.Gather()
+	assert.NoError(t, err)
+	var names []string
+	for _, family := range families {
+		names = append(names, family.GetName())
+	}
+	return names
+}
+
+func TestMetricsEndpoint_Collectors(t *testing.T) {
+	names := familyNames(t, NewMetricsEndpoint(MetricsEndpointOptions{}))
+	assert.Contains(t, names, "kube_events_exporter_build_info")
+	assert.NotContains(t, names, "go_goroutines", "Metrics of Go runtime should be disabled by default")
+
+	names = familyNames(t, NewMetricsEndpoint(MetricsEndpointOptions{GoCollector: true}))
+	assert.Contains(t, names, "go_goroutines")
+}
+
+func TestMetricsEndpoint_Sinks(t *testing.T) {
+	endpoint := NewMetricsEndpoint(MetricsEndpointOptions{})
+	defaultSink, err := InitMetricsSink(context.Background(), endpoint, &filter.Sink{Name: "metrics"})
+	assert.NoError(t, err)
+	customFilters := &filter.Sink{
+		Name:     "custom",
+		Settings: json.RawMessage(`{"prefix":"kube_custom_events","metrics":[{"name":"kube_backoff_total","type":"counter"}]}`),
+	}
+	_, err = InitMetricsSink(context.Background(), endpoint, customFilters)
+	assert.NoError(t, err)
+	customFilters.Settings = json.RawMessage(`{"prefix":"kube_other_events","metrics":[{"name":"kube_backoff_total","type":"counter"}]}`)
+	_, err = InitMetricsSink(context.Background(), endpoint, customFilters)
+	assert.Error(t, err, "Custom metrics with the same name should not be exposed twice on one endpoint")
+	for _, name := range []string{"kube_events_total", "kube_events_exporter_build_info"} {
+		customFilters.Settings = json.RawMessage(`{"prefix":"kube_other_events","metrics":[{"name":"` + name + `","type":"gauge"}]}`)
+		_, err = InitMetricsSink(context.Background(), endpoint, customFilters)
+		assert.Error(t, err, "Custom metric %s should not be exposed, because metric with the same name is already exposed", name)
+	}
+	customFilters.Settings = json.RawMessage(`{"prefix":"kube_other_events"}`)
+	_, err = InitMetricsSink(context.Background(), endpoint, customFilters)
+	assert.NoError(t, err, "Descriptors of the sink failed to initialize should be released")
+	assert.Error(t, endpoint.Register(prometheus.NewCounter(prometheus.CounterOpts{Name: "kube_backoff_total", Help: "Backoffs"})),
+		"Metrics of the application should not have the same names as metrics of sinks")
+
+	assert.NoError(t, defaultSink.Release(test.EventPodTracing))
+	names := familyNames(t, endpoint)
+	assert.Contains(t, names, "kube_events_total")
+	assert.Len(t, endpoint.sinks, 3, "Registries of sinks failed to initialize should not be exposed")
+
+	families, err := defaultSink.Registry().Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		assert.NotEqual(t, "kube_events_exporter_build_info", family.GetName(), "Registry of the sink should contain its metrics only")
+	}
+}
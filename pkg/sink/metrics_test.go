@@ -2,8 +2,10 @@ package sink
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
@@ -12,11 +14,18 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// startMetricsServer serves metrics of the new endpoint by the test HTTP server
+func startMetricsServer(t *testing.T) (*MetricsEndpoint, *httptest.Server) {
+	endpoint := NewMetricsEndpoint(MetricsEndpointOptions{})
+	server := httptest.NewServer(endpoint.Handler())
+	t.Cleanup(server.Close)
+	return endpoint, server
+}
+
 func TestPrometheusMetricsSink_InitMetricsSink_Release_WithoutFilters(t *testing.T) {
 	var filtersSink = filter.Sink{}
-	testSink, err := InitMetricsSink(context.Background(), "9999", "", &filtersSink, test.StartFakeHttpServer)
-	defer test.FakeServer.Close()
-	defer UnregisterMetrics()
+	endpoint, server := startMetricsServer(t)
+	testSink, err := InitMetricsSink(context.Background(), endpoint, &filtersSink)
 	assert.NoError(t, err)
 	assert.NotNil(t, testSink)
 	assert.NotNil(t, testSink.Sink)
@@ -26,7 +35,7 @@ func TestPrometheusMetricsSink_InitMetricsSink_Release_WithoutFilters(t *testing
 		assert.NoError(t, testSink.Release(event))
 	}
 
-	resp, err := test.FakeServer.Client().Get(test.FakeServer.URL)
+	resp, err := server.Client().Get(server.URL)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 	defer func() {
@@ -51,9 +60,8 @@ func TestPrometheusMetricsSink_InitMetricsSink_Release_WithoutFilters(t *testing
 }
 
 func TestPrometheusMetricsSink_InitMetricsSink_Release_WithFilters(t *testing.T) {
-	testSink, err := InitMetricsSink(context.Background(), "9999", "", &filtersSinkMatchAndExclude, test.StartFakeHttpServer)
-	defer test.FakeServer.Close()
-	defer UnregisterMetrics()
+	endpoint, server := startMetricsServer(t)
+	testSink, err := InitMetricsSink(context.Background(), endpoint, &filtersSinkMatchAndExclude)
 	assert.NoError(t, err)
 	assert.NotNil(t, testSink)
 	assert.NotNil(t, testSink.Sink)
@@ -63,7 +71,7 @@ func TestPrometheusMetricsSink_InitMetricsSink_Release_WithFilters(t *testing.T)
 		assert.NoError(t, testSink.Release(event))
 	}
 
-	resp, err := test.FakeServer.Client().Get(test.FakeServer.URL)
+	resp, err := server.Client().Get(server.URL)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 	defer func() {
@@ -86,3 +94,116 @@ func TestPrometheusMetricsSink_InitMetricsSink_Release_WithFilters(t *testing.T)
 	assert.True(t, strings.Contains(string(responseBody), "kube_events_reporting_controller_warning_total{controller=\"kubelet\",controller_instance=\"10.10.10.10\",event_namespace=\"tracing\",kind=\"Pod\"} 1"))
 	assert.True(t, strings.Contains(string(responseBody), "kube_events_reporting_controller_warning_total{controller=\"persistentvolume-controller\",controller_instance=\"\",event_namespace=\"monitoring\",kind=\"PersistentVolumeClaim\"} 1"))
 }
+
+func TestPrometheusMetricsSink_InstancesWithPrefix(t *testing.T) {
+	endpoint, server := startMetricsServer(t)
+	defaultSink, err := InitMetricsSink(context.Background(), endpoint, &filter.Sink{Name: "metrics"})
+	assert.NoError(t, err)
+	warningsFilters := &filter.Sink{
+		Name:     "warnings",
+		Type:     "metrics",
+		Match:    []filter.EventMatch{{Type: "Warning"}},
+		Settings: json.RawMessage(`{"prefix":"kube_warnings"}`),
+	}
+	warningsSink, err := InitMetricsSink(context.Background(), endpoint, warningsFilters)
+	assert.NoError(t, err)
+	_, err = InitMetricsSink(context.Background(), endpoint, warningsFilters)
+	assert.Error(t, err, "Metrics with the same prefix should not be exposed twice on one endpoint")
+	_, err = InitMetricsSink(context.Background(), NewMetricsEndpoint(MetricsEndpointOptions{}), warningsFilters)
+	assert.NoError(t, err, "Metrics with the same prefix can be exposed on different endpoints")
+
+	for _, event := range test.TestEventsSlice {
+		assert.NoError(t, defaultSink.Release(event))
+		assert.NoError(t, warningsSink.Release(event))
+	}
+
+	resp, err := server.Client().Get(server.URL)
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, resp.Body.Close())
+	}()
+	responseBody, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(responseBody), "kube_events_total{event_namespace=\"logging\",kind=\"Pod\",type=\"Normal\"} 1")
+	assert.Contains(t, string(responseBody), "kube_warnings_total{event_namespace=\"tracing\",kind=\"Pod\",type=\"Warning\"} 1")
+	assert.NotContains(t, string(responseBody), "kube_warnings_total{event_namespace=\"logging\"")
+	assert.Contains(t, string(responseBody), "kube_warnings_warning_total{")
+}
+
+func TestInitMetricsSink_InvalidPrefix(t *testing.T) {
+	_, err := InitMetricsSink(context.Background(), nil, &filter.Sink{Name: "metrics", Settings: json.RawMessage(`{"prefix":"kube-events"}`)})
+	assert.Error(t, err)
+}
+
+func TestPrometheusMetricsSink_Labels(t *testing.T) {
+	filters := &filter.Sink{
+		Name: "metrics",
+		Settings: json.RawMessage(`{"prefix":"kube_limited_events","maxSeries":100,"seriesTTL":"1h",` +
+			`"labels":{"warning_total":{"drop":["event_object","controller_instance"],"replace":{"message":{"replacement":"any"}}}}}`),
+	}
+	testSink, err := InitMetricsSink(context.Background(), nil, filters)
+	assert.NoError(t, err)
+	for _, event := range test.TestEventsSlice {
+		assert.NoError(t, testSink.Release(event))
+	}
+
+	families, err := testSink.Registry().Gather()
+	assert.NoError(t, err)
+	var warnings []string
+	for _, family := range families {
+		if family.GetName() != "kube_limited_events_warning_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			var labels []string
+			for _, label := range metric.GetLabel() {
+				labels = append(labels, label.GetName()+"="+label.GetValue())
+			}
+			warnings = append(warnings, strings.Join(labels, ","))
+		}
+	}
+	assert.ElementsMatch(t, []string{
+		"controller=deployment-controller,event_namespace=monitoring,kind=Deployment,message=any,reason=BackOff",
+		"controller=persistentvolume-controller,event_namespace=monitoring,kind=PersistentVolumeClaim,message=any,reason=ProvisioningFailed",
+		"controller=kubelet,event_namespace=tracing,kind=Pod,message=any,reason=BackOff",
+	}, warnings)
+}
+
+func TestInitMetricsSink_InvalidLabels(t *testing.T) {
+	for _, settings := range []string{
+		`{"labels":{"unknown_total":{"drop":["kind"]}}}`,
+		`{"labels":{"warning_total":{"drop":["pod"]}}}`,
+		`{"maxSeries":-1}`,
+	} {
+		_, err := InitMetricsSink(context.Background(), nil, &filter.Sink{Name: "metrics", Settings: json.RawMessage(settings)})
+		assert.Error(t, err, settings)
+	}
+}
+
+func TestPrometheusMetricsSink_Release_CountDeltas(t *testing.T) {
+	for _, tc := range []struct {
+		settings string
+		expected string
+	}{
+		{`{"prefix":"kube_delta_events"}`, `kube_delta_events_warning_total{controller="kubelet",controller_instance="10.10.10.10",event_namespace="tracing",event_object="test-pod",kind="Pod",message="Back-off restarting failed container",reason="BackOff"} 5`},
+		{`{"prefix":"kube_updates_events","countUpdates":true}`, `kube_updates_events_warning_total{controller="kubelet",controller_instance="10.10.10.10",event_namespace="tracing",event_object="test-pod",kind="Pod",message="Back-off restarting failed container",reason="BackOff"} 3`},
+	} {
+		endpoint, server := startMetricsServer(t)
+		testSink, err := InitMetricsSink(context.Background(), endpoint, &filter.Sink{Name: "metrics", Settings: json.RawMessage(tc.settings)})
+		assert.NoError(t, err)
+
+		event := test.EventPodTracing.DeepCopy()
+		event.UID = "b7d9e1a2-5c1f-4b8e-9a3d-2f6c7e8d9a01"
+		for _, count := range []int32{3, 3, 7} {
+			event.Count = count
+			assert.NoError(t, testSink.Release(event))
+		}
+
+		resp, err := server.Client().Get(server.URL)
+		assert.NoError(t, err)
+		responseBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Body.Close())
+		assert.Contains(t, string(responseBody), tc.expected, tc.settings)
+	}
+}
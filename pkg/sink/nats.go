@@ -0,0 +1,256 @@
+package sink
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/format"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	natsSinkName = "nats"
+
+	defaultNATSSubject = "k8s.events.{{.InvolvedObject.Namespace}}.{{.Type}}"
+	defaultNATSTimeout = 10 * time.Second
+	// defaultNATSFlushInterval is the interval of flushing messages published without JetStream
+	defaultNATSFlushInterval = time.Second
+	// natsEmptyToken replaces empty tokens of subject, e.g. namespace of cluster-scoped objects
+	natsEmptyToken = "_"
+)
+
+type NATSSettings struct {
+	// URL of NATS server. Several servers can be separated by comma
+	URL string `json:"url"`
+	// Subject is a template of the subject of events
+	Subject string `json:"subject,omitempty"`
+	// JetStream enables publishing to JetStream with waiting for the acknowledgement
+	JetStream bool `json:"jetStream,omitempty"`
+	// Stream is the expected name of the stream. Publish fails if the subject is bound to another stream
+	Stream string `json:"stream,omitempty"`
+	// CredsFile is path to the user credentials file with JWT and NKey seed
+	CredsFile string `json:"credsFile,omitempty"`
+	// NKeySeedFile is path to the file with NKey seed
+	NKeySeedFile       string          `json:"nkeySeedFile,omitempty"`
+	Username           string          `json:"username,omitempty"`
+	Password           string          `json:"password,omitempty"`
+	PasswordFile       string          `json:"passwordFile,omitempty"`
+	Token              string          `json:"token,omitempty"`
+	TokenFile          string          `json:"tokenFile,omitempty"`
+	TLS                bool            `json:"tls,omitempty"`
+	CAFile             string          `json:"caFile,omitempty"`
+	CertFile           string          `json:"certFile,omitempty"`
+	KeyFile            string          `json:"keyFile,omitempty"`
+	InsecureSkipVerify bool            `json:"insecureSkipVerify,omitempty"`
+	Timeout            metav1.Duration `json:"timeout,omitempty"`
+	// FlushInterval is the interval of flushing messages to the server if JetStream is not enabled
+	FlushInterval metav1.Duration `json:"flushInterval,omitempty"`
+}
+
+type NATSSink struct {
+	*Sink
+	subject *template.Template
+	timeout time.Duration
+	conn    *nats.Conn
+	// closed is closed when the connection is closed after Close drains it
+	closed    chan struct{}
+	jetStream jetstream.JetStream
+	stream    string
+}
+
+func init() {
+	Register(Registration{
+		Type:     natsSinkName,
+		Settings: NATSSettings{},
+		New: func(_ context.Context, _ *Options, filters *filter.Sink) (ISink, error) {
+			return InitNATSSink(filters)
+		},
+	})
+}
+
+func InitNATSSink(filters *filter.Sink) (*NATSSink, error) {
+	var settings NATSSettings
+	if err := DecodeSettings(filters, &settings); err != nil {
+		return nil, err
+	}
+	if len(settings.URL) == 0 {
+		return nil, fmt.Errorf("url must be configured for nats sink")
+	}
+	subject, err := format.ParseEventTemplate(natsSinkName, ValueOrDefault(settings.Subject, defaultNATSSubject))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse subject template of nats sink: %w", err)
+	}
+	timeout := DurationOrDefault(settings.Timeout, defaultNATSTimeout)
+	options, err := natsOptions(&settings, timeout)
+	if err != nil {
+		return nil, err
+	}
+	closed := make(chan struct{})
+	options = append(options, nats.ClosedHandler(func(*nats.Conn) { close(closed) }))
+	conn, err := nats.Connect(settings.URL, options...)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to nats %s: %w", settings.URL, err)
+	}
+	natsSink := &NATSSink{
+		Sink:    NewSinkWithFilters(filters),
+		subject: subject,
+		timeout: timeout,
+		conn:    conn,
+		closed:  closed,
+		stream:  settings.Stream,
+	}
+	if settings.JetStream {
+		if natsSink.jetStream, err = jetstream.New(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	} else {
+		go natsSink.run(DurationOrDefault(settings.FlushInterval, defaultNATSFlushInterval))
+	}
+	return natsSink, nil
+}
+
+// Close drains the connection, so published messages are flushed, and waits until the connection is closed
+func (ns *NATSSink) Close(ctx context.Context) error {
+	if err := ns.conn.Drain(); err != nil {
+		return fmt.Errorf("could not drain connection to nats: %w", err)
+	}
+	select {
+	case <-ns.closed:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("connection to nats is not drained: %w", ctx.Err())
+	}
+}
+
+// run flushes messages published without JetStream every interval until the connection is closed
+func (ns *NATSSink) run(flushInterval time.Duration) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ns.closed:
+			return
+		case <-ticker.C:
+			if err := ns.conn.FlushTimeout(ns.timeout); err != nil && !ns.conn.IsClosed() {
+				slog.Warn("could not flush messages to nats", "error", err)
+			}
+		}
+	}
+}
+
+func natsOptions(settings *NATSSettings, timeout time.Duration) ([]nats.Option, error) {
+	options := []nats.Option{
+		nats.Name("qubership-kube-events-reader"),
+		nats.Timeout(timeout),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				slog.Warn("disconnected from nats", "error", err)
+			}
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			slog.Info("reconnected to nats", "url", conn.ConnectedUrlRedacted())
+		}),
+	}
+	switch {
+	case len(settings.CredsFile) > 0:
+		options = append(options, nats.UserCredentials(settings.CredsFile))
+	case len(settings.NKeySeedFile) > 0:
+		nkey, err := nats.NkeyOptionFromSeed(settings.NKeySeedFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read nkey seed for nats sink: %w", err)
+		}
+		options = append(options, nkey)
+	case len(settings.Username) > 0:
+		password := settings.Password
+		if len(settings.PasswordFile) > 0 {
+			var err error
+			if password, err = ReadSecretFile(settings.PasswordFile); err != nil {
+				return nil, err
+			}
+		}
+		options = append(options, nats.UserInfo(settings.Username, password))
+	case len(settings.Token) > 0 || len(settings.TokenFile) > 0:
+		token := settings.Token
+		if len(settings.TokenFile) > 0 {
+			var err error
+			if token, err = ReadSecretFile(settings.TokenFile); err != nil {
+				return nil, err
+			}
+		}
+		options = append(options, nats.Token(token))
+	}
+	if settings.TLS || len(settings.CAFile) > 0 || len(settings.CertFile) > 0 {
+		options = append(options, nats.Secure(&tls.Config{InsecureSkipVerify: settings.InsecureSkipVerify})) // #nosec G402 -- configured explicitly by user
+	}
+	if len(settings.CAFile) > 0 {
+		options = append(options, nats.RootCAs(settings.CAFile))
+	}
+	if len(settings.CertFile) > 0 {
+		options = append(options, nats.ClientCert(settings.CertFile, settings.KeyFile))
+	}
+	return options, nil
+}
+
+// Release publishes event to NATS. If JetStream is enabled, it waits for the acknowledgement from the stream,
+// otherwise the message is written to the buffer of the connection, which is flushed by flush interval and on Close.
+// Error is returned if publish fails, so the controller releases the event to this sink again
+func (ns *NATSSink) Release(eventObj *corev1.Event) error {
+	if !ns.IsEventAllowed(eventObj) {
+		return nil
+	}
+	subject, err := ns.renderSubject(eventObj)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(eventObj)
+	if err != nil {
+		return err
+	}
+	message := &nats.Msg{Subject: subject, Data: data}
+	if ns.jetStream == nil {
+		if err = ns.conn.PublishMsg(message); err != nil {
+			return fmt.Errorf("could not publish event to nats subject %s: %w", subject, err)
+		}
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ns.timeout)
+	defer cancel()
+	// Message ID allows JetStream to discard duplicates if the event is re-sent after lost acknowledgement
+	options := []jetstream.PublishOpt{jetstream.WithMsgID(fmt.Sprintf("%s.%s", eventObj.UID, eventObj.ResourceVersion))}
+	if len(ns.stream) > 0 {
+		options = append(options, jetstream.WithExpectStream(ns.stream))
+	}
+	if _, err = ns.jetStream.PublishMsg(ctx, message, options...); err != nil {
+		return fmt.Errorf("could not publish event to jetstream subject %s: %w", subject, err)
+	}
+	return nil
+}
+
+// renderSubject executes subject template and makes the result a valid subject:
+// whitespaces are removed and empty tokens are replaced with "_"
+func (ns *NATSSink) renderSubject(eventObj *corev1.Event) (string, error) {
+	subject := strings.Builder{}
+	if err := ns.subject.Execute(&subject, eventObj); err != nil {
+		return "", fmt.Errorf("could not render nats subject: %w", err)
+	}
+	tokens := strings.Split(strings.Join(strings.Fields(subject.String()), ""), ".")
+	for i, token := range tokens {
+		if len(token) == 0 {
+			tokens[i] = natsEmptyToken
+		}
+	}
+	return strings.Join(tokens, "."), nil
+}
@@ -0,0 +1,203 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+type natsMessage struct {
+	subject string
+	headers string
+	data    []byte
+}
+
+// fakeNATSServer implements the part of NATS client protocol used by publishers.
+// Publishes with reply subject are answered with JetStream acknowledgement
+type fakeNATSServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	messages []natsMessage
+	connect  map[string]any
+}
+
+func newFakeNATSServer(t *testing.T) *fakeNATSServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := &fakeNATSServer{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(t, conn)
+		}
+	}()
+	return server
+}
+
+func (fs *fakeNATSServer) url() string {
+	return "nats://" + fs.listener.Addr().String()
+}
+
+func (fs *fakeNATSServer) close() {
+	_ = fs.listener.Close()
+}
+
+func (fs *fakeNATSServer) received() []natsMessage {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]natsMessage{}, fs.messages...)
+}
+
+func (fs *fakeNATSServer) serve(t *testing.T, conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	subscriptions := map[string]string{}
+	reader := bufio.NewReader(conn)
+	_, _ = fmt.Fprintf(conn, "INFO {\"server_id\":\"test\",\"version\":\"2.10.0\",\"proto\":1,\"headers\":true,\"max_payload\":1048576}\r\n")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "CONNECT":
+			var connect map[string]any
+			assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(line), fields[0])), &connect))
+			fs.mu.Lock()
+			fs.connect = connect
+			fs.mu.Unlock()
+		case "PING":
+			_, _ = conn.Write([]byte("PONG\r\n"))
+		case "SUB":
+			subscriptions[fields[1]] = fields[len(fields)-1]
+		case "PUB", "HPUB":
+			message := natsMessage{subject: fields[1]}
+			var reply string
+			headersSize := 0
+			if fields[0] == "HPUB" {
+				headersSize, _ = strconv.Atoi(fields[len(fields)-2])
+			}
+			if len(fields) == 4 && fields[0] == "PUB" || len(fields) == 5 {
+				reply = fields[2]
+			}
+			totalSize, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, totalSize+2)
+			if _, err = io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			message.headers = string(payload[:headersSize])
+			message.data = payload[headersSize:totalSize]
+			fs.mu.Lock()
+			fs.messages = append(fs.messages, message)
+			fs.mu.Unlock()
+			if len(reply) > 0 {
+				ack := fmt.Sprintf(`{"stream":"EVENTS","seq":%d}`, len(fs.received()))
+				sid := subscriptions[reply[:strings.LastIndex(reply, ".")]+".*"]
+				_, _ = fmt.Fprintf(conn, "MSG %s %s %d\r\n%s\r\n", reply, sid, len(ack), ack)
+			}
+		}
+	}
+}
+
+func TestNATSSink_Release(t *testing.T) {
+	server := newFakeNATSServer(t)
+	defer server.close()
+
+	testSink, err := InitNATSSink(testSinkFilters("nats", fmt.Sprintf(`{"url":"%s","username":"user","password":"secret","flushInterval":"10ms"}`, server.url())))
+	assert.NoError(t, err)
+	assert.NoError(t, testSink.Release(test.EventPodTracing))
+	assert.NoError(t, testSink.Release(test.EventPodLogging))
+
+	assert.Eventually(t, func() bool { return len(server.received()) == 2 }, time.Second, 10*time.Millisecond,
+		"Messages should be flushed by flush interval")
+	messages := server.received()
+	assert.Equal(t, "k8s.events.tracing.Warning", messages[0].subject)
+	assert.Equal(t, "k8s.events.logging.Normal", messages[1].subject)
+	var event corev1.Event
+	assert.NoError(t, json.Unmarshal(messages[0].data, &event))
+	assert.Equal(t, test.EventPodTracing.Message, event.Message)
+	assert.NoError(t, testSink.Close(t.Context()))
+	assert.True(t, testSink.conn.IsClosed(), "Connection should be closed after it is drained")
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Equal(t, "user", server.connect["user"])
+	assert.Equal(t, "secret", server.connect["pass"])
+}
+
+func TestNATSSink_Close_Flushes(t *testing.T) {
+	server := newFakeNATSServer(t)
+	defer server.close()
+
+	testSink, err := InitNATSSink(testSinkFilters("nats", fmt.Sprintf(`{"url":"%s","flushInterval":"1h"}`, server.url())))
+	assert.NoError(t, err)
+	assert.NoError(t, testSink.Release(test.EventPodTracing))
+	assert.NoError(t, testSink.Release(test.EventPodLogging))
+	assert.NoError(t, testSink.Close(t.Context()))
+
+	assert.Len(t, server.received(), 2, "Messages should be flushed when the sink is closed")
+}
+
+func TestNATSSink_Release_JetStream(t *testing.T) {
+	server := newFakeNATSServer(t)
+	defer server.close()
+
+	testSink, err := InitNATSSink(testSinkFilters("nats", fmt.Sprintf(`{"url":"%s","subject":"events.{{.Reason}}","jetStream":true,"stream":"EVENTS"}`, server.url())))
+	assert.NoError(t, err)
+	assert.NoError(t, testSink.Release(test.EventPodTracing))
+
+	messages := server.received()
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "events.BackOff", messages[0].subject)
+	assert.Contains(t, messages[0].headers, "Nats-Msg-Id: "+string(test.EventPodTracing.UID))
+	assert.Contains(t, messages[0].headers, "Nats-Expected-Stream: EVENTS")
+}
+
+func TestNATSSink_Release_Error(t *testing.T) {
+	server := newFakeNATSServer(t)
+	testSink, err := InitNATSSink(testSinkFilters("nats", fmt.Sprintf(`{"url":"%s","jetStream":true,"timeout":"100ms"}`, server.url())))
+	assert.NoError(t, err)
+	server.close()
+	testSink.conn.Close()
+
+	assert.Error(t, testSink.Release(test.EventPodTracing))
+}
+
+func TestNATSSink_RenderSubject(t *testing.T) {
+	testSink, err := InitNATSSink(testSinkFilters("nats", `{"url":"nats://127.0.0.1:1","subject":"k8s.events.{{.InvolvedObject.Namespace}}.{{.InvolvedObject.Kind}} {{.Type}}","timeout":"100ms"}`))
+	assert.NoError(t, err)
+	event := test.EventPodTracing.DeepCopy()
+	event.InvolvedObject.Namespace = ""
+	subject, err := testSink.renderSubject(event)
+	assert.NoError(t, err)
+	assert.Equal(t, "k8s.events._.PodWarning", subject)
+}
+
+func TestInitNATSSink_InvalidSettings(t *testing.T) {
+	for _, settings := range []string{
+		`{"subject":"events"}`,
+		`{"url":"nats://localhost:4222","subject":"{{.Unknown"}`,
+		`{"url":"nats://localhost:4222","nkeySeedFile":"/not/existing/file"}`,
+	} {
+		_, err := InitNATSSink(testSinkFilters("nats", settings))
+		assert.Error(t, err, settings)
+	}
+}
@@ -0,0 +1,132 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+)
+
+// Options contains parameters of command line that are passed to all sinks
+type Options struct {
+	PrintFormat string
+	// MetricsEndpoint exposes registries of metrics sinks, metrics are not exposed if it is nil
+	MetricsEndpoint *MetricsEndpoint
+}
+
+// Factory creates a sink with the given filters and settings. Sinks should stop background work when ctx is done
+type Factory func(ctx context.Context, options *Options, filters *filter.Sink) (ISink, error)
+
+// Registration describes a type of sink that can be used as output
+type Registration struct {
+	// Type is the value of output parameter and the name of the sink in filters configuration
+	Type string
+	// Settings is a zero value of the structure of `settings` of the sink or nil if the sink has no settings.
+	// It is used to validate filters configuration before sinks are created
+	Settings any
+	New      Factory
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]*Registration{}
+)
+
+// Register makes the type of sink available as output. It is usually called from init function of the package
+// with the sink, so third party sinks are added by importing their package. Register panics if the type is already
+// registered or the registration is incomplete
+func Register(registration Registration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if len(registration.Type) == 0 || registration.New == nil {
+		panic("sink: type and constructor must be set in registration")
+	}
+	if _, ok := registry[registration.Type]; ok {
+		panic(fmt.Sprintf("sink: type %s is registered twice", registration.Type))
+	}
+	registry[registration.Type] = &registration
+}
+
+// Types returns sorted list of registered types of sinks
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return slices.Sorted(maps.Keys(registry))
+}
+
+func lookup(sinkType string) (*Registration, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	registration, ok := registry[sinkType]
+	if !ok {
+		return nil, fmt.Errorf("sink type %s is not registered. Available types: %s", sinkType, strings.Join(slices.Sorted(maps.Keys(registry)), ", "))
+	}
+	return registration, nil
+}
+
+// New creates a sink of the registered type
+func New(ctx context.Context, sinkType string, options *Options, filters *filter.Sink) (ISink, error) {
+	registration, err := lookup(sinkType)
+	if err != nil {
+		return nil, err
+	}
+	if options == nil {
+		options = &Options{}
+	}
+	return registration.New(ctx, options, filters)
+}
+
+// ValidateFilters checks that names of sinks of filters configuration are unique, their types are registered
+// and their settings match the schema of the type
+func ValidateFilters(filters *filter.Filters) error {
+	if filters == nil {
+		return nil
+	}
+	names := map[string]bool{}
+	for _, sinkFilters := range filters.Sinks {
+		if len(sinkFilters.Name) == 0 {
+			return fmt.Errorf("name must be set for each sink")
+		}
+		if names[sinkFilters.Name] {
+			return fmt.Errorf("sink name %s is used more than once", sinkFilters.Name)
+		}
+		names[sinkFilters.Name] = true
+		registration, err := lookup(sinkFilters.GetType())
+		if err != nil {
+			return err
+		}
+		if len(sinkFilters.Settings) == 0 {
+			continue
+		}
+		if registration.Settings == nil {
+			return fmt.Errorf("sink %s does not support settings", sinkFilters.Name)
+		}
+		settings := reflect.New(reflect.TypeOf(registration.Settings)).Interface()
+		if err = DecodeSettings(sinkFilters, settings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OutputsFlag is a command line flag with types of sinks. Only registered types are accepted
+type OutputsFlag []string
+
+func (o *OutputsFlag) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *OutputsFlag) Set(value string) error {
+	if _, err := lookup(value); err != nil {
+		return fmt.Errorf("output value is not valid. Got string: %s", value)
+	}
+	if !slices.Contains(*o, value) {
+		*o = append(*o, value)
+	}
+	return nil
+}
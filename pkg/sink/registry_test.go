@@ -0,0 +1,115 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+type testSettings struct {
+	Value string `json:"value"`
+}
+
+type testSink struct {
+	*Sink
+	value string
+}
+
+func (ts *testSink) Release(_ *corev1.Event) error {
+	return nil
+}
+
+func TestRegister(t *testing.T) {
+	Register(Registration{
+		Type:     "test-registry",
+		Settings: testSettings{},
+		New: func(_ context.Context, _ *Options, filters *filter.Sink) (ISink, error) {
+			var settings testSettings
+			if err := DecodeSettings(filters, &settings); err != nil {
+				return nil, err
+			}
+			return &testSink{Sink: NewSinkWithFilters(filters), value: settings.Value}, nil
+		},
+	})
+	defer Unregister("test-registry")
+	assert.Contains(t, Types(), "test-registry")
+	assert.Panics(t, func() {
+		Register(Registration{Type: "test-registry", New: func(context.Context, *Options, *filter.Sink) (ISink, error) { return nil, nil }})
+	})
+
+	created, err := New(t.Context(), "test-registry", nil, testSinkFilters("test-registry", `{"value":"configured"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "configured", created.(*testSink).value)
+}
+
+func TestTypes(t *testing.T) {
+	assert.Equal(t, []string{"alertmanager", "chat", "cloudevents", "forward", "gelf", "logs", "metrics", "nats", "s3", "splunk-hec", "statsd"}, Types())
+}
+
+func TestNew_NotRegistered(t *testing.T) {
+	_, err := New(t.Context(), "unknown", nil, nil)
+	assert.ErrorContains(t, err, "sink type unknown is not registered")
+}
+
+func TestNew_Logs(t *testing.T) {
+	created, err := New(t.Context(), "logs", &Options{}, nil)
+	assert.NoError(t, err)
+	assert.IsType(t, &StdoutSink{}, created)
+	assert.NoError(t, created.Release(test.EventPodLogging))
+}
+
+func TestValidateFilters(t *testing.T) {
+	Register(Registration{
+		Type: "test-no-settings",
+		New:  func(context.Context, *Options, *filter.Sink) (ISink, error) { return nil, nil },
+	})
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "test-no-settings")
+		registryMu.Unlock()
+	}()
+	assert.NoError(t, ValidateFilters(nil))
+	assert.NoError(t, ValidateFilters(&filter.Filters{Sinks: []*filter.Sink{
+		{Name: "logs"},
+		{Name: "warnings", Type: "logs", Settings: json.RawMessage(`{"format":"cloudevents"}`)},
+		{Name: "statsd", Settings: json.RawMessage(`{"address":"localhost:8125"}`)},
+	}}))
+	for _, sinks := range [][]*filter.Sink{
+		{{Name: "unknown"}},
+		{{Name: "warnings", Type: "unknown"}},
+		{{Type: "logs"}},
+		{{Name: "logs"}, {Name: "logs", Type: "logs"}},
+		{{Name: "statsd", Settings: json.RawMessage(`{"unknownField":"value"}`)}},
+		{{Name: "test-no-settings", Type: "test-no-settings", Settings: json.RawMessage(`{"value":"test"}`)}},
+	} {
+		assert.Error(t, ValidateFilters(&filter.Filters{Sinks: sinks}), sinks[0].Name)
+	}
+}
+
+func TestOutputsFlag_Set(t *testing.T) {
+	outputs := OutputsFlag{}
+	assert.NoError(t, outputs.Set("metrics"))
+	assert.Equal(t, 1, len(outputs))
+	err := outputs.Set("logs1")
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "output value is not valid"))
+	assert.Equal(t, 1, len(outputs))
+	assert.NoError(t, outputs.Set("metrics"))
+	assert.Equal(t, 1, len(outputs))
+	assert.NoError(t, outputs.Set("statsd"))
+	assert.Equal(t, 2, len(outputs))
+}
+
+func TestOutputsFlag_String(t *testing.T) {
+	outputs := OutputsFlag{}
+	assert.NoError(t, outputs.Set("metrics"))
+	assert.NoError(t, outputs.Set("logs"))
+	assert.NoError(t, outputs.Set("metrics"))
+	assert.Equal(t, "metrics,logs", outputs.String())
+}
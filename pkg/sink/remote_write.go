@@ -0,0 +1,260 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	remoteWriteName    = "remote-write"
+	remoteWriteVersion = "0.1.0"
+
+	defaultRemoteWriteInterval   = 30 * time.Second
+	defaultRemoteWriteMaxRetries = 3
+	defaultRemoteWriteTimeout    = 30 * time.Second
+)
+
+// Field numbers of messages of Prometheus remote write protocol v1 (prometheus.WriteRequest)
+const (
+	writeRequestTimeseriesField = 1
+	timeSeriesLabelsField       = 1
+	timeSeriesSamplesField      = 2
+	labelNameField              = 1
+	labelValueField             = 2
+	sampleValueField            = 1
+	sampleTimestampField        = 2
+)
+
+type RemoteWriteSettings struct {
+	// URL of remote write endpoint, e.g. http://victoriametrics:8428/api/v1/write
+	URL      string          `json:"url"`
+	Interval metav1.Duration `json:"interval,omitempty"`
+	// ExternalLabels are added to all series. Labels of series take precedence over them
+	ExternalLabels     map[string]string `json:"externalLabels,omitempty"`
+	Username           string            `json:"username,omitempty"`
+	Password           string            `json:"password,omitempty"`
+	PasswordFile       string            `json:"passwordFile,omitempty"`
+	BearerToken        string            `json:"bearerToken,omitempty"`
+	BearerTokenFile    string            `json:"bearerTokenFile,omitempty"`
+	Headers            map[string]string `json:"headers,omitempty"`
+	MaxRetries         int               `json:"maxRetries,omitempty"`
+	InsecureSkipVerify bool              `json:"insecureSkipVerify,omitempty"`
+	Timeout            metav1.Duration   `json:"timeout,omitempty"`
+}
+
+// remoteWriter periodically pushes all series of the gatherer by Prometheus remote write protocol
+type remoteWriter struct {
+	url            string
+	interval       time.Duration
+	externalLabels map[string]string
+	username       string
+	password       string
+	bearerToken    string
+	headers        map[string]string
+	maxRetries     int
+	client         *http.Client
+	gatherer       prometheus.Gatherer
+}
+
+type remoteWriteLabel struct {
+	name  string
+	value string
+}
+
+func newRemoteWriter(settings *RemoteWriteSettings, gatherer prometheus.Gatherer) (*remoteWriter, error) {
+	if len(settings.URL) == 0 {
+		return nil, fmt.Errorf("url must be configured for remote write")
+	}
+	password := settings.Password
+	if len(settings.PasswordFile) > 0 {
+		var err error
+		if password, err = ReadSecretFile(settings.PasswordFile); err != nil {
+			return nil, err
+		}
+	}
+	bearerToken := settings.BearerToken
+	if len(settings.BearerTokenFile) > 0 {
+		var err error
+		if bearerToken, err = ReadSecretFile(settings.BearerTokenFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(settings.Username) > 0 && len(bearerToken) > 0 {
+		return nil, fmt.Errorf("only one of basic auth and bearer token can be configured for remote write")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: settings.InsecureSkipVerify} // #nosec G402 -- configured explicitly by user
+	return &remoteWriter{
+		url:            settings.URL,
+		interval:       DurationOrDefault(settings.Interval, defaultRemoteWriteInterval),
+		externalLabels: settings.ExternalLabels,
+		username:       settings.Username,
+		password:       password,
+		bearerToken:    bearerToken,
+		headers:        settings.Headers,
+		maxRetries:     IntOrDefault(settings.MaxRetries, defaultRemoteWriteMaxRetries),
+		client:         &http.Client{Timeout: DurationOrDefault(settings.Timeout, defaultRemoteWriteTimeout), Transport: transport},
+		gatherer:       gatherer,
+	}, nil
+}
+
+// run pushes series every interval until the context is done. The last values are pushed by Close of the sink
+func (rw *remoteWriter) run(ctx context.Context) {
+	ticker := time.NewTicker(rw.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rw.push(ctx)
+		}
+	}
+}
+
+func (rw *remoteWriter) push(ctx context.Context) {
+	families, err := rw.gatherer.Gather()
+	if err != nil {
+		slog.Error("could not gather metrics for remote write", "error", err)
+		return
+	}
+	body := snappy.Encode(nil, rw.encode(families, time.Now()))
+	if err = sendWithRetries(ctx, remoteWriteName, rw.maxRetries, func() error { return rw.send(ctx, body) }); err != nil {
+		slog.Error("could not push metrics by remote write", "url", rw.url, "error", err)
+	}
+}
+
+// encode converts metric families to protobuf encoded WriteRequest. Histograms and summaries are converted
+// to the same series as exposed in text format
+func (rw *remoteWriter) encode(families []*dto.MetricFamily, now time.Time) []byte {
+	timestamp := now.UnixMilli()
+	var request []byte
+	appendSeries := func(name string, metric *dto.Metric, value float64, extraLabels ...remoteWriteLabel) {
+		labels := rw.labels(name, metric, extraLabels)
+		var series []byte
+		for _, label := range labels {
+			var encodedLabel []byte
+			encodedLabel = protowire.AppendTag(encodedLabel, labelNameField, protowire.BytesType)
+			encodedLabel = protowire.AppendString(encodedLabel, label.name)
+			encodedLabel = protowire.AppendTag(encodedLabel, labelValueField, protowire.BytesType)
+			encodedLabel = protowire.AppendString(encodedLabel, label.value)
+			series = protowire.AppendTag(series, timeSeriesLabelsField, protowire.BytesType)
+			series = protowire.AppendBytes(series, encodedLabel)
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, sampleValueField, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(value))
+		sample = protowire.AppendTag(sample, sampleTimestampField, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(timestamp)) // #nosec G115 -- negative timestamps are encoded as two's complement as required by protobuf int64
+		series = protowire.AppendTag(series, timeSeriesSamplesField, protowire.BytesType)
+		series = protowire.AppendBytes(series, sample)
+		request = protowire.AppendTag(request, writeRequestTimeseriesField, protowire.BytesType)
+		request = protowire.AppendBytes(request, series)
+	}
+	for _, family := range families {
+		name := family.GetName()
+		for _, metric := range family.GetMetric() {
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				appendSeries(name, metric, metric.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				appendSeries(name, metric, metric.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				appendSeries(name, metric, metric.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				for _, bucket := range histogram.GetBucket() {
+					if math.IsInf(bucket.GetUpperBound(), 1) {
+						continue
+					}
+					appendSeries(name+"_bucket", metric, float64(bucket.GetCumulativeCount()), remoteWriteLabel{"le", formatFloat(bucket.GetUpperBound())})
+				}
+				appendSeries(name+"_bucket", metric, float64(histogram.GetSampleCount()), remoteWriteLabel{"le", "+Inf"})
+				appendSeries(name+"_sum", metric, histogram.GetSampleSum())
+				appendSeries(name+"_count", metric, float64(histogram.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				summary := metric.GetSummary()
+				for _, quantile := range summary.GetQuantile() {
+					appendSeries(name, metric, quantile.GetValue(), remoteWriteLabel{"quantile", formatFloat(quantile.GetQuantile())})
+				}
+				appendSeries(name+"_sum", metric, summary.GetSampleSum())
+				appendSeries(name+"_count", metric, float64(summary.GetSampleCount()))
+			}
+		}
+	}
+	return request
+}
+
+// labels returns labels of the series sorted by name as required by remote write protocol
+func (rw *remoteWriter) labels(name string, metric *dto.Metric, extraLabels []remoteWriteLabel) []remoteWriteLabel {
+	labels := []remoteWriteLabel{{"__name__", name}}
+	for _, label := range metric.GetLabel() {
+		labels = append(labels, remoteWriteLabel{label.GetName(), label.GetValue()})
+	}
+	labels = append(labels, extraLabels...)
+	for labelName, value := range rw.externalLabels {
+		if !slices.ContainsFunc(labels, func(label remoteWriteLabel) bool { return label.name == labelName }) {
+			labels = append(labels, remoteWriteLabel{labelName, value})
+		}
+	}
+	slices.SortFunc(labels, func(a, b remoteWriteLabel) int { return strings.Compare(a.name, b.name) })
+	return labels
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func (rw *remoteWriter) send(ctx context.Context, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, rw.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range rw.headers {
+		request.Header.Set(name, value)
+	}
+	request.Header.Set("Content-Encoding", "snappy")
+	request.Header.Set("Content-Type", "application/x-protobuf")
+	request.Header.Set("X-Prometheus-Remote-Write-Version", remoteWriteVersion)
+	if len(rw.username) > 0 {
+		request.SetBasicAuth(rw.username, rw.password)
+	} else if len(rw.bearerToken) > 0 {
+		request.Header.Set("Authorization", "Bearer "+rw.bearerToken)
+	}
+	resp, err := rw.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("could not send request to remote write endpoint: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err = fmt.Errorf("remote write endpoint responded with status %s: %s", resp.Status, message)
+		// Only server errors and throttling are retried, other errors are not fixed by re-sending the same data
+		if resp.StatusCode < http.StatusInternalServerError && resp.StatusCode != http.StatusTooManyRequests {
+			return &permanentError{err: err}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// fakeRemoteStorage decodes WriteRequest and keeps the last value of each series in text format
+type fakeRemoteStorage struct {
+	mu       sync.Mutex
+	series   map[string]float64
+	requests int
+	statuses []int
+}
+
+func (fs *fakeRemoteStorage) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "0.1.0", r.Header.Get("X-Prometheus-Remote-Write-Version"))
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		fs.requests++
+		if len(fs.statuses) > 0 {
+			status := fs.statuses[0]
+			fs.statuses = fs.statuses[1:]
+			w.WriteHeader(status)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		request, err := snappy.Decode(nil, body)
+		assert.NoError(t, err)
+		if fs.series == nil {
+			fs.series = map[string]float64{}
+		}
+		for _, series := range protoFields(t, request) {
+			var labels []string
+			var value float64
+			for _, field := range protoFieldsByNumber(t, series) {
+				switch field.number {
+				case timeSeriesLabelsField:
+					label := protoFieldsByNumber(t, field.value)
+					labels = append(labels, fmt.Sprintf("%s=%q", label[0].value, label[1].value))
+				case timeSeriesSamplesField:
+					sample := protoFieldsByNumber(t, field.value)
+					bits, _ := protowire.ConsumeFixed64(sample[0].value)
+					value = math.Float64frombits(bits)
+				}
+			}
+			assert.True(t, sort.StringsAreSorted(labels), "Labels should be sorted")
+			fs.series["{"+strings.Join(labels, ",")+"}"] = value
+		}
+	}
+}
+
+type protoField struct {
+	number protowire.Number
+	value  []byte
+}
+
+func protoFields(t *testing.T, message []byte) [][]byte {
+	var values [][]byte
+	for _, field := range protoFieldsByNumber(t, message) {
+		values = append(values, field.value)
+	}
+	return values
+}
+
+// protoFieldsByNumber parses fields of message. Values of bytes fields are returned without length prefix
+func protoFieldsByNumber(t *testing.T, message []byte) []protoField {
+	var fields []protoField
+	for len(message) > 0 {
+		number, fieldType, n := protowire.ConsumeTag(message)
+		assert.GreaterOrEqual(t, n, 0)
+		message = message[n:]
+		length := protowire.ConsumeFieldValue(number, fieldType, message)
+		assert.GreaterOrEqual(t, length, 0)
+		value := message[:length]
+		if fieldType == protowire.BytesType {
+			value, _ = protowire.ConsumeBytes(value)
+		}
+		fields = append(fields, protoField{number: number, value: value})
+		message = message[length:]
+	}
+	return fields
+}
+
+func (fs *fakeRemoteStorage) value(series string) (float64, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	value, ok := fs.series[series]
+	return value, ok
+}
+
+func TestRemoteWriter_Push(t *testing.T) {
+	storage := &fakeRemoteStorage{}
+	server := httptest.NewServer(storage.handler(t))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_total"}, []string{"kind"})
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_seconds", Buckets: []float64{1, 5}})
+	registry.MustRegister(counter, histogram)
+	counter.WithLabelValues("Pod").Add(3)
+	histogram.Observe(2)
+
+	writer, err := newRemoteWriter(&RemoteWriteSettings{URL: server.URL, BearerToken: "secret", ExternalLabels: map[string]string{"cluster": "test", "kind": "overridden"}}, registry)
+	assert.NoError(t, err)
+	writer.push(t.Context())
+
+	for series, expected := range map[string]float64{
+		`{__name__="test_total",cluster="test",kind="Pod"}`:                           3,
+		`{__name__="test_seconds_bucket",cluster="test",kind="overridden",le="1"}`:    0,
+		`{__name__="test_seconds_bucket",cluster="test",kind="overridden",le="5"}`:    1,
+		`{__name__="test_seconds_bucket",cluster="test",kind="overridden",le="+Inf"}`: 1,
+		`{__name__="test_seconds_sum",cluster="test",kind="overridden"}`:              2,
+		`{__name__="test_seconds_count",cluster="test",kind="overridden"}`:            1,
+	} {
+		value, ok := storage.value(series)
+		assert.True(t, ok, "Series %s should be pushed", series)
+		assert.Equal(t, expected, value, series)
+	}
+}
+
+func TestRemoteWriter_Push_Retries(t *testing.T) {
+	storage := &fakeRemoteStorage{statuses: []int{http.StatusServiceUnavailable}}
+	server := httptest.NewServer(storage.handler(t))
+	defer server.Close()
+
+	writer, err := newRemoteWriter(&RemoteWriteSettings{URL: server.URL, BearerToken: "secret"}, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	writer.push(t.Context())
+	storage.mu.Lock()
+	assert.Equal(t, 2, storage.requests, "Server error should be retried")
+	storage.statuses = []int{http.StatusBadRequest}
+	storage.requests = 0
+	storage.mu.Unlock()
+
+	writer.push(t.Context())
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	assert.Equal(t, 1, storage.requests, "Client error should not be retried")
+}
+
+func TestPrometheusMetricsSink_RemoteWrite(t *testing.T) {
+	storage := &fakeRemoteStorage{}
+	server := httptest.NewServer(storage.handler(t))
+	defer server.Close()
+
+	settings := fmt.Sprintf(`{"remoteWrite":{"url":"%s","interval":"10ms","bearerToken":"secret","externalLabels":{"cluster":"test"}}}`, server.URL)
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	testSink, err := InitMetricsSink(ctx, nil, testSinkFilters("metrics", settings))
+	assert.NoError(t, err)
+	assert.NoError(t, testSink.Release(test.EventPodTracing))
+
+	assert.Eventually(t, func() bool {
+		value, _ := storage.value(`{__name__="kube_events_total",cluster="test",event_namespace="tracing",kind="Pod",type="Warning"}`)
+		return value == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNewRemoteWriter_InvalidSettings(t *testing.T) {
+	for _, settings := range []*RemoteWriteSettings{
+		{},
+		{URL: "http://localhost", Username: "user", BearerToken: "secret"},
+		{URL: "http://localhost", BearerTokenFile: "/not/existing/file"},
+	} {
+		_, err := newRemoteWriter(settings, prometheus.NewRegistry())
+		assert.Error(t, err)
+	}
+}
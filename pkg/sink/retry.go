@@ -0,0 +1,52 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+const initialRetryBackoff = time.Second
+
+// permanentError is returned by send functions if the request must not be retried
+type permanentError struct {
+	err error
+}
+
+func (pe *permanentError) Error() string {
+	return pe.err.Error()
+}
+
+func (pe *permanentError) Unwrap() error {
+	return pe.err
+}
+
+// Permanent marks the error returned by the sink as permanent, so the controller drops the event without retries
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether the error of the sink must not be retried, e.g. the event is rejected by the receiver
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// sendWithRetries calls send until it succeeds, returns permanentError or maxRetries retries with exponential backoff are made
+func sendWithRetries(ctx context.Context, sinkName string, maxRetries int, send func() error) error {
+	backoff := initialRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := send()
+		if err == nil || attempt > maxRetries || IsPermanent(err) {
+			return err
+		}
+		slog.Warn("could not send events, retrying", "sink", sinkName, "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
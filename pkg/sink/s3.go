@@ -0,0 +1,723 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/format"
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	s3SinkName = "s3"
+
+	// s3MinPartSize is the minimum size of all parts of multipart upload except the last one
+	s3MinPartSize = 5 * 1024 * 1024
+	// s3ClusterScopedNamespace is used in keys of cluster-scoped events
+	s3ClusterScopedNamespace = "_"
+
+	defaultS3Region         = "us-east-1"
+	defaultS3Prefix         = "events"
+	defaultS3MaxObjectSize  = 64 * 1024 * 1024
+	defaultS3PartSize       = 8 * 1024 * 1024
+	defaultS3RollInterval   = 5 * time.Minute
+	defaultS3MaxOpenObjects = 100
+	defaultS3BufferSize     = 1000
+	defaultS3MaxRetries     = 3
+	defaultS3Timeout        = time.Minute
+
+	// s3WriteInterval is the maximum time events wait to be written to objects and the interval of checks of roll interval
+	s3WriteInterval = time.Second
+
+	sigV4Algorithm   = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat  = "20060102T150405Z"
+	sigV4DateFormat  = "20060102"
+	sigV4Service     = "s3"
+	sigV4Termination = "aws4_request"
+)
+
+type S3Settings struct {
+	// Endpoint is URL of S3-compatible storage, e.g. https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	Endpoint string `json:"endpoint"`
+	Bucket   string `json:"bucket"`
+	Region   string `json:"region,omitempty"`
+	// PathStyle enables path-style requests (endpoint/bucket/key) instead of virtual-hosted-style (bucket.endpoint/key)
+	PathStyle bool `json:"pathStyle,omitempty"`
+	// AccessKeyID and SecretAccessKey are taken from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY if not set
+	AccessKeyID         string `json:"accessKeyID,omitempty"`
+	AccessKeyIDFile     string `json:"accessKeyIDFile,omitempty"`
+	SecretAccessKey     string `json:"secretAccessKey,omitempty"`
+	SecretAccessKeyFile string `json:"secretAccessKeyFile,omitempty"`
+	SessionToken        string `json:"sessionToken,omitempty"`
+	// Prefix is the first part of keys of objects
+	Prefix string `json:"prefix,omitempty"`
+	// MaxObjectSize is the size of compressed data after which the object is completed
+	MaxObjectSize int64 `json:"maxObjectSize,omitempty"`
+	// PartSize is the size of parts of multipart upload
+	PartSize int `json:"partSize,omitempty"`
+	// RollInterval is the maximum time the object is open
+	RollInterval metav1.Duration `json:"rollInterval,omitempty"`
+	// MaxOpenObjects is the maximum number of objects written simultaneously. The oldest object is completed if it is exceeded
+	MaxOpenObjects     int             `json:"maxOpenObjects,omitempty"`
+	BufferSize         int             `json:"bufferSize,omitempty"`
+	MaxRetries         int             `json:"maxRetries,omitempty"`
+	InsecureSkipVerify bool            `json:"insecureSkipVerify,omitempty"`
+	Timeout            metav1.Duration `json:"timeout,omitempty"`
+}
+
+type S3Sink struct {
+	*Sink
+	endpoint       *url.URL
+	bucket         string
+	region         string
+	pathStyle      bool
+	credentials    s3Credentials
+	prefix         string
+	maxObjectSize  int64
+	partSize       int
+	rollInterval   time.Duration
+	maxOpenObjects int
+	maxRetries     int
+	client         *http.Client
+	batch          BatchOptions
+
+	// mu guards objects and queue. Batches write events to objects under the lock, and the goroutine of the sink uploads
+	// queued chunks without it, so writing is not blocked by requests to the storage
+	mu sync.Mutex
+	// queueFree is signaled when the goroutine of the sink takes queued chunks
+	queueFree *sync.Cond
+	// objects are open objects by partition
+	objects map[string]*s3Object
+	// queue are chunks of objects waiting for upload. Batches wait while it has maxOpenObjects chunks
+	queue []s3Chunk
+	// closing is set by Close, so the goroutine of the sink uploads the rest of objects and exits
+	closing bool
+	// queued wakes up the goroutine of the sink when chunks are queued
+	queued chan struct{}
+
+	// failed are objects which could not be uploaded, from the oldest to the newest. It is used by the goroutine of the
+	// sink only
+	failed []*s3Object
+	// ctx is canceled when the context of Close is done, so uploads in progress are interrupted
+	ctx    context.Context
+	cancel context.CancelFunc
+	// done is closed when the goroutine of the sink exits, and closeErr is the result of the last uploads
+	done     chan struct{}
+	closeErr error
+}
+
+type s3Credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// s3Object is the gzip-compressed NDJSON object that is being written. Compressed data is queued for upload by chunks
+// when it exceeds part size, so only the last part and chunks waiting for upload are kept in memory
+type s3Object struct {
+	key       string
+	partition string
+	created   time.Time
+
+	// data, writer, size and events are used by batches under the lock of the sink
+	data   *bytes.Buffer
+	writer *gzip.Writer
+	// size is the size of compressed data including queued chunks
+	size   int64
+	events int
+
+	// fields below are used by the goroutine of the sink only
+	uploadID string
+	parts    []s3CompletedPart
+	// pending are chunks which are not uploaded yet
+	pending [][]byte
+	// completed is set when the last chunk is received, so the object is completed after pending chunks are uploaded
+	completed bool
+	// retryAt is the time of the next attempt to upload the failed object
+	retryAt time.Time
+}
+
+// Write appends compressed data of the writer to the current chunk
+func (o *s3Object) Write(p []byte) (int, error) {
+	return o.data.Write(p)
+}
+
+// s3Chunk is compressed data of the object queued for upload. The last chunk completes the object
+type s3Chunk struct {
+	object *s3Object
+	data   []byte
+	last   bool
+}
+
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+
+type s3InitiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+func init() {
+	Register(Registration{
+		Type:     s3SinkName,
+		Settings: S3Settings{},
+		New: func(_ context.Context, _ *Options, filters *filter.Sink) (ISink, error) {
+			return InitS3Sink(filters)
+		},
+	})
+}
+
+func InitS3Sink(filters *filter.Sink) (*S3Sink, error) {
+	var settings S3Settings
+	if err := DecodeSettings(filters, &settings); err != nil {
+		return nil, err
+	}
+	if len(settings.Endpoint) == 0 || len(settings.Bucket) == 0 {
+		return nil, fmt.Errorf("endpoint and bucket must be configured for s3 sink")
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(settings.Endpoint, "/"))
+	if err != nil || len(endpoint.Host) == 0 {
+		return nil, fmt.Errorf("invalid endpoint of s3 sink: %s", settings.Endpoint)
+	}
+	credentials, err := s3CredentialsFromSettings(&settings)
+	if err != nil {
+		return nil, err
+	}
+	partSize := IntOrDefault(settings.PartSize, defaultS3PartSize)
+	if partSize < s3MinPartSize {
+		return nil, fmt.Errorf("partSize of s3 sink must be at least %d bytes", s3MinPartSize)
+	}
+	maxObjectSize := settings.MaxObjectSize
+	if maxObjectSize <= 0 {
+		maxObjectSize = defaultS3MaxObjectSize
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: settings.InsecureSkipVerify} // #nosec G402 -- configured explicitly by user
+	s3Sink := newS3Sink(&S3Sink{
+		Sink:           NewSinkWithFilters(filters),
+		endpoint:       endpoint,
+		bucket:         settings.Bucket,
+		region:         ValueOrDefault(settings.Region, defaultS3Region),
+		pathStyle:      settings.PathStyle,
+		credentials:    credentials,
+		prefix:         strings.Trim(ValueOrDefault(settings.Prefix, defaultS3Prefix), "/"),
+		maxObjectSize:  maxObjectSize,
+		partSize:       partSize,
+		rollInterval:   DurationOrDefault(settings.RollInterval, defaultS3RollInterval),
+		maxOpenObjects: IntOrDefault(settings.MaxOpenObjects, defaultS3MaxOpenObjects),
+		maxRetries:     IntOrDefault(settings.MaxRetries, defaultS3MaxRetries),
+		client:         &http.Client{Timeout: DurationOrDefault(settings.Timeout, defaultS3Timeout), Transport: transport},
+		batch:          BatchOptions{MaxEvents: IntOrDefault(settings.BufferSize, defaultS3BufferSize), Linger: s3WriteInterval},
+	})
+	go s3Sink.run()
+	return s3Sink, nil
+}
+
+// newS3Sink initializes state of the sink with the given settings
+func newS3Sink(s3s *S3Sink) *S3Sink {
+	s3s.queueFree = sync.NewCond(&s3s.mu)
+	s3s.objects = make(map[string]*s3Object)
+	s3s.queued = make(chan struct{}, 1)
+	s3s.ctx, s3s.cancel = context.WithCancel(context.Background())
+	s3s.done = make(chan struct{})
+	return s3s
+}
+
+func s3CredentialsFromSettings(settings *S3Settings) (s3Credentials, error) {
+	credentials := s3Credentials{
+		accessKeyID:     ValueOrDefault(settings.AccessKeyID, os.Getenv("AWS_ACCESS_KEY_ID")),
+		secretAccessKey: ValueOrDefault(settings.SecretAccessKey, os.Getenv("AWS_SECRET_ACCESS_KEY")),
+		sessionToken:    ValueOrDefault(settings.SessionToken, os.Getenv("AWS_SESSION_TOKEN")),
+	}
+	var err error
+	if len(settings.AccessKeyIDFile) > 0 {
+		if credentials.accessKeyID, err = ReadSecretFile(settings.AccessKeyIDFile); err != nil {
+			return credentials, err
+		}
+	}
+	if len(settings.SecretAccessKeyFile) > 0 {
+		if credentials.secretAccessKey, err = ReadSecretFile(settings.SecretAccessKeyFile); err != nil {
+			return credentials, err
+		}
+	}
+	if len(credentials.accessKeyID) == 0 || len(credentials.secretAccessKey) == 0 {
+		return credentials, fmt.Errorf("access key must be configured for s3 sink")
+	}
+	return credentials, nil
+}
+
+func (s3s *S3Sink) Release(eventObj *corev1.Event) error {
+	if !s3s.IsEventAllowed(eventObj) {
+		return nil
+	}
+	return s3s.ReleaseBatch([]*corev1.Event{eventObj})[0]
+}
+
+func (s3s *S3Sink) BatchOptions() BatchOptions {
+	return s3s.batch
+}
+
+// ReleaseBatch writes events to objects. Objects are uploaded by the goroutine of the sink, so the error is returned
+// only for events that cannot be written. Batches wait while too many chunks are waiting for upload
+func (s3s *S3Sink) ReleaseBatch(events []*corev1.Event) []error {
+	s3s.mu.Lock()
+	defer s3s.mu.Unlock()
+	for len(s3s.queue) >= s3s.maxOpenObjects {
+		s3s.queueFree.Wait()
+	}
+	errs := make([]error, len(events))
+	for i, eventObj := range events {
+		errs[i] = s3s.write(eventObj)
+	}
+	return errs
+}
+
+// Close completes open objects and waits until they and failed objects are uploaded. Uploads are canceled when the
+// context is done. Objects which still cannot be uploaded are dropped
+func (s3s *S3Sink) Close(ctx context.Context) error {
+	s3s.mu.Lock()
+	for partition := range s3s.objects {
+		s3s.finish(partition)
+	}
+	s3s.closing = true
+	s3s.mu.Unlock()
+	s3s.wake()
+	stop := context.AfterFunc(ctx, s3s.cancel)
+	defer stop()
+	<-s3s.done
+	return s3s.closeErr
+}
+
+// run uploads queued chunks, completes objects that are open longer than roll interval and uploads failed objects
+// again until the sink is closed
+func (s3s *S3Sink) run() {
+	defer close(s3s.done)
+	defer s3s.cancel()
+	ticker := time.NewTicker(min(s3s.rollInterval, s3WriteInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s3s.queued:
+		case now := <-ticker.C:
+			s3s.mu.Lock()
+			for partition, object := range s3s.objects {
+				if now.Sub(object.created) >= s3s.rollInterval {
+					s3s.finish(partition)
+				}
+			}
+			s3s.mu.Unlock()
+			s3s.retryFailed(now)
+		}
+		if closing := s3s.uploadQueued(); closing {
+			s3s.closeErr = s3s.uploadFailed()
+			return
+		}
+	}
+}
+
+// wake wakes up the goroutine of the sink if it is not woken up yet
+func (s3s *S3Sink) wake() {
+	select {
+	case s3s.queued <- struct{}{}:
+	default:
+	}
+}
+
+// partition returns date and namespace part of the key of the object for the event
+func (s3s *S3Sink) partition(eventObj *corev1.Event) string {
+	namespace := ValueOrDefault(eventObj.InvolvedObject.Namespace, s3ClusterScopedNamespace)
+	return fmt.Sprintf("date=%s/namespace=%s", format.ResolveTimestamp(eventObj).Time.UTC().Format(time.DateOnly), namespace)
+}
+
+// write writes the event to the object of its partition. It must be called with the lock held
+func (s3s *S3Sink) write(eventObj *corev1.Event) error {
+	line, err := json.Marshal(eventObj)
+	if err != nil {
+		return fmt.Errorf("could not encode event for s3: %w", err)
+	}
+	partition := s3s.partition(eventObj)
+	object, ok := s3s.objects[partition]
+	if !ok {
+		if len(s3s.objects) >= s3s.maxOpenObjects {
+			s3s.finishOldest()
+		}
+		object = s3s.newObject(partition)
+		s3s.objects[partition] = object
+	}
+	if _, err = object.writer.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("could not compress event for s3 object %s: %w", object.key, err)
+	}
+	object.events++
+	if object.data.Len() >= s3s.partSize {
+		s3s.enqueue(object, false)
+	}
+	if object.size+int64(object.data.Len()) >= s3s.maxObjectSize {
+		s3s.finish(partition)
+	}
+	return nil
+}
+
+func (s3s *S3Sink) newObject(partition string) *s3Object {
+	now := time.Now().UTC()
+	object := &s3Object{
+		key:       fmt.Sprintf("%s/%s/%s-%s.ndjson.gz", s3s.prefix, partition, now.Format(sigV4TimeFormat), uuid.NewString()),
+		partition: partition,
+		created:   now,
+		data:      &bytes.Buffer{},
+	}
+	object.writer = gzip.NewWriter(object)
+	return object
+}
+
+func (s3s *S3Sink) finishOldest() {
+	var oldest string
+	for partition, object := range s3s.objects {
+		if len(oldest) == 0 || object.created.Before(s3s.objects[oldest].created) {
+			oldest = partition
+		}
+	}
+	s3s.finish(oldest)
+}
+
+// finish removes the object from open objects and queues its last chunk. It must be called with the lock held
+func (s3s *S3Sink) finish(partition string) {
+	object := s3s.objects[partition]
+	delete(s3s.objects, partition)
+	if err := object.writer.Close(); err != nil {
+		slog.Error("could not compress object for s3", "key", object.key, "error", err)
+	}
+	s3s.enqueue(object, true)
+}
+
+// enqueue queues compressed data of the object for upload, and next data is written to the new chunk. It must be called
+// with the lock held
+func (s3s *S3Sink) enqueue(object *s3Object, last bool) {
+	s3s.queue = append(s3s.queue, s3Chunk{object: object, data: object.data.Bytes(), last: last})
+	object.size += int64(object.data.Len())
+	object.data = &bytes.Buffer{}
+	s3s.wake()
+}
+
+// uploadQueued uploads queued chunks and reports whether the sink is closing
+func (s3s *S3Sink) uploadQueued() bool {
+	s3s.mu.Lock()
+	queue := s3s.queue
+	s3s.queue = nil
+	closing := s3s.closing
+	s3s.queueFree.Broadcast()
+	s3s.mu.Unlock()
+	for _, chunk := range queue {
+		object := chunk.object
+		object.pending = append(object.pending, chunk.data)
+		object.completed = object.completed || chunk.last
+		// chunks of failed objects are uploaded with the next attempt
+		if object.retryAt.IsZero() {
+			s3s.upload(object)
+		}
+	}
+	return closing
+}
+
+// upload uploads pending chunks of the object and completes it if the last chunk is received. The object with one
+// chunk is uploaded with one request. The object is kept for the next attempt if it fails
+func (s3s *S3Sink) upload(object *s3Object) {
+	err := s3s.send(object)
+	if err != nil {
+		s3s.fail(object, err)
+		return
+	}
+	if object.completed {
+		slog.Debug("object is uploaded to s3", "key", object.key, "events", object.events)
+	}
+}
+
+func (s3s *S3Sink) send(object *s3Object) error {
+	if object.completed && len(object.uploadID) == 0 && len(object.pending) == 1 {
+		body := object.pending[0]
+		err := sendWithRetries(s3s.ctx, s3SinkName, s3s.maxRetries, func() error {
+			_, err := s3s.do(s3s.ctx, http.MethodPut, object.key, nil, body)
+			return err
+		})
+		if err == nil {
+			object.pending = nil
+		}
+		return err
+	}
+	for len(object.pending) > 0 {
+		if err := s3s.uploadPart(s3s.ctx, object, object.pending[0]); err != nil {
+			return err
+		}
+		object.pending = object.pending[1:]
+	}
+	if !object.completed {
+		return nil
+	}
+	return s3s.completeMultipartUpload(s3s.ctx, object)
+}
+
+// fail keeps the object which could not be uploaded, so it is uploaded again after roll interval. The open object is
+// finished, so next events of its partition are written to a new object. Not more than maxOpenObjects failed objects
+// are kept, so memory is limited while the storage is not available
+func (s3s *S3Sink) fail(object *s3Object, err error) {
+	slog.Error("could not upload object to s3, it will be uploaded again", "key", object.key, "events", object.events, "error", err)
+	object.retryAt = time.Now().Add(s3s.rollInterval)
+	s3s.failed = append(s3s.failed, object)
+	if !object.completed {
+		s3s.mu.Lock()
+		if s3s.objects[object.partition] == object {
+			s3s.finish(object.partition)
+		}
+		s3s.mu.Unlock()
+	}
+	if len(s3s.failed) > s3s.maxOpenObjects {
+		s3s.drop(s3s.failed[0])
+		s3s.failed = s3s.failed[1:]
+	}
+}
+
+// retryFailed uploads failed objects whose time of the next attempt is passed
+func (s3s *S3Sink) retryFailed(now time.Time) {
+	failed := s3s.failed
+	s3s.failed = nil
+	for _, object := range failed {
+		if now.Before(object.retryAt) {
+			s3s.failed = append(s3s.failed, object)
+			continue
+		}
+		object.retryAt = time.Time{}
+		s3s.upload(object)
+	}
+}
+
+// uploadFailed uploads all failed objects again and drops ones which still cannot be uploaded
+func (s3s *S3Sink) uploadFailed() error {
+	// all failed objects are due, as they are retried not later than roll interval after the failure
+	s3s.retryFailed(time.Now().Add(s3s.rollInterval))
+	if len(s3s.failed) == 0 {
+		return nil
+	}
+	dropped := len(s3s.failed)
+	for _, object := range s3s.failed {
+		s3s.drop(object)
+	}
+	s3s.failed = nil
+	return fmt.Errorf("%d objects could not be uploaded to s3", dropped)
+}
+
+// drop removes uploaded parts of the failed object, so they are not stored in the bucket
+func (s3s *S3Sink) drop(object *s3Object) {
+	slog.Error("dropping object which could not be uploaded to s3", "key", object.key, "events", object.events)
+	if len(object.uploadID) == 0 {
+		return
+	}
+	if _, err := s3s.do(s3s.ctx, http.MethodDelete, object.key, url.Values{"uploadId": {object.uploadID}}, nil); err != nil {
+		slog.Warn("could not abort multipart upload in s3", "key", object.key, "error", err)
+	}
+}
+
+func (s3s *S3Sink) uploadPart(ctx context.Context, object *s3Object, body []byte) error {
+	if len(object.uploadID) == 0 {
+		err := sendWithRetries(ctx, s3SinkName, s3s.maxRetries, func() error {
+			resp, err := s3s.do(ctx, http.MethodPost, object.key, url.Values{"uploads": {""}}, nil)
+			if err != nil {
+				return err
+			}
+			var result s3InitiateMultipartUploadResult
+			if err = xml.Unmarshal(resp.body, &result); err != nil {
+				return fmt.Errorf("could not parse response of s3: %w", err)
+			}
+			object.uploadID = result.UploadID
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	part := s3CompletedPart{PartNumber: len(object.parts) + 1}
+	query := url.Values{"partNumber": {strconv.Itoa(part.PartNumber)}, "uploadId": {object.uploadID}}
+	err := sendWithRetries(ctx, s3SinkName, s3s.maxRetries, func() error {
+		resp, err := s3s.do(ctx, http.MethodPut, object.key, query, body)
+		if err != nil {
+			return err
+		}
+		part.ETag = resp.header.Get("ETag")
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	object.parts = append(object.parts, part)
+	return nil
+}
+
+func (s3s *S3Sink) completeMultipartUpload(ctx context.Context, object *s3Object) error {
+	body, err := xml.Marshal(s3CompleteMultipartUpload{Parts: object.parts})
+	if err != nil {
+		return err
+	}
+	return sendWithRetries(ctx, s3SinkName, s3s.maxRetries, func() error {
+		resp, err := s3s.do(ctx, http.MethodPost, object.key, url.Values{"uploadId": {object.uploadID}}, body)
+		if err != nil {
+			return err
+		}
+		// S3 can respond with 200 OK and error in the body if the error occurs after the response is started
+		if bytes.Contains(resp.body, []byte("<Error>")) {
+			return fmt.Errorf("s3 could not complete multipart upload: %s", resp.body)
+		}
+		return nil
+	})
+}
+
+type s3Response struct {
+	header http.Header
+	body   []byte
+}
+
+func (s3s *S3Sink) do(ctx context.Context, method string, key string, query url.Values, body []byte) (*s3Response, error) {
+	requestURL := *s3s.endpoint
+	if s3s.pathStyle {
+		requestURL.Path += "/" + s3s.bucket + "/" + key
+	} else {
+		requestURL.Host = s3s.bucket + "." + requestURL.Host
+		requestURL.Path += "/" + key
+	}
+	// Path is sent in the same form as it is signed, e.g. "=" in partitions is encoded
+	requestURL.RawPath = sigV4EscapePath(requestURL.Path)
+	requestURL.RawQuery = query.Encode()
+	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if method == http.MethodPut && !query.Has("partNumber") || query.Has("uploads") {
+		request.Header.Set("Content-Type", "application/gzip")
+	}
+	signV4(request, body, s3s.credentials, s3s.region, time.Now())
+	resp, err := s3s.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("could not send request to s3: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read response of s3: %w", err)
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("s3 responded with status %s: %s", resp.Status, responseBody)
+	}
+	return &s3Response{header: resp.Header, body: responseBody}, nil
+}
+
+// signV4 signs request with AWS Signature Version 4. Host and all headers set in the request are signed
+func signV4(request *http.Request, body []byte, credentials s3Credentials, region string, now time.Time) {
+	now = now.UTC()
+	payloadHash := sha256.Sum256(body)
+	request.Header.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	request.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if len(credentials.sessionToken) > 0 {
+		request.Header.Set("X-Amz-Security-Token", credentials.sessionToken)
+	}
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	headerNames := make([]string, 0, len(headers))
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	slices.Sort(headerNames)
+	canonicalHeaders := strings.Builder{}
+	for _, name := range headerNames {
+		canonicalHeaders.WriteString(name + ":" + strings.Join(strings.Fields(headers[name]), " ") + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		sigV4EscapePath(request.URL.EscapedPath()),
+		sigV4CanonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := strings.Join([]string{now.Format(sigV4DateFormat), region, sigV4Service, sigV4Termination}, "/")
+	stringToSign := strings.Join([]string{sigV4Algorithm, now.Format(sigV4TimeFormat), scope, hex.EncodeToString(canonicalRequestHash[:])}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+credentials.secretAccessKey), now.Format(sigV4DateFormat))
+	for _, value := range []string{region, sigV4Service, sigV4Termination} {
+		signingKey = hmacSHA256(signingKey, value)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	request.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, credentials.accessKeyID, scope, signedHeaders, signature))
+}
+
+// sigV4EscapePath escapes path as required by SigV4: all characters except unreserved ones and slash are encoded
+func sigV4EscapePath(path string) string {
+	unescaped, err := url.PathUnescape(path)
+	if err != nil {
+		unescaped = path
+	}
+	segments := strings.Split(unescaped, "/")
+	for i, segment := range segments {
+		segments[i] = sigV4Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func sigV4CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	var pairs []string
+	for _, key := range keys {
+		values := slices.Clone(query[key])
+		slices.Sort(values)
+		for _, value := range values {
+			pairs = append(pairs, sigV4Escape(key)+"="+sigV4Escape(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func sigV4Escape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+func hmacSHA256(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,219 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// overflowLabelValue is the value of all labels of the series counting events over MetricsSettings.MaxSeries
+	overflowLabelValue = "other"
+	// maxExpiryInterval limits the interval of checks of expired series, so long periods do not delay expiry much
+	maxExpiryInterval    = time.Minute
+	labelValuesSeparator = "\xff"
+)
+
+// MetricLabels configures labels of one metric
+type MetricLabels struct {
+	// Drop are names of labels removed from the metric
+	Drop []string `json:"drop,omitempty"`
+	// Replace are replacements of values by name of the label
+	Replace map[string]LabelReplacement `json:"replace,omitempty"`
+}
+
+// LabelReplacement replaces matches of Pattern in the value of the label with Replacement, which can refer to groups
+// of the pattern, e.g. ${1}. The whole value is replaced if Pattern is empty
+type LabelReplacement struct {
+	Pattern     string `json:"pattern,omitempty"`
+	Replacement string `json:"replacement"`
+}
+
+type labelReplacement struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+func (r *labelReplacement) replace(value string) string {
+	if r.pattern == nil {
+		return r.replacement
+	}
+	return r.pattern.ReplaceAllString(value, r.replacement)
+}
+
+// seriesCounter is the counter of the metrics sink with labels configured by MetricLabels
+type seriesCounter struct {
+	vec *prometheus.CounterVec
+	// kept are indexes of label values passed to inc which are not dropped
+	kept []int
+	// replacements are replacements of label values by index of the label passed to inc
+	replacements map[int]*labelReplacement
+	// series tracks series of all metrics of the sink. It is nil if the number and lifetime of series are not limited
+	series *seriesTracker
+}
+
+// newSeriesCounter creates the counter with labels remaining after labels in config are dropped
+func newSeriesCounter(labels []string, config MetricLabels, newVec func(labels []string) *prometheus.CounterVec, series *seriesTracker) (*seriesCounter, error) {
+	counter := &seriesCounter{replacements: make(map[int]*labelReplacement), series: series}
+	for _, name := range config.Drop {
+		if !slices.Contains(labels, name) {
+			return nil, fmt.Errorf("label %s cannot be dropped, metric has labels: %s", name, strings.Join(labels, ", "))
+		}
+	}
+	var kept []string
+	for i, name := range labels {
+		if !slices.Contains(config.Drop, name) {
+			counter.kept = append(counter.kept, i)
+			kept = append(kept, name)
+		}
+	}
+	for name, replacement := range config.Replace {
+		i := slices.Index(labels, name)
+		if i < 0 || slices.Contains(config.Drop, name) {
+			return nil, fmt.Errorf("label %s cannot be replaced, metric has labels: %s", name, strings.Join(kept, ", "))
+		}
+		r := &labelReplacement{replacement: replacement.Replacement}
+		if len(replacement.Pattern) > 0 {
+			var err error
+			if r.pattern, err = regexp.Compile(replacement.Pattern); err != nil {
+				return nil, fmt.Errorf("could not parse pattern of replacement of label %s: %w", name, err)
+			}
+		}
+		counter.replacements[i] = r
+	}
+	counter.vec = newVec(kept)
+	return counter, nil
+}
+
+// inc increments the series with label values in the order of labels of the metric before they are dropped
+func (c *seriesCounter) inc(values ...string) {
+	c.add(1, values...)
+}
+
+// add adds the value to the series with label values in the order of labels of the metric before they are dropped
+func (c *seriesCounter) add(value float64, values ...string) {
+	labelValues := make([]string, 0, len(c.kept))
+	for _, i := range c.kept {
+		labelValue := values[i]
+		if r, ok := c.replacements[i]; ok {
+			labelValue = r.replace(labelValue)
+		}
+		labelValues = append(labelValues, labelValue)
+	}
+	c.series.update(c.vec, labelValues, func(values []string) {
+		c.vec.WithLabelValues(values...).Add(value)
+	})
+}
+
+// seriesVec is the vector of metrics which series are tracked, e.g. CounterVec, GaugeVec or HistogramVec
+type seriesVec interface {
+	DeleteLabelValues(labelValues ...string) bool
+}
+
+type seriesKey struct {
+	vec    seriesVec
+	values string
+}
+
+type trackedSeries struct {
+	values     []string
+	lastUpdate time.Time
+	overflow   bool
+}
+
+// seriesTracker limits the number of series of all metrics of the sink with labels taken from events and removes series
+// which are not updated for TTL
+type seriesTracker struct {
+	mu        sync.Mutex
+	maxSeries int
+	// active is the number of tracked series except overflow series
+	active int
+	series map[seriesKey]*trackedSeries
+	now    func() time.Time
+}
+
+func newSeriesTracker(maxSeries int) *seriesTracker {
+	return &seriesTracker{maxSeries: maxSeries, series: make(map[seriesKey]*trackedSeries), now: time.Now}
+}
+
+// update calls the function with label values of the series of the vector. New series over the limit are updated with
+// all labels set to other. The function is called under the lock, so the series cannot be removed by expiry at the same
+// time. The function is called with the given values if the tracker is nil
+func (t *seriesTracker) update(vec seriesVec, values []string, update func(values []string)) {
+	if t == nil {
+		update(values)
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := seriesKey{vec: vec, values: strings.Join(values, labelValuesSeparator)}
+	series, ok := t.series[key]
+	if !ok && t.maxSeries > 0 && t.active >= t.maxSeries {
+		values = slices.Repeat([]string{overflowLabelValue}, len(values))
+		key.values = strings.Join(values, labelValuesSeparator)
+		series, ok = t.series[key]
+		if !ok {
+			series = &trackedSeries{values: values, overflow: true}
+			t.series[key] = series
+		}
+	} else if !ok {
+		series = &trackedSeries{values: values}
+		t.series[key] = series
+		t.active++
+	}
+	series.lastUpdate = t.now()
+	update(values)
+}
+
+// delete removes the series of the vector, e.g. the cleared active warning, so it frees the place for new series
+func (t *seriesTracker) delete(vec seriesVec, values []string) {
+	if t != nil {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		key := seriesKey{vec: vec, values: strings.Join(values, labelValuesSeparator)}
+		if series, ok := t.series[key]; ok {
+			delete(t.series, key)
+			if !series.overflow {
+				t.active--
+			}
+		}
+	}
+	vec.DeleteLabelValues(values...)
+}
+
+// expire removes series which are not updated for TTL
+func (t *seriesTracker) expire(ttl time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	for key, series := range t.series {
+		if now.Sub(series.lastUpdate) < ttl {
+			continue
+		}
+		key.vec.DeleteLabelValues(series.values...)
+		delete(t.series, key)
+		if !series.overflow {
+			t.active--
+		}
+	}
+}
+
+// expireIdle removes idle series until the context is done
+func (t *seriesTracker) expireIdle(ctx context.Context, ttl time.Duration) {
+	ticker := time.NewTicker(min(ttl, maxExpiryInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.expire(ttl)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package sink
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func newTestCounterVec(labels []string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_total", Help: "Test counter"}, labels)
+}
+
+// seriesCount returns the number of series of the metric
+func seriesCount(vec prometheus.Collector) int {
+	metrics := make(chan prometheus.Metric, 100)
+	vec.Collect(metrics)
+	close(metrics)
+	return len(metrics)
+}
+
+// counterValue returns the value of the series of the counter
+func counterValue(t *testing.T, vec *prometheus.CounterVec, values ...string) float64 {
+	var metric dto.Metric
+	assert.NoError(t, vec.WithLabelValues(values...).Write(&metric))
+	return metric.GetCounter().GetValue()
+}
+
+func TestSeriesCounter_DropAndReplaceLabels(t *testing.T) {
+	counter, err := newSeriesCounter(aggregatedLabels, MetricLabels{
+		Drop: []string{"controller_instance", "message"},
+		Replace: map[string]LabelReplacement{
+			"event_object": {Pattern: `^(.+)-[a-z0-9]{5}$`, Replacement: "${1}"},
+			"controller":   {Replacement: "any"},
+		},
+	}, newTestCounterVec, nil)
+	assert.NoError(t, err)
+
+	counter.inc("Pod", "nginx-7f9c5", "default", "BackOff", "kubelet", "node-1", "Back-off restarting failed container")
+	counter.inc("Pod", "nginx-4k2lx", "default", "BackOff", "kubelet", "node-2", "Back-off restarting failed container")
+	counter.inc("Pod", "nginx", "default", "BackOff", "kubelet", "node-1", "Back-off restarting failed container")
+
+	assert.Equal(t, 1, seriesCount(counter.vec), "Pods of one ReplicaSet should be counted by one series")
+	assert.Equal(t, float64(3), counterValue(t, counter.vec, "Pod", "nginx", "default", "BackOff", "any"))
+}
+
+func TestSeriesCounter_InvalidLabels(t *testing.T) {
+	for _, config := range []MetricLabels{
+		{Drop: []string{"pod"}},
+		{Replace: map[string]LabelReplacement{"pod": {Replacement: "any"}}},
+		{Drop: []string{"kind"}, Replace: map[string]LabelReplacement{"kind": {Replacement: "any"}}},
+		{Replace: map[string]LabelReplacement{"kind": {Pattern: "("}}},
+	} {
+		_, err := newSeriesCounter(summaryLabels, config, newTestCounterVec, nil)
+		assert.Error(t, err, "%+v", config)
+	}
+}
+
+func TestSeriesTracker_MaxSeries(t *testing.T) {
+	series := newSeriesTracker(2)
+	counter, err := newSeriesCounter(summaryLabels, MetricLabels{}, newTestCounterVec, series)
+	assert.NoError(t, err)
+
+	counter.inc("Pod", "default", "Warning")
+	counter.inc("Deployment", "default", "Warning")
+	counter.inc("Service", "default", "Warning")
+	counter.inc("Node", "", "Warning")
+	counter.inc("Pod", "default", "Warning")
+
+	assert.Equal(t, 3, seriesCount(counter.vec))
+	assert.Equal(t, float64(2), counterValue(t, counter.vec, "Pod", "default", "Warning"), "Existing series should be incremented over the limit")
+	assert.Equal(t, float64(2), counterValue(t, counter.vec, "other", "other", "other"), "New series over the limit should be counted by overflow series")
+}
+
+func TestSeriesTracker_Expire(t *testing.T) {
+	now := time.Now()
+	series := newSeriesTracker(1)
+	series.now = func() time.Time { return now }
+	counter, err := newSeriesCounter(summaryLabels, MetricLabels{}, newTestCounterVec, series)
+	assert.NoError(t, err)
+
+	counter.inc("Pod", "default", "Warning")
+	counter.inc("Service", "default", "Warning")
+	now = now.Add(time.Minute)
+	counter.inc("Pod", "default", "Warning")
+	series.expire(time.Minute)
+	assert.Equal(t, 1, seriesCount(counter.vec), "Series without increments for TTL should be removed")
+
+	now = now.Add(time.Minute)
+	series.expire(time.Minute)
+	assert.Equal(t, 0, seriesCount(counter.vec))
+
+	counter.inc("Service", "default", "Warning")
+	assert.Equal(t, float64(1), counterValue(t, counter.vec, "Service", "default", "Warning"), "Expired series should free the place for new series")
+}
+
+// seriesLabels returns label values of series of the metric joined by slash
+func seriesLabels(t *testing.T, collector prometheus.Collector) []string {
+	metrics := make(chan prometheus.Metric, 100)
+	collector.Collect(metrics)
+	close(metrics)
+	var series []string
+	for metric := range metrics {
+		var m dto.Metric
+		assert.NoError(t, metric.Write(&m))
+		var values []string
+		for _, label := range m.GetLabel() {
+			values = append(values, label.GetValue())
+		}
+		series = append(series, strings.Join(values, "/"))
+	}
+	return series
+}
+
+func TestSeriesTracker_AllMetrics(t *testing.T) {
+	series := newSeriesTracker(3)
+	counter, err := newSeriesCounter(summaryLabels, MetricLabels{}, newTestCounterVec, series)
+	assert.NoError(t, err)
+	warnings := newActiveWarnings("kube_test_events", &ActiveWarningsSettings{}, series)
+	custom, err := newCustomMetric(CustomMetric{Name: "kube_test_reasons", Type: CustomMetricGauge, Labels: []CustomMetricLabel{{Name: "reason", Field: "reason"}}}, series)
+	assert.NoError(t, err)
+
+	counter.inc("Pod", "default", "Warning")
+	warnings.observe(test.EventPodTracing)
+	custom.release(test.EventPodTracing)
+	custom.release(test.EventPvcMonitoring)
+	assert.ElementsMatch(t, []string{"BackOff", "other"}, seriesLabels(t, custom.collector),
+		"Custom metrics should be limited together with counters and active warnings")
+
+	started := test.EventPodTracing.DeepCopy()
+	started.Type = corev1.EventTypeNormal
+	started.Reason = "Started"
+	warnings.observe(started)
+	warnings.observe(test.EventDeploymentMonitoring)
+	assert.Equal(t, []string{"Deployment/monitoring/test-pod/BackOff"}, activeWarningsOf(t, warnings),
+		"Cleared warning should free the place for new series")
+}
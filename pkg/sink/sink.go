@@ -1,10 +1,20 @@
 package sink
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
 	"regexp"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type Sink struct {
@@ -27,6 +37,25 @@ type ISink interface {
 	IsEventAllowed(*corev1.Event) bool
 }
 
+// Closer is implemented by sinks that must send buffered data or release connections on shutdown
+type Closer interface {
+	// Close blocks until buffered data is sent or the context is done. Release is not called after Close
+	Close(ctx context.Context) error
+}
+
+// Close closes all sinks implementing Closer concurrently and waits until they are closed
+func Close(ctx context.Context, sinks []ISink) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(sinks))
+	for i, s := range sinks {
+		if closer, ok := s.(Closer); ok {
+			wg.Go(func() { errs[i] = closer.Close(ctx) })
+		}
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
 func (s *Sink) IsEventAllowed(eventObj *corev1.Event) bool {
 	for _, e := range s.Exclude {
 		if e.isEventToBeExcluded(eventObj) {
@@ -95,7 +124,9 @@ func (rule *Rule) isEventMatched(eventObj *corev1.Event) bool {
 	return match
 }
 
-func initializeSinkWithFilters(filters *filter.Sink) *Sink {
+// NewSinkWithFilters creates the Sink with match and exclude rules of filters. It is embedded by sinks, so they get
+// IsEventAllowed
+func NewSinkWithFilters(filters *filter.Sink) *Sink {
 	var sink Sink
 	if filters == nil {
 		return &sink
@@ -143,3 +174,50 @@ func createRule(eventMatch *filter.EventMatch) *Rule {
 	}
 	return &rule
 }
+
+// DecodeSettings unmarshals sink specific settings from filters configuration into the given structure. Unknown
+// fields are not allowed
+func DecodeSettings(filters *filter.Sink, settings any) error {
+	if filters == nil || len(filters.Settings) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(filters.Settings))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(settings); err != nil {
+		return fmt.Errorf("could not parse settings of sink %s: %w", filters.Name, err)
+	}
+	return nil
+}
+
+// ValueOrDefault returns the default value if the value is empty
+func ValueOrDefault(value string, defaultValue string) string {
+	if len(value) == 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// IntOrDefault returns the default value if the value is not positive
+func IntOrDefault(value int, defaultValue int) int {
+	if value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// DurationOrDefault returns the default value if the duration is not positive
+func DurationOrDefault(duration metav1.Duration, defaultValue time.Duration) time.Duration {
+	if duration.Duration <= 0 {
+		return defaultValue
+	}
+	return duration.Duration
+}
+
+// ReadSecretFile returns trimmed content of the file with secret value, e.g. token or webhook url
+func ReadSecretFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read secret from file: %w", err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
@@ -1,12 +1,15 @@
 package sink
 
 import (
+	"context"
+	"errors"
 	"regexp"
 	"testing"
 
 	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
 	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
 )
 
 var sinkTest = &Sink{
@@ -29,8 +32,8 @@ func TestSink_IsEventAllowed(t *testing.T) {
 	assert.False(t, sinkTest.IsEventAllowed(test.EventPvcMonitoring))
 }
 
-func Test_initializeSinkWithFilters_Nil(t *testing.T) {
-	sinkInitialized := initializeSinkWithFilters(nil)
+func TestNewSinkWithFilters_Nil(t *testing.T) {
+	sinkInitialized := NewSinkWithFilters(nil)
 	assert.NotNil(t, sinkInitialized)
 	assert.Equal(t, 0, len(sinkInitialized.Match))
 	assert.Equal(t, 0, len(sinkInitialized.Exclude))
@@ -41,12 +44,12 @@ func Test_initializeSinkWithFilters_Nil(t *testing.T) {
 	assert.True(t, sinkInitialized.IsEventAllowed(test.EventPvcMonitoring))
 }
 
-func Test_initializeSinkWithFilters_Empty(t *testing.T) {
+func TestNewSinkWithFilters_Empty(t *testing.T) {
 	var filtersSink = filter.Sink{
 		Name:    "logs",
 		Exclude: []filter.EventMatch{},
 	}
-	sinkInitialized := initializeSinkWithFilters(&filtersSink)
+	sinkInitialized := NewSinkWithFilters(&filtersSink)
 	assert.NotNil(t, sinkInitialized)
 	assert.Equal(t, 0, len(sinkInitialized.Match))
 	assert.Equal(t, 0, len(sinkInitialized.Exclude))
@@ -74,9 +77,9 @@ var filtersSinkMatchAndExclude = filter.Sink{
 	},
 }
 
-func Test_initializeSinkWithFilters_MatchAndExclude(t *testing.T) {
+func TestNewSinkWithFilters_MatchAndExclude(t *testing.T) {
 
-	sinkInitialized := initializeSinkWithFilters(&filtersSinkMatchAndExclude)
+	sinkInitialized := NewSinkWithFilters(&filtersSinkMatchAndExclude)
 	assert.NotNil(t, sinkInitialized)
 	assert.Equal(t, 1, len(sinkInitialized.Exclude))
 	assert.Equal(t, 2, len(sinkInitialized.Match))
@@ -87,7 +90,7 @@ func Test_initializeSinkWithFilters_MatchAndExclude(t *testing.T) {
 	assert.True(t, sinkInitialized.IsEventAllowed(test.EventPvcMonitoring))
 }
 
-func Test_initializeSinkWithFilters_Match(t *testing.T) {
+func TestNewSinkWithFilters_Match(t *testing.T) {
 	var filtersSink = filter.Sink{
 		Name: "logs",
 		Match: []filter.EventMatch{
@@ -99,7 +102,7 @@ func Test_initializeSinkWithFilters_Match(t *testing.T) {
 			},
 		},
 	}
-	sinkInitialized := initializeSinkWithFilters(&filtersSink)
+	sinkInitialized := NewSinkWithFilters(&filtersSink)
 	assert.NotNil(t, sinkInitialized)
 	assert.Equal(t, 0, len(sinkInitialized.Exclude))
 	assert.Equal(t, 2, len(sinkInitialized.Match))
@@ -109,3 +112,28 @@ func Test_initializeSinkWithFilters_Match(t *testing.T) {
 	assert.False(t, sinkInitialized.IsEventAllowed(test.EventPodTracing))
 	assert.False(t, sinkInitialized.IsEventAllowed(test.EventPvcMonitoring))
 }
+
+// closingSink records Close calls and returns err from Close
+type closingSink struct {
+	*Sink
+	err    error
+	closed bool
+}
+
+func (cs *closingSink) Release(_ *corev1.Event) error {
+	return nil
+}
+
+func (cs *closingSink) Close(context.Context) error {
+	cs.closed = true
+	return cs.err
+}
+
+func TestClose(t *testing.T) {
+	closed := &closingSink{Sink: &Sink{}}
+	failed := &closingSink{Sink: &Sink{}, err: errors.New("could not flush")}
+	err := Close(t.Context(), []ISink{closed, &testSink{Sink: &Sink{}}, failed})
+	assert.ErrorIs(t, err, failed.err)
+	assert.True(t, closed.closed)
+	assert.True(t, failed.closed, "All sinks should be closed even if closing of some of them fails")
+}
@@ -0,0 +1,276 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/format"
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	splunkHECSinkName = "splunk-hec"
+
+	hecEventPath = "/services/collector/event"
+	hecAckPath   = "/services/collector/ack"
+
+	defaultHECBatchSize     = 100
+	defaultHECFlushInterval = 5 * time.Second
+	defaultHECAckTimeout    = time.Minute
+	defaultHECAckInterval   = time.Second
+	defaultHECTimeout       = 10 * time.Second
+)
+
+type SplunkHECSettings struct {
+	// URL is the base URL of Splunk HTTP Event Collector, e.g. https://splunk:8088
+	URL        string `json:"url"`
+	Token      string `json:"token,omitempty"`
+	TokenFile  string `json:"tokenFile,omitempty"`
+	Index      string `json:"index,omitempty"`
+	Source     string `json:"source,omitempty"`
+	SourceType string `json:"sourcetype,omitempty"`
+	Host       string `json:"host,omitempty"`
+	// BatchSize is the maximum number of events sent in one request
+	BatchSize     int             `json:"batchSize,omitempty"`
+	FlushInterval metav1.Duration `json:"flushInterval,omitempty"`
+	// Ack enables indexer acknowledgement. Batch is re-sent if it is not acknowledged in AckTimeout
+	Ack                bool            `json:"ack,omitempty"`
+	AckTimeout         metav1.Duration `json:"ackTimeout,omitempty"`
+	Channel            string          `json:"channel,omitempty"`
+	InsecureSkipVerify bool            `json:"insecureSkipVerify,omitempty"`
+	Timeout            metav1.Duration `json:"timeout,omitempty"`
+}
+
+type SplunkHECSink struct {
+	*Sink
+	url         string
+	token       string
+	index       string
+	source      string
+	sourceType  string
+	host        string
+	ack         bool
+	ackTimeout  time.Duration
+	ackInterval time.Duration
+	channel     string
+	client      *http.Client
+	batch       BatchOptions
+	// ctx is canceled by Close, so requests and waits for acknowledgements do not outlast shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// hecEvent is the event representation of Splunk HTTP Event Collector
+type hecEvent struct {
+	Time       float64           `json:"time"`
+	Host       string            `json:"host,omitempty"`
+	Index      string            `json:"index,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	SourceType string            `json:"sourcetype,omitempty"`
+	Event      *corev1.Event     `json:"event"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+type hecResponse struct {
+	Text  string `json:"text"`
+	Code  int    `json:"code"`
+	AckID *int64 `json:"ackId,omitempty"`
+}
+
+func init() {
+	Register(Registration{
+		Type:     splunkHECSinkName,
+		Settings: SplunkHECSettings{},
+		New: func(_ context.Context, _ *Options, filters *filter.Sink) (ISink, error) {
+			return InitSplunkHECSink(filters)
+		},
+	})
+}
+
+func InitSplunkHECSink(filters *filter.Sink) (*SplunkHECSink, error) {
+	var settings SplunkHECSettings
+	if err := DecodeSettings(filters, &settings); err != nil {
+		return nil, err
+	}
+	if len(settings.URL) == 0 {
+		return nil, fmt.Errorf("url must be configured for splunk-hec sink")
+	}
+	token := settings.Token
+	if len(settings.TokenFile) > 0 {
+		fileToken, err := ReadSecretFile(settings.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = fileToken
+	}
+	if len(token) == 0 {
+		return nil, fmt.Errorf("token must be configured for splunk-hec sink")
+	}
+	channel := settings.Channel
+	if settings.Ack && len(channel) == 0 {
+		channel = uuid.NewString()
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: settings.InsecureSkipVerify} // #nosec G402 -- configured explicitly by user
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SplunkHECSink{
+		Sink:        NewSinkWithFilters(filters),
+		url:         strings.TrimSuffix(settings.URL, "/"),
+		token:       token,
+		index:       settings.Index,
+		source:      settings.Source,
+		sourceType:  settings.SourceType,
+		host:        settings.Host,
+		ack:         settings.Ack,
+		ackTimeout:  DurationOrDefault(settings.AckTimeout, defaultHECAckTimeout),
+		ackInterval: defaultHECAckInterval,
+		channel:     channel,
+		client:      &http.Client{Timeout: DurationOrDefault(settings.Timeout, defaultHECTimeout), Transport: transport},
+		batch: BatchOptions{
+			MaxEvents: IntOrDefault(settings.BatchSize, defaultHECBatchSize),
+			Linger:    DurationOrDefault(settings.FlushInterval, defaultHECFlushInterval),
+		},
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+func (ss *SplunkHECSink) Release(eventObj *corev1.Event) error {
+	if !ss.IsEventAllowed(eventObj) {
+		return nil
+	}
+	return ss.ReleaseBatch([]*corev1.Event{eventObj})[0]
+}
+
+func (ss *SplunkHECSink) BatchOptions() BatchOptions {
+	return ss.batch
+}
+
+// ReleaseBatch sends events with one request. Failed events are returned to the controller, which retries them
+func (ss *SplunkHECSink) ReleaseBatch(events []*corev1.Event) []error {
+	body, err := ss.encode(events)
+	if err != nil {
+		err = Permanent(fmt.Errorf("could not encode events for splunk: %w", err))
+	} else {
+		err = ss.send(ss.ctx, body)
+	}
+	errs := make([]error, len(events))
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Close cancels requests in progress and waits for acknowledgements
+func (ss *SplunkHECSink) Close(context.Context) error {
+	ss.cancel()
+	return nil
+}
+
+func (ss *SplunkHECSink) encode(batch []*corev1.Event) ([]byte, error) {
+	body := bytes.Buffer{}
+	encoder := json.NewEncoder(&body)
+	for _, eventObj := range batch {
+		event := hecEvent{
+			Time:       float64(format.ResolveTimestamp(eventObj).Time.UnixMilli()) / 1000,
+			Host:       ss.host,
+			Index:      ss.index,
+			Source:     ss.source,
+			SourceType: ss.sourceType,
+			Event:      eventObj,
+			Fields: map[string]string{
+				"namespace": eventObj.InvolvedObject.Namespace,
+				"kind":      eventObj.InvolvedObject.Kind,
+				"reason":    eventObj.Reason,
+				"type":      eventObj.Type,
+			},
+		}
+		if err := encoder.Encode(&event); err != nil {
+			return nil, err
+		}
+	}
+	return body.Bytes(), nil
+}
+
+// send posts batch of events and waits for the acknowledgement if it is enabled
+func (ss *SplunkHECSink) send(ctx context.Context, body []byte) error {
+	var response hecResponse
+	if err := ss.post(ctx, hecEventPath, body, &response); err != nil {
+		return err
+	}
+	if !ss.ack {
+		return nil
+	}
+	if response.AckID == nil {
+		return fmt.Errorf("splunk did not return ackId. Check that indexer acknowledgement is enabled for the token")
+	}
+	return ss.waitForAck(ctx, *response.AckID)
+}
+
+func (ss *SplunkHECSink) waitForAck(ctx context.Context, ackID int64) error {
+	body, err := json.Marshal(map[string][]int64{"acks": {ackID}})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, ss.ackTimeout)
+	defer cancel()
+	ticker := time.NewTicker(ss.ackInterval)
+	defer ticker.Stop()
+	for {
+		var response struct {
+			Acks map[string]bool `json:"acks"`
+		}
+		if err = ss.post(ctx, hecAckPath, body, &response); err != nil {
+			slog.Warn("could not check acknowledgement of events in splunk", "ackId", ackID, "error", err)
+		} else if response.Acks[strconv.FormatInt(ackID, 10)] {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("events with ackId %d were not acknowledged by splunk in %s", ackID, ss.ackTimeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+func (ss *SplunkHECSink) post(ctx context.Context, path string, body []byte, response any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, ss.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Splunk "+ss.token)
+	request.Header.Set("Content-Type", "application/json")
+	if len(ss.channel) > 0 {
+		request.Header.Set("X-Splunk-Request-Channel", ss.channel)
+	}
+	resp, err := ss.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("could not send request to splunk: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		err = fmt.Errorf("splunk responded with status %s", resp.Status)
+		// invalid token or payload is rejected again on retry
+		if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode < http.StatusInternalServerError && resp.StatusCode != http.StatusTooManyRequests {
+			return Permanent(err)
+		}
+		return err
+	}
+	if err = json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("could not parse response of splunk: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// newFakeHEC starts the receiver answering like Splunk HTTP Event Collector. The batch is acknowledged on the second
+// check of acknowledgements
+func newFakeHEC(t *testing.T) (*fakeReceiver, *httptest.Server) {
+	hec, server := newFakeReceiver(t)
+	acked := false
+	hec.respond = func(w http.ResponseWriter, request receivedRequest) {
+		assert.Equal(t, "Splunk secret", request.header.Get("Authorization"))
+		switch request.path {
+		case "/services/collector/event":
+			_, _ = w.Write([]byte(`{"text":"Success","code":0,"ackId":7}`))
+		case "/services/collector/ack":
+			_, _ = fmt.Fprintf(w, `{"acks":{"7":%v}}`, acked)
+			acked = true
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+	return hec, server
+}
+
+// hecEvents returns events sent to HEC and the number of requests with them
+func hecEvents(t *testing.T, hec *fakeReceiver) ([]map[string]any, int) {
+	var events []map[string]any
+	requests := 0
+	for _, request := range hec.received() {
+		if request.path != "/services/collector/event" {
+			continue
+		}
+		requests++
+		for line := range bytes.Lines(request.body) {
+			var event map[string]any
+			assert.NoError(t, json.Unmarshal(line, &event))
+			events = append(events, event)
+		}
+	}
+	return events, requests
+}
+
+func TestSplunkHECSink_Release(t *testing.T) {
+	hec, server := newFakeHEC(t)
+
+	testSink, err := InitSplunkHECSink(testSinkFilters("splunk-hec", fmt.Sprintf(`{"url":"%s","token":"secret","index":"k8s","source":"events-reader","sourcetype":"kube:event","batchSize":4,"flushInterval":"1h"}`, server.URL)))
+	assert.NoError(t, err)
+
+	assert.Equal(t, BatchOptions{MaxEvents: 4, Linger: time.Hour}, testSink.BatchOptions())
+	for _, err = range testSink.ReleaseBatch(test.TestEventsSlice) {
+		assert.NoError(t, err)
+	}
+	events, requests := hecEvents(t, hec)
+	assert.Equal(t, 4, len(events))
+	assert.Equal(t, 1, requests, "Events should be sent in one batch")
+	event := events[1]
+	assert.Equal(t, "k8s", event["index"])
+	assert.Equal(t, "events-reader", event["source"])
+	assert.Equal(t, "kube:event", event["sourcetype"])
+	assert.Equal(t, float64(test.LastTs.UnixMilli())/1000, event["time"])
+	assert.Equal(t, map[string]any{"namespace": "tracing", "kind": "Pod", "reason": "BackOff", "type": "Warning"}, event["fields"])
+	assert.Equal(t, "Back-off restarting failed container", event["event"].(map[string]any)["message"])
+}
+
+func TestSplunkHECSink_Release_Ack(t *testing.T) {
+	hec, server := newFakeHEC(t)
+
+	testSink, err := InitSplunkHECSink(testSinkFilters("splunk-hec", fmt.Sprintf(`{"url":"%s","token":"secret","ack":true,"channel":"test-channel","flushInterval":"10ms"}`, server.URL)))
+	assert.NoError(t, err)
+
+	assert.NoError(t, testSink.Release(test.EventPodTracing))
+
+	_, requests := hecEvents(t, hec)
+	assert.Equal(t, 1, requests, "Acknowledged batch should not be re-sent")
+	received := hec.received()
+	assert.Len(t, received, 3, "Acknowledgement should be checked until the batch is acknowledged")
+	for _, request := range received {
+		assert.Equal(t, "test-channel", request.header.Get("X-Splunk-Request-Channel"))
+	}
+}
+
+func TestSplunkHECSink_ReleaseBatch_Error(t *testing.T) {
+	hec, server := newFakeReceiver(t)
+	hec.failures = 1
+
+	testSink, err := InitSplunkHECSink(testSinkFilters("splunk-hec", fmt.Sprintf(`{"url":"%s","token":"secret"}`, server.URL)))
+	assert.NoError(t, err)
+	errs := testSink.ReleaseBatch([]*corev1.Event{test.EventPodTracing, test.EventPodLogging})
+	assert.Len(t, errs, 2)
+	for _, err = range errs {
+		assert.Error(t, err, "Failed events should be returned to the controller")
+		assert.False(t, IsPermanent(err), "Unavailable splunk should be retried")
+	}
+	assert.Len(t, hec.received(), 1, "Batch should be retried by the controller, not by the sink")
+
+	hec.respond = func(w http.ResponseWriter, _ receivedRequest) {
+		w.WriteHeader(http.StatusForbidden)
+	}
+	assert.True(t, IsPermanent(testSink.Release(test.EventPodTracing)), "Invalid token should not be retried")
+	hec.respond = func(w http.ResponseWriter, _ receivedRequest) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+	assert.False(t, IsPermanent(testSink.Release(test.EventPodTracing)), "Throttled requests should be retried")
+}
+
+func TestSplunkHECSink_Close_CancelsAck(t *testing.T) {
+	hec, server := newFakeReceiver(t)
+	hec.respond = func(w http.ResponseWriter, request receivedRequest) {
+		if request.path == hecEventPath {
+			_, _ = w.Write([]byte(`{"text":"Success","code":0,"ackId":7}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"acks":{"7":false}}`))
+	}
+
+	testSink, err := InitSplunkHECSink(testSinkFilters("splunk-hec", fmt.Sprintf(`{"url":"%s","token":"secret","ack":true,"ackTimeout":"1h"}`, server.URL)))
+	assert.NoError(t, err)
+	time.AfterFunc(100*time.Millisecond, func() {
+		assert.NoError(t, testSink.Close(context.Background()))
+	})
+	released := make(chan error)
+	go func() {
+		released <- testSink.Release(test.EventPodTracing)
+	}()
+	select {
+	case err = <-released:
+		assert.Error(t, err, "Not acknowledged batch should fail")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close should cancel the wait for acknowledgement")
+	}
+}
+
+func TestInitSplunkHECSink_InvalidSettings(t *testing.T) {
+	_, err := InitSplunkHECSink(testSinkFilters("splunk-hec", `{"token":"secret"}`))
+	assert.Error(t, err)
+	_, err = InitSplunkHECSink(testSinkFilters("splunk-hec", `{"url":"http://localhost"}`))
+	assert.Error(t, err)
+}
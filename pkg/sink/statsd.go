@@ -0,0 +1,238 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/aggregation"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/format"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	statsdSinkName = "statsd"
+
+	statsdProtocolUDP      = "udp"
+	statsdProtocolUnixgram = "unixgram"
+
+	statsdFormatDogStatsD = "dogstatsd"
+	statsdFormatStatsD    = "statsd"
+
+	defaultStatsDMetricName = "kube_events.total"
+	// defaultStatsDUDPPacketSize fits into Ethernet MTU with IPv6 and UDP headers
+	defaultStatsDUDPPacketSize      = 1432
+	defaultStatsDUnixgramPacketSize = 8192
+	defaultStatsDFlushInterval      = time.Second
+	defaultStatsDTimeout            = 5 * time.Second
+)
+
+// statsdTagReplacer removes characters that have special meaning in DogStatsD datagrams
+var statsdTagReplacer = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", " ", "\r", " ")
+
+type StatsDSettings struct {
+	// Protocol is udp or unixgram
+	Protocol string `json:"protocol,omitempty"`
+	// Address is host:port for udp protocol or path to socket for unixgram protocol
+	Address string `json:"address"`
+	// MetricName is a template of the name of counter incremented for each event
+	MetricName string `json:"metricName,omitempty"`
+	// Format is dogstatsd (with tags) or statsd (without tags)
+	Format string `json:"format,omitempty"`
+	// Tags are added to tags of each metric in dogstatsd format, e.g. env or cluster
+	Tags map[string]string `json:"tags,omitempty"`
+	// MaxPacketSize is the maximum size of datagram with batch of metrics
+	MaxPacketSize int             `json:"maxPacketSize,omitempty"`
+	FlushInterval metav1.Duration `json:"flushInterval,omitempty"`
+	Timeout       metav1.Duration `json:"timeout,omitempty"`
+}
+
+type StatsDSink struct {
+	*Sink
+	protocol      string
+	address       string
+	metricName    *template.Template
+	dogStatsD     bool
+	tags          []string
+	maxPacketSize int
+	timeout       time.Duration
+
+	mu     sync.Mutex
+	packet bytes.Buffer
+	conn   net.Conn
+}
+
+func init() {
+	Register(Registration{
+		Type:     statsdSinkName,
+		Settings: StatsDSettings{},
+		New: func(ctx context.Context, _ *Options, filters *filter.Sink) (ISink, error) {
+			return InitStatsDSink(ctx, filters)
+		},
+	})
+}
+
+func InitStatsDSink(ctx context.Context, filters *filter.Sink) (*StatsDSink, error) {
+	var settings StatsDSettings
+	if err := DecodeSettings(filters, &settings); err != nil {
+		return nil, err
+	}
+	protocol := strings.ToLower(ValueOrDefault(settings.Protocol, statsdProtocolUDP))
+	defaultPacketSize := defaultStatsDUDPPacketSize
+	switch protocol {
+	case statsdProtocolUDP:
+	case statsdProtocolUnixgram:
+		defaultPacketSize = defaultStatsDUnixgramPacketSize
+	default:
+		return nil, fmt.Errorf("statsd protocol is not supported: %s", settings.Protocol)
+	}
+	if len(settings.Address) == 0 {
+		return nil, fmt.Errorf("address must be configured for statsd sink")
+	}
+	metricsFormat := strings.ToLower(ValueOrDefault(settings.Format, statsdFormatDogStatsD))
+	if metricsFormat != statsdFormatDogStatsD && metricsFormat != statsdFormatStatsD {
+		return nil, fmt.Errorf("statsd format is not supported: %s", settings.Format)
+	}
+	metricName, err := format.ParseEventTemplate(statsdSinkName, ValueOrDefault(settings.MetricName, defaultStatsDMetricName))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse metric name template of statsd sink: %w", err)
+	}
+	var tags []string
+	for _, name := range slices.Sorted(maps.Keys(settings.Tags)) {
+		tags = append(tags, statsdTag(name, settings.Tags[name]))
+	}
+	statsdSink := &StatsDSink{
+		Sink:          NewSinkWithFilters(filters),
+		protocol:      protocol,
+		address:       settings.Address,
+		metricName:    metricName,
+		dogStatsD:     metricsFormat == statsdFormatDogStatsD,
+		tags:          tags,
+		maxPacketSize: IntOrDefault(settings.MaxPacketSize, defaultPacketSize),
+		timeout:       DurationOrDefault(settings.Timeout, defaultStatsDTimeout),
+	}
+	aggregation.InitAggregations()
+	go statsdSink.run(ctx, DurationOrDefault(settings.FlushInterval, defaultStatsDFlushInterval))
+	return statsdSink, nil
+}
+
+// Release adds counter increment to the current packet. The packet is sent when the next metric does not fit into it
+// or by flush interval
+func (ss *StatsDSink) Release(eventObj *corev1.Event) error {
+	if !ss.IsEventAllowed(eventObj) {
+		return nil
+	}
+	metric, err := ss.metric(eventObj)
+	if err != nil {
+		return err
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.packet.Len() > 0 && ss.packet.Len()+1+len(metric) > ss.maxPacketSize {
+		if err = ss.flush(); err != nil {
+			return err
+		}
+	}
+	if ss.packet.Len() > 0 {
+		ss.packet.WriteByte('\n')
+	}
+	ss.packet.WriteString(metric)
+	return nil
+}
+
+// metric returns counter increment in StatsD format: <name>:1|c|#<tags>
+func (ss *StatsDSink) metric(eventObj *corev1.Event) (string, error) {
+	name := strings.Builder{}
+	if err := ss.metricName.Execute(&name, eventObj); err != nil {
+		return "", fmt.Errorf("could not render statsd metric name: %w", err)
+	}
+	metric := strings.Map(func(r rune) rune {
+		if r == ':' || r == '|' || r == '@' || r == '#' || r == '\n' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, name.String()) + ":1|c"
+	if !ss.dogStatsD {
+		return metric, nil
+	}
+	tags := append(slices.Clone(ss.tags),
+		statsdTag("kind", eventObj.InvolvedObject.Kind),
+		statsdTag("namespace", eventObj.InvolvedObject.Namespace),
+		statsdTag("type", eventObj.Type),
+		statsdTag("reason", eventObj.Reason),
+		statsdTag("message", aggregation.GetCommonMessage(eventObj.InvolvedObject.Kind, eventObj.Reason, eventObj.Message)),
+	)
+	return metric + "|#" + strings.Join(tags, ","), nil
+}
+
+func statsdTag(name string, value string) string {
+	return statsdTagReplacer.Replace(name) + ":" + statsdTagReplacer.Replace(value)
+}
+
+func (ss *StatsDSink) run(ctx context.Context, flushInterval time.Duration) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ss.flushWithLog()
+		}
+	}
+}
+
+// Close sends the current packet and closes the connection
+func (ss *StatsDSink) Close(context.Context) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	err := ss.flush()
+	if ss.conn != nil {
+		_ = ss.conn.Close()
+		ss.conn = nil
+	}
+	return err
+}
+
+func (ss *StatsDSink) flushWithLog() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if err := ss.flush(); err != nil {
+		slog.Error("could not send metrics to statsd", "error", err)
+	}
+}
+
+// flush sends the current packet. The packet is dropped on error, so one broken datagram does not block next ones.
+// Connection is re-established on the next attempt after error, e.g. if the agent re-creates unix socket
+func (ss *StatsDSink) flush() error {
+	if ss.packet.Len() == 0 {
+		return nil
+	}
+	defer ss.packet.Reset()
+	if ss.conn == nil {
+		conn, err := net.DialTimeout(ss.protocol, ss.address, ss.timeout)
+		if err != nil {
+			return fmt.Errorf("could not connect to statsd %s: %w", ss.address, err)
+		}
+		ss.conn = conn
+	}
+	if err := ss.conn.SetWriteDeadline(time.Now().Add(ss.timeout)); err != nil {
+		return err
+	}
+	if _, err := ss.conn.Write(ss.packet.Bytes()); err != nil {
+		_ = ss.conn.Close()
+		ss.conn = nil
+		return fmt.Errorf("could not send metrics to statsd %s: %w", ss.address, err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package sink
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// readDatagram returns the next datagram received by the listener or empty string by timeout
+func readDatagram(t *testing.T, conn net.PacketConn) string {
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 65536)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		return ""
+	}
+	return string(buf[:n])
+}
+
+func TestStatsDSink_Release_DogStatsD(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	settings := fmt.Sprintf(`{"address":"%s","metricName":"k8s.{{.Type}}.events","tags":{"env":"test"},"flushInterval":"10ms"}`, conn.LocalAddr())
+	testSink, err := InitStatsDSink(t.Context(), testSinkFilters("statsd", settings))
+	assert.NoError(t, err)
+	assert.NoError(t, testSink.Release(test.EventPodTracing))
+
+	datagram := readDatagram(t, conn)
+	assert.True(t, strings.HasPrefix(datagram, "k8s.Warning.events:1|c|#env:test,kind:Pod,namespace:tracing,type:Warning,reason:BackOff,message:"), datagram)
+	assert.NotContains(t, datagram, "\n")
+}
+
+func TestStatsDSink_Release_Batch(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	settings := fmt.Sprintf(`{"address":"%s","format":"statsd","maxPacketSize":40,"flushInterval":"1h"}`, conn.LocalAddr())
+	testSink, err := InitStatsDSink(t.Context(), testSinkFilters("statsd", settings))
+	assert.NoError(t, err)
+	for _, event := range test.TestEventsSlice {
+		assert.NoError(t, testSink.Release(event))
+	}
+
+	// Each metric is 21 bytes, so only one metric fits into packet of 40 bytes together with separator
+	for range len(test.TestEventsSlice) - 1 {
+		assert.Equal(t, "kube_events.total:1|c", readDatagram(t, conn))
+	}
+	assert.NoError(t, testSink.Close(t.Context()), "The last packet should be sent on close")
+	assert.Equal(t, "kube_events.total:1|c", readDatagram(t, conn))
+}
+
+func TestStatsDSink_Release_Unixgram(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "dsd.socket")
+	conn, err := net.ListenPacket("unixgram", socket)
+	assert.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	settings := fmt.Sprintf(`{"protocol":"unixgram","address":"%s","flushInterval":"1h"}`, socket)
+	testSink, err := InitStatsDSink(t.Context(), testSinkFilters("statsd", settings))
+	assert.NoError(t, err)
+	for _, event := range test.TestEventsSlice {
+		assert.NoError(t, testSink.Release(event))
+	}
+	testSink.flushWithLog()
+
+	metrics := strings.Split(readDatagram(t, conn), "\n")
+	assert.Len(t, metrics, len(test.TestEventsSlice), "All metrics should be sent in one datagram")
+	assert.Contains(t, metrics[0], "namespace:logging,type:Normal")
+}
+
+func TestInitStatsDSink_InvalidSettings(t *testing.T) {
+	for _, settings := range []string{
+		`{}`,
+		`{"protocol":"tcp","address":"localhost:8125"}`,
+		`{"address":"localhost:8125","format":"graphite"}`,
+		`{"address":"localhost:8125","metricName":"{{.Type"}`,
+	} {
+		_, err := InitStatsDSink(t.Context(), testSinkFilters("statsd", settings))
+		assert.Error(t, err, settings)
+	}
+}
@@ -1,30 +1,104 @@
 package sink
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"text/template"
 
 	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
 	"github.com/Netcracker/qubership-kube-events-reader/pkg/format"
 	corev1 "k8s.io/api/core/v1"
 )
 
+const stdoutLayoutTemplate = "template"
+
+type StdoutSettings struct {
+	// Format overrides format of command line parameters for this sink. Presets, e.g. cloudevents, are supported
+	Format string `json:"format,omitempty"`
+	// FormatFile is the path to the file with format, e.g. mounted from ConfigMap. It cannot be used with Format
+	FormatFile string `json:"formatFile,omitempty"`
+	// Layout is template (default) to print events by format or json, logfmt or ecs to encode fields of events
+	Layout string `json:"layout,omitempty"`
+	// Fields are printed in json and logfmt layouts and mapped to Elastic Common Schema in ecs layout
+	Fields []string `json:"fields,omitempty"`
+}
+
 type StdoutSink struct {
 	*Sink
+	template   *template.Template
+	structured *format.StructuredFormatter
+}
+
+func init() {
+	Register(Registration{
+		Type:     "logs",
+		Settings: StdoutSettings{},
+		New: func(_ context.Context, options *Options, filters *filter.Sink) (ISink, error) {
+			return InitStdoutSink(options.PrintFormat, filters)
+		},
+	})
 }
 
 func InitStdoutSink(printFormat string, filters *filter.Sink) (*StdoutSink, error) {
-	err := format.SetFormat(printFormat)
+	var settings StdoutSettings
+	if err := DecodeSettings(filters, &settings); err != nil {
+		return nil, err
+	}
+	layout := ValueOrDefault(settings.Layout, stdoutLayoutTemplate)
+	if layout != stdoutLayoutTemplate {
+		if len(settings.Format) > 0 || len(settings.FormatFile) > 0 {
+			return nil, fmt.Errorf("format of sink %s cannot be used with %s layout", filters.Name, layout)
+		}
+		structured, err := format.NewStructuredFormatter(layout, settings.Fields)
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize layout of sink %s: %w", filters.Name, err)
+		}
+		return &StdoutSink{Sink: NewSinkWithFilters(filters), structured: structured}, nil
+	}
+	if len(settings.Fields) > 0 {
+		return nil, fmt.Errorf("fields of sink %s can be used only with json, logfmt or ecs layout", filters.Name)
+	}
+	eventTemplate, err := newSinkTemplate(printFormat, settings)
 	if err != nil {
 		return nil, err
 	}
-	sink := initializeSinkWithFilters(filters)
-	return &StdoutSink{Sink: sink}, nil
+	sink := NewSinkWithFilters(filters)
+	return &StdoutSink{Sink: sink, template: eventTemplate}, nil
+}
+
+// newSinkTemplate parses format of the sink from settings or from command line parameters if the sink has no own format
+func newSinkTemplate(printFormat string, settings StdoutSettings) (*template.Template, error) {
+	var eventTemplate *template.Template
+	var err error
+	switch {
+	case len(settings.Format) > 0 && len(settings.FormatFile) > 0:
+		err = errors.New("format and formatFile cannot be set together")
+	case len(settings.FormatFile) > 0:
+		eventTemplate, err = format.NewTemplateFromFile(settings.FormatFile)
+	case len(settings.Format) > 0:
+		eventTemplate, err = format.NewTemplate(settings.Format)
+	default:
+		return format.NewTemplate(printFormat)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse format of sink: %w", err)
+	}
+	return eventTemplate, nil
 }
 
 func (ss *StdoutSink) Release(eventObj *corev1.Event) error {
 	if !ss.IsEventAllowed(eventObj) {
 		return nil
 	}
-	fmt.Println(format.FormatEvent(eventObj))
+	if ss.structured != nil {
+		formatted, err := ss.structured.Format(eventObj)
+		if err != nil {
+			return fmt.Errorf("could not format event: %w", err)
+		}
+		fmt.Println(formatted)
+		return nil
+	}
+	fmt.Println(format.FormatEventWithTemplate(ss.template, eventObj))
 	return nil
 }
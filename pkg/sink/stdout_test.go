@@ -1,14 +1,16 @@
 package sink
 
 import (
+	"encoding/json"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/Netcracker/qubership-kube-events-reader/pkg/filter"
-	"github.com/Netcracker/qubership-kube-events-reader/pkg/format"
 	"github.com/Netcracker/qubership-kube-events-reader/pkg/test"
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
 )
 
 func TestStdoutSink_InitMetricsSink_Release_WithoutFilters(t *testing.T) {
@@ -37,19 +39,19 @@ func TestStdoutSink_InitMetricsSink_Release_WithoutFilters(t *testing.T) {
 	assert.NotEqual(t, 0, len(result), "Stdout file should not be empty")
 
 	expectedEventLog := strings.Builder{}
-	assert.NoError(t, format.FormatTemplate.Execute(&expectedEventLog, test.EventPodLogging), "No error should happen")
+	assert.NoError(t, testSink.template.Execute(&expectedEventLog, test.EventPodLogging), "No error should happen")
 	assert.True(t, strings.Contains(string(result), expectedEventLog.String()), "Stdout file should contain the event from logging namespace")
 
 	expectedEventLog.Reset()
-	assert.NoError(t, format.FormatTemplate.Execute(&expectedEventLog, test.EventPodTracing), "No error should happen")
+	assert.NoError(t, testSink.template.Execute(&expectedEventLog, test.EventPodTracing), "No error should happen")
 	assert.True(t, strings.Contains(string(result), expectedEventLog.String()), "Stdout file should contain the event from tracing namespace")
 
 	expectedEventLog.Reset()
-	assert.NoError(t, format.FormatTemplate.Execute(&expectedEventLog, test.EventDeploymentMonitoring), "No error should happen")
+	assert.NoError(t, testSink.template.Execute(&expectedEventLog, test.EventDeploymentMonitoring), "No error should happen")
 	assert.True(t, strings.Contains(string(result), expectedEventLog.String()), "Stdout file should contain the event from monitoring namespace with Deployment kind of involved object")
 
 	expectedEventLog.Reset()
-	assert.NoError(t, format.FormatTemplate.Execute(&expectedEventLog, test.EventPvcMonitoring), "No error should happen")
+	assert.NoError(t, testSink.template.Execute(&expectedEventLog, test.EventPvcMonitoring), "No error should happen")
 	assert.True(t, strings.Contains(string(result), expectedEventLog.String()), "Stdout file should contain the event from monitoring namespace with PVC kind of involved object")
 
 }
@@ -79,19 +81,123 @@ func TestStdoutSink_InitMetricsSink_Release_WithFilters(t *testing.T) {
 	assert.NotEqual(t, 0, len(result), "Stdout file should not be empty")
 
 	expectedEventLog := strings.Builder{}
-	assert.NoError(t, format.FormatTemplate.Execute(&expectedEventLog, test.EventPodLogging), "No error should happen")
+	assert.NoError(t, testSink.template.Execute(&expectedEventLog, test.EventPodLogging), "No error should happen")
 	assert.False(t, strings.Contains(string(result), expectedEventLog.String()), "Stdout file should contain the event with type normal")
 
 	expectedEventLog.Reset()
-	assert.NoError(t, format.FormatTemplate.Execute(&expectedEventLog, test.EventPodTracing), "No error should happen")
+	assert.NoError(t, testSink.template.Execute(&expectedEventLog, test.EventPodTracing), "No error should happen")
 	assert.True(t, strings.Contains(string(result), expectedEventLog.String()), "Stdout file should contain the event from tracing namespace")
 
 	expectedEventLog.Reset()
-	assert.NoError(t, format.FormatTemplate.Execute(&expectedEventLog, test.EventDeploymentMonitoring), "No error should happen")
+	assert.NoError(t, testSink.template.Execute(&expectedEventLog, test.EventDeploymentMonitoring), "No error should happen")
 	assert.True(t, strings.Contains(string(result), expectedEventLog.String()), "Stdout file should contain the event from monitoring namespace with Deployment kind of involved object")
 
 	expectedEventLog.Reset()
-	assert.NoError(t, format.FormatTemplate.Execute(&expectedEventLog, test.EventPvcMonitoring), "No error should happen")
+	assert.NoError(t, testSink.template.Execute(&expectedEventLog, test.EventPvcMonitoring), "No error should happen")
 	assert.True(t, strings.Contains(string(result), expectedEventLog.String()), "Stdout file should contain the event from monitoring namespace with PVC kind of involved object")
 
 }
+
+func TestStdoutSink_Release_InstancesWithOwnFormat(t *testing.T) {
+	warnings, err := InitStdoutSink("", &filter.Sink{
+		Name:     "warnings",
+		Type:     "logs",
+		Match:    []filter.EventMatch{{Type: "Warning"}},
+		Settings: json.RawMessage(`{"format":"WARNING {{.InvolvedObject.Namespace}}/{{.InvolvedObject.Name}}: {{.Message}}"}`),
+	})
+	assert.NoError(t, err)
+	others, err := InitStdoutSink("", &filter.Sink{
+		Name:     "others",
+		Type:     "logs",
+		Exclude:  []filter.EventMatch{{Type: "Warning"}},
+		Settings: json.RawMessage(`{"format":"{{.Type}} {{.Reason}}"}`),
+	})
+	assert.NoError(t, err)
+
+	initialStdout := os.Stdout
+	fname, err := test.ChangeStdoutToFile("stdout5")
+	defer func(t *testing.T) {
+		assert.NoError(t, test.ChangeFileToStdout(initialStdout))
+	}(t)
+	assert.NoError(t, err, "No error should happen")
+
+	for _, event := range []*corev1.Event{test.EventPodLogging, test.EventPodTracing} {
+		assert.NoError(t, warnings.Release(event))
+		assert.NoError(t, others.Release(event))
+	}
+
+	result, err := os.ReadFile(fname)
+	assert.NoError(t, err, "No error should happen")
+	assert.Equal(t, "Normal Started\nWARNING tracing/test-pod: Back-off restarting failed container\n", string(result))
+}
+
+func TestInitStdoutSink_InvalidFormat(t *testing.T) {
+	_, err := InitStdoutSink("", &filter.Sink{Name: "logs", Settings: json.RawMessage(`{"format":"{{.Type"}`)})
+	assert.Error(t, err)
+}
+
+func TestStdoutSink_Release_LogfmtLayout(t *testing.T) {
+	stdoutSink, err := InitStdoutSink("", &filter.Sink{
+		Name:     "logfmt",
+		Type:     "logs",
+		Settings: json.RawMessage(`{"layout":"logfmt","fields":["type","involvedObjectName","message"]}`),
+	})
+	assert.NoError(t, err)
+
+	initialStdout := os.Stdout
+	fname, err := test.ChangeStdoutToFile("stdout6")
+	defer func(t *testing.T) {
+		assert.NoError(t, test.ChangeFileToStdout(initialStdout))
+	}(t)
+	assert.NoError(t, err, "No error should happen")
+
+	assert.NoError(t, stdoutSink.Release(test.EventPodTracing))
+
+	result, err := os.ReadFile(fname)
+	assert.NoError(t, err, "No error should happen")
+	assert.Equal(t, "type=Warning involvedObjectName=test-pod message=\"Back-off restarting failed container\"\n", string(result))
+}
+
+func TestInitStdoutSink_InvalidLayout(t *testing.T) {
+	for _, settings := range []string{
+		`{"layout":"xml"}`,
+		`{"layout":"json","fields":["unknown"]}`,
+		`{"layout":"json","format":"{{.Type}}"}`,
+		`{"fields":["message"]}`,
+	} {
+		_, err := InitStdoutSink("", &filter.Sink{Name: "logs", Settings: json.RawMessage(settings)})
+		assert.Error(t, err, settings)
+	}
+}
+
+func TestStdoutSink_Release_FormatFile(t *testing.T) {
+	formatFile := filepath.Join(t.TempDir(), "format.tmpl")
+	assert.NoError(t, os.WriteFile(formatFile, []byte("{{.Type}}/{{.Reason}}\n"), 0o600))
+	stdoutSink, err := InitStdoutSink("{{.Message}}", &filter.Sink{
+		Name:     "file",
+		Type:     "logs",
+		Settings: json.RawMessage(`{"formatFile":"` + formatFile + `"}`),
+	})
+	assert.NoError(t, err)
+
+	initialStdout := os.Stdout
+	fname, err := test.ChangeStdoutToFile("stdout7")
+	defer func(t *testing.T) {
+		assert.NoError(t, test.ChangeFileToStdout(initialStdout))
+	}(t)
+	assert.NoError(t, err, "No error should happen")
+
+	assert.NoError(t, stdoutSink.Release(test.EventPodTracing))
+
+	result, err := os.ReadFile(fname)
+	assert.NoError(t, err, "No error should happen")
+	assert.Equal(t, "Warning/BackOff\n", string(result), "Format from file should override format of command line parameters")
+}
+
+func TestInitStdoutSink_FormatAndFormatFile(t *testing.T) {
+	_, err := InitStdoutSink("", &filter.Sink{Name: "logs", Settings: json.RawMessage(`{"format":"{{.Type}}","formatFile":"/tmp/format.tmpl"}`)})
+	assert.Error(t, err)
+
+	_, err = InitStdoutSink("{{.Unknown}}", &filter.Sink{Name: "logs"})
+	assert.Error(t, err, "Format of command line parameters should be checked by rendering sample event")
+}
@@ -1,11 +1,8 @@
 package test
 
 import (
-	"context"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"time"
@@ -136,9 +133,3 @@ func ChangeFileToStdout(initialStdout *os.File) error {
 	err := os.Remove(fileStdout.Name())
 	return err
 }
-
-var FakeServer = &httptest.Server{}
-
-func StartFakeHttpServer(ctx context.Context, port string) {
-	FakeServer = httptest.NewServer(promhttp.Handler())
-}
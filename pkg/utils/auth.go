@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Modes of authentication of requests to protected endpoints
+const (
+	AuthModeToken      = "token"
+	AuthModeKubernetes = "kubernetes"
+)
+
+// tokenReviewCacheTTL is the time results of reviews of authenticated tokens are cached, so each scrape does not
+// create reviews in API server
+const tokenReviewCacheTTL = time.Minute
+
+var (
+	ErrUnauthenticated = errors.New("token is not valid")
+	ErrForbidden       = errors.New("access is forbidden")
+)
+
+// TokenAuthorizer checks bearer tokens of requests to protected endpoints
+type TokenAuthorizer interface {
+	// Authorize returns ErrUnauthenticated if the token is not valid and ErrForbidden if the token is not allowed to
+	// get the path
+	Authorize(ctx context.Context, token string, path string) error
+}
+
+// NewTokenAuthorizer creates the authorizer of the mode. Nil is returned if the mode is empty
+func NewTokenAuthorizer(mode string, tokenFile string, client kubernetes.Interface) (TokenAuthorizer, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case AuthModeToken:
+		if len(tokenFile) == 0 {
+			return nil, fmt.Errorf("token file must be set for %s authentication", AuthModeToken)
+		}
+		content, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read token file: %w", err)
+		}
+		token := strings.TrimSpace(string(content))
+		if len(token) == 0 {
+			return nil, fmt.Errorf("token file %s is empty", tokenFile)
+		}
+		return &staticTokenAuthorizer{token: token}, nil
+	case AuthModeKubernetes:
+		return newKubernetesAuthorizer(client), nil
+	default:
+		return nil, fmt.Errorf("authentication mode must be one of %s, %s. Given value: %s", AuthModeToken, AuthModeKubernetes, mode)
+	}
+}
+
+// RequireToken serves the request by the handler only if its bearer token is authorized to get the path. The path is
+// the endpoint, e.g. the metrics path, and not the path of the request, so results cached by the authorizer are
+// limited by the number of endpoints
+func RequireToken(authorizer TokenAuthorizer, path string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		scheme, token, _ := strings.Cut(request.Header.Get("Authorization"), " ")
+		token = strings.TrimSpace(token)
+		err := ErrUnauthenticated
+		if strings.EqualFold(scheme, "Bearer") && len(token) > 0 {
+			err = authorizer.Authorize(request.Context(), token, path)
+		}
+		switch {
+		case err == nil:
+			handler.ServeHTTP(responseWriter, request)
+		case errors.Is(err, ErrUnauthenticated):
+			responseWriter.Header().Set("WWW-Authenticate", `Bearer realm="kube-events-reader"`)
+			http.Error(responseWriter, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		case errors.Is(err, ErrForbidden):
+			http.Error(responseWriter, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		default:
+			slog.Error("could not authorize request", "path", request.URL.Path, "error", err)
+			http.Error(responseWriter, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	})
+}
+
+// staticTokenAuthorizer allows requests with the token for all paths
+type staticTokenAuthorizer struct {
+	token string
+}
+
+func (a *staticTokenAuthorizer) Authorize(_ context.Context, token string, _ string) error {
+	if subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+		return ErrUnauthenticated
+	}
+	return nil
+}
+
+type tokenReviewKey struct {
+	token [sha256.Size]byte
+	path  string
+}
+
+type tokenReviewResult struct {
+	err     error
+	expires time.Time
+}
+
+// kubernetesAuthorizer authenticates the token by TokenReview and checks that its user can get the path by
+// SubjectAccessReview of non-resource URL, so access is granted by RBAC, e.g. by ClusterRole with nonResourceURLs
+type kubernetesAuthorizer struct {
+	client kubernetes.Interface
+	mu     sync.Mutex
+	// results are cached results of authenticated tokens. Invalid tokens are not cached, so they cannot fill the cache
+	results map[tokenReviewKey]tokenReviewResult
+	now     func() time.Time
+}
+
+func newKubernetesAuthorizer(client kubernetes.Interface) *kubernetesAuthorizer {
+	return &kubernetesAuthorizer{client: client, results: make(map[tokenReviewKey]tokenReviewResult), now: time.Now}
+}
+
+func (a *kubernetesAuthorizer) Authorize(ctx context.Context, token string, path string) error {
+	key := tokenReviewKey{token: sha256.Sum256([]byte(token)), path: path}
+	a.mu.Lock()
+	result, ok := a.results[key]
+	a.mu.Unlock()
+	if ok && a.now().Before(result.expires) {
+		return result.err
+	}
+	review, err := a.client.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("could not create TokenReview: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return ErrUnauthenticated
+	}
+	user := review.Status.User
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for name, values := range user.Extra {
+		extra[name] = authorizationv1.ExtraValue(values)
+	}
+	accessReview, err := a.client.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:                  user.Username,
+			UID:                   user.UID,
+			Groups:                user.Groups,
+			Extra:                 extra,
+			NonResourceAttributes: &authorizationv1.NonResourceAttributes{Path: path, Verb: "get"},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("could not create SubjectAccessReview: %w", err)
+	}
+	if !accessReview.Status.Allowed {
+		err = ErrForbidden
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	for cached, cachedResult := range a.results {
+		if !now.Before(cachedResult.expires) {
+			delete(a.results, cached)
+		}
+	}
+	a.results[key] = tokenReviewResult{err: err, expires: now.Add(tokenReviewCacheTTL)}
+	return err
+}
@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newFakeReviewClient authenticates the token scraper as user prometheus, which can get /metrics only
+func newFakeReviewClient(reviews *int) *fake.Clientset {
+	client := fake.NewClientset()
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		*reviews++
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if review.Spec.Token == "scraper" {
+			review.Status.Authenticated = true
+			review.Status.User = authenticationv1.UserInfo{Username: "system:serviceaccount:monitoring:prometheus", Groups: []string{"system:serviceaccounts"}}
+		}
+		return true, review, nil
+	})
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attributes := review.Spec.NonResourceAttributes
+		review.Status.Allowed = review.Spec.User == "system:serviceaccount:monitoring:prometheus" &&
+			attributes != nil && attributes.Path == "/metrics" && attributes.Verb == "get"
+		return true, review, nil
+	})
+	return client
+}
+
+func TestRequireToken_Kubernetes(t *testing.T) {
+	var reviews int
+	authorizer, err := NewTokenAuthorizer(AuthModeKubernetes, "", newFakeReviewClient(&reviews))
+	require.NoError(t, err)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	metrics := RequireToken(authorizer, "/metrics", handler)
+	pprof := RequireToken(authorizer, "/debug/pprof/", handler)
+
+	for _, tc := range []struct {
+		handler       http.Handler
+		path          string
+		authorization string
+		expected      int
+	}{
+		{metrics, "/metrics", "", http.StatusUnauthorized},
+		{metrics, "/metrics", "Basic c2NyYXBlcg==", http.StatusUnauthorized},
+		{metrics, "/metrics", "Bearer unknown", http.StatusUnauthorized},
+		{metrics, "/metrics", "Bearer scraper", http.StatusOK},
+		{metrics, "/metrics", "bearer scraper", http.StatusOK},
+		{metrics, "/metrics/other", "Bearer scraper", http.StatusOK},
+		{pprof, "/debug/pprof/", "Bearer scraper", http.StatusForbidden},
+		{pprof, "/debug/pprof/heap", "Bearer scraper", http.StatusForbidden},
+	} {
+		request := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if len(tc.authorization) > 0 {
+			request.Header.Set("Authorization", tc.authorization)
+		}
+		recorder := httptest.NewRecorder()
+		tc.handler.ServeHTTP(recorder, request)
+		assert.Equal(t, tc.expected, recorder.Code, "%s %s", tc.path, tc.authorization)
+	}
+	assert.Equal(t, 3, reviews, "Results of authenticated tokens should be cached by endpoint, not by path of the request")
+}
+
+func TestKubernetesAuthorizer_CacheExpiry(t *testing.T) {
+	var reviews int
+	authorizer := newKubernetesAuthorizer(newFakeReviewClient(&reviews))
+	now := time.Now()
+	authorizer.now = func() time.Time { return now }
+
+	assert.NoError(t, authorizer.Authorize(context.Background(), "scraper", "/metrics"))
+	assert.NoError(t, authorizer.Authorize(context.Background(), "scraper", "/metrics"))
+	assert.Equal(t, 1, reviews)
+
+	now = now.Add(tokenReviewCacheTTL)
+	assert.NoError(t, authorizer.Authorize(context.Background(), "scraper", "/metrics"))
+	assert.Equal(t, 2, reviews, "Token should be reviewed again after the cache expires")
+	assert.ErrorIs(t, authorizer.Authorize(context.Background(), "unknown", "/metrics"), ErrUnauthenticated)
+	assert.Len(t, authorizer.results, 1, "Invalid tokens should not be cached")
+}
+
+func TestNewTokenAuthorizer_Token(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("secret\n"), 0600))
+	authorizer, err := NewTokenAuthorizer(AuthModeToken, tokenFile, nil)
+	require.NoError(t, err)
+	assert.NoError(t, authorizer.Authorize(context.Background(), "secret", "/metrics"))
+	assert.ErrorIs(t, authorizer.Authorize(context.Background(), "other", "/metrics"), ErrUnauthenticated)
+
+	authorizer, err = NewTokenAuthorizer("", "", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, authorizer, "Requests should not be authorized without mode")
+
+	emptyFile := filepath.Join(t.TempDir(), "empty")
+	require.NoError(t, os.WriteFile(emptyFile, nil, 0600))
+	for _, tc := range [][2]string{{AuthModeToken, ""}, {AuthModeToken, emptyFile}, {AuthModeToken, filepath.Join(t.TempDir(), "missing")}, {"basic", ""}} {
+		_, err = NewTokenAuthorizer(tc[0], tc[1], nil)
+		assert.Error(t, err, "%v", tc)
+	}
+}
+
+func TestStartServer_Auth(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("secret"), 0600))
+	authorizer, err := NewTokenAuthorizer(AuthModeToken, tokenFile, nil)
+	require.NoError(t, err)
+	l, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	require.NoError(t, l.Close())
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write([]byte("metrics")) })
+	srv, err := StartServer(t.Context(), ServerOptions{Port: port, Health: true, Pprof: true, Metrics: metrics, MetricsPath: "/metrics", Auth: authorizer})
+	require.NoError(t, err)
+	defer func() { _ = srv.Close() }()
+
+	for _, tc := range []struct {
+		path     string
+		token    string
+		expected int
+	}{
+		{"/health", "", http.StatusOK},
+		{"/metrics", "", http.StatusUnauthorized},
+		{"/debug/pprof/", "", http.StatusUnauthorized},
+		{"/metrics", "secret", http.StatusOK},
+		{"/debug/pprof/", "secret", http.StatusOK},
+	} {
+		request := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if len(tc.token) > 0 {
+			request.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		recorder := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(recorder, request)
+		assert.Equal(t, tc.expected, recorder.Code, "%s with token %q", tc.path, tc.token)
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -12,29 +13,75 @@ import (
 	"time"
 )
 
+// pprofPath is the prefix of pprof endpoints. All of them are authorized as this path
+const pprofPath = "/debug/pprof/"
+
+// ServerOptions choose endpoints served by the HTTP server
+type ServerOptions struct {
+	Port string
+	// Health enables /health endpoint
+	Health bool
+	// Pprof enables /debug/pprof endpoints
+	Pprof bool
+	// Metrics is served on MetricsPath if it is set
+	Metrics     http.Handler
+	MetricsPath string
+	// TLS enables HTTPS if it is set
+	TLS *tls.Config
+	// RequireClientCertificate protects metrics and pprof endpoints by certificates of clients verified by TLS
+	RequireClientCertificate bool
+	// Auth protects metrics and pprof endpoints if it is set. Health endpoint is not protected, so probes can use it
+	Auth TokenAuthorizer
+}
+
 func StartHealthEndpoint(ctx context.Context, pprofEnabled bool, port string) (*http.Server, error) {
-	if !IsPortValid(port) {
-		return nil, fmt.Errorf("port is not valid for metrics endpoint. Given value: %v", port)
+	return StartServer(ctx, ServerOptions{Port: port, Health: true, Pprof: pprofEnabled})
+}
+
+// StartServer starts the HTTP server with endpoints chosen by options, so health, pprof and metrics can share one port
+func StartServer(ctx context.Context, options ServerOptions) (*http.Server, error) {
+	if !IsPortValid(options.Port) {
+		return nil, fmt.Errorf("port is not valid for HTTP server. Given value: %v", options.Port)
+	}
+	protect := func(path string, handler http.Handler) http.Handler {
+		if options.Auth != nil {
+			handler = RequireToken(options.Auth, path, handler)
+		}
+		if options.RequireClientCertificate {
+			handler = RequireClientCertificate(handler)
+		}
+		return handler
 	}
 	mux := http.NewServeMux()
-	mux.HandleFunc("/health", healthCheck)
-	if pprofEnabled {
-		mux.HandleFunc("/debug/pprof/", pprof.Index)
-		mux.HandleFunc("/debug/pprof/{action}", pprof.Index)
-		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	if options.Health {
+		mux.HandleFunc("/health", healthCheck)
+	}
+	if options.Pprof {
+		mux.Handle(pprofPath, protect(pprofPath, http.HandlerFunc(pprof.Index)))
+		mux.Handle(pprofPath+"{action}", protect(pprofPath, http.HandlerFunc(pprof.Index)))
+		mux.Handle(pprofPath+"symbol", protect(pprofPath, http.HandlerFunc(pprof.Symbol)))
+	}
+	if options.Metrics != nil {
+		mux.Handle(options.MetricsPath, protect(options.MetricsPath, options.Metrics))
 	}
 	srv := http.Server{
-		Addr:         net.JoinHostPort("", port),
+		Addr:         net.JoinHostPort("", options.Port),
 		Handler:      mux,
 		WriteTimeout: time.Second * 15,
 		ReadTimeout:  time.Second * 15,
 		IdleTimeout:  time.Second * 60,
+		TLSConfig:    options.TLS,
 		BaseContext: func(_ net.Listener) context.Context {
 			return ctx
 		},
 	}
 	go func() {
-		exit := srv.ListenAndServe()
+		var exit error
+		if srv.TLSConfig != nil {
+			exit = srv.ListenAndServeTLS("", "")
+		} else {
+			exit = srv.ListenAndServe()
+		}
 		if !errors.Is(exit, http.ErrServerClosed) {
 			slog.Error(fmt.Sprintf("failed to start HTTP server. Error: %s", exit))
 		}
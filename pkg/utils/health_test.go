@@ -61,6 +61,44 @@ func TestStartHealthEndpointRegistersHandlers(t *testing.T) {
 	}
 }
 
+func TestStartServerServesChosenEndpoints(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("failed to find free port: %v", err)
+	}
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	if err = l.Close(); err != nil {
+		t.Fatalf("failed to close listener: %v", err)
+	}
+
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("metrics"))
+	})
+	srv, err := StartServer(t.Context(), ServerOptions{Port: port, Metrics: metrics, MetricsPath: "/custom-metrics"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), time.Second)
+		defer shutdownCancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	recorder := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/custom-metrics", nil))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "metrics" {
+		t.Fatalf("expected metrics on the configured path, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	for _, path := range []string{"/health", "/debug/pprof/"} {
+		recorder = httptest.NewRecorder()
+		srv.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != http.StatusNotFound {
+			t.Fatalf("expected %s not to be registered, got %d", path, recorder.Code)
+		}
+	}
+}
+
 func TestHealthCheckIgnoresNonGet(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/health", nil)
 	recorder := httptest.NewRecorder()
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// certificateReloadInterval is the interval of checks of files of the certificate, so renewed certificates are used
+// without restart
+const certificateReloadInterval = 30 * time.Second
+
+// certificateReloader keeps the certificate of the server and the CA of clients read from files up to date
+type certificateReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	mu          sync.RWMutex
+	certificate *tls.Certificate
+	// clientCAs is nil if certificates of clients are not verified
+	clientCAs *x509.CertPool
+	// contents are the last loaded contents of files, so files are parsed only when they change
+	contents [][]byte
+}
+
+// NewTLSConfig creates the configuration of the server with the certificate and the key reloaded from files until the
+// context is done. Certificates presented by clients are verified by the CA from clientCAFile if it is set. Connections
+// without certificates are accepted, so probes can get /health, and RequireClientCertificate protects other endpoints
+func NewTLSConfig(ctx context.Context, certFile string, keyFile string, clientCAFile string) (*tls.Config, error) {
+	if len(certFile) == 0 || len(keyFile) == 0 {
+		return nil, errors.New("both certificate and key files must be set for TLS")
+	}
+	reloader := &certificateReloader{certFile: certFile, keyFile: keyFile, clientCAFile: clientCAFile}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	go reloader.watch(ctx, certificateReloadInterval)
+	return &tls.Config{MinVersion: tls.VersionTLS12, GetConfigForClient: reloader.config}, nil
+}
+
+// reload reads files and replaces the certificate and the CA if files are changed and valid
+func (r *certificateReloader) reload() error {
+	files := []string{r.certFile, r.keyFile}
+	if len(r.clientCAFile) > 0 {
+		files = append(files, r.clientCAFile)
+	}
+	contents := make([][]byte, len(files))
+	for i, file := range files {
+		var err error
+		if contents[i], err = os.ReadFile(file); err != nil {
+			return fmt.Errorf("could not read TLS file: %w", err)
+		}
+	}
+	r.mu.RLock()
+	unchanged := r.contents != nil && slices.EqualFunc(r.contents, contents, bytes.Equal)
+	r.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+	certificate, err := tls.X509KeyPair(contents[0], contents[1])
+	if err != nil {
+		return fmt.Errorf("could not parse TLS certificate %s: %w", r.certFile, err)
+	}
+	var clientCAs *x509.CertPool
+	if len(r.clientCAFile) > 0 {
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(contents[2]) {
+			return fmt.Errorf("no certificates are found in client CA file %s", r.clientCAFile)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.certificate = &certificate
+	r.clientCAs = clientCAs
+	r.contents = contents
+	return nil
+}
+
+// watch reloads files until the context is done. The previous certificate is kept if files are not valid
+func (r *certificateReloader) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.reload(); err != nil {
+				slog.Error("could not reload TLS certificate, the previous certificate is used", "error", err)
+			}
+		}
+	}
+}
+
+// config returns the configuration with the current certificate and CA for the new connection
+func (r *certificateReloader) config(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	config := &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{*r.certificate}}
+	if r.clientCAs != nil {
+		config.ClientCAs = r.clientCAs
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// RequireClientCertificate serves the request by the handler only if the client presented the certificate verified by
+// the client CA of the TLS configuration
+func RequireClientCertificate(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		if request.TLS == nil || len(request.TLS.VerifiedChains) == 0 {
+			http.Error(responseWriter, "client certificate is required", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(responseWriter, request)
+	})
+}
@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	certPEM     []byte
+	keyPEM      []byte
+}
+
+// newTestCertificate creates the certificate signed by the parent or self-signed CA if the parent is nil
+func newTestCertificate(t *testing.T, commonName string, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.certificate, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return &testCertificate{
+		certificate: certificate,
+		key:         key,
+		certPEM:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:      pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (c *testCertificate) write(t *testing.T, certFile string, keyFile string) {
+	require.NoError(t, os.WriteFile(certFile, c.certPEM, 0600))
+	require.NoError(t, os.WriteFile(keyFile, c.keyPEM, 0600))
+}
+
+func TestCertificateReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	ca := newTestCertificate(t, "ca", nil)
+	newTestCertificate(t, "first", ca).write(t, certFile, keyFile)
+
+	reloader := &certificateReloader{certFile: certFile, keyFile: keyFile}
+	require.NoError(t, reloader.reload())
+	config, err := reloader.config(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "first", config.Certificates[0].Leaf.Subject.CommonName)
+	assert.Equal(t, tls.NoClientCert, config.ClientAuth, "Certificates of clients should not be required without client CA")
+
+	newTestCertificate(t, "second", ca).write(t, certFile, keyFile)
+	require.NoError(t, reloader.reload())
+	config, err = reloader.config(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "second", config.Certificates[0].Leaf.Subject.CommonName, "Changed certificate should be reloaded")
+
+	require.NoError(t, os.WriteFile(keyFile, []byte("invalid"), 0600))
+	assert.Error(t, reloader.reload())
+	config, err = reloader.config(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "second", config.Certificates[0].Leaf.Subject.CommonName, "Previous certificate should be kept if files are not valid")
+}
+
+func TestNewTLSConfig_ClientCA(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	ca := newTestCertificate(t, "ca", nil)
+	newTestCertificate(t, "server", ca).write(t, certFile, keyFile)
+	require.NoError(t, os.WriteFile(caFile, ca.certPEM, 0600))
+
+	config, err := NewTLSConfig(t.Context(), certFile, keyFile, caFile)
+	require.NoError(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	require.NoError(t, l.Close())
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write([]byte("metrics")) })
+	srv, err := StartServer(t.Context(), ServerOptions{Port: port, Health: true, Metrics: metrics, MetricsPath: "/metrics", TLS: config, RequireClientCertificate: true})
+	require.NoError(t, err)
+	defer func() { _ = srv.Close() }()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.certificate)
+	get := func(path string, certificates ...tls.Certificate) (int, error) {
+		clientConfig := &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12}
+		if len(certificates) > 0 {
+			// The certificate is presented even if it is not signed by CAs accepted by the server
+			clientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return &certificates[0], nil }
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+		resp, err := client.Get("https://127.0.0.1:" + port + path)
+		if err != nil {
+			return 0, err
+		}
+		return resp.StatusCode, resp.Body.Close()
+	}
+	require.Eventually(t, func() bool {
+		_, err := get("/health")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond, "Health endpoint should be served without client certificate")
+	status, err := get("/metrics")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status, "Metrics should not be served without client certificate")
+
+	other := newTestCertificate(t, "other-ca", nil)
+	untrusted := newTestCertificate(t, "client", other)
+	certificate, err := tls.X509KeyPair(untrusted.certPEM, untrusted.keyPEM)
+	require.NoError(t, err)
+	_, err = get("/metrics", certificate)
+	assert.Error(t, err, "Clients with certificates of other CA should be rejected")
+
+	trusted := newTestCertificate(t, "client", ca)
+	certificate, err = tls.X509KeyPair(trusted.certPEM, trusted.keyPEM)
+	require.NoError(t, err)
+	status, err = get("/metrics", certificate)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestNewTLSConfig_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	newTestCertificate(t, "server", nil).write(t, certFile, keyFile)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "empty.crt"), nil, 0600))
+
+	for _, files := range [][3]string{
+		{certFile, "", ""},
+		{certFile, filepath.Join(dir, "missing.key"), ""},
+		{keyFile, certFile, ""},
+		{certFile, keyFile, filepath.Join(dir, "empty.crt")},
+	} {
+		_, err := NewTLSConfig(t.Context(), files[0], files[1], files[2])
+		assert.Error(t, err, "%v", files)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 )
 
@@ -35,3 +36,20 @@ func Shutdown(ctx context.Context, timeout time.Duration, finalizers ...ReleaseF
 		return fmt.Errorf("failed to release resources in time")
 	}
 }
+
+// stopControllers closes the stop channel of controllers and waits until they release events taken from queues
+// or the context is done
+func stopControllers(ctx context.Context, stop chan struct{}, running *sync.WaitGroup) {
+	close(stop)
+	done := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		slog.Info("controllers are stopped")
+	case <-ctx.Done():
+		slog.Error("controllers did not release events to sinks in time")
+	}
+}
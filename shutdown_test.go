@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -32,6 +34,29 @@ func TestShutdownReturnsTimeoutError(t *testing.T) {
 	}
 }
 
+func TestStopControllersWaitsForControllers(t *testing.T) {
+	stop := make(chan struct{})
+	var running sync.WaitGroup
+	var released atomic.Bool
+	running.Go(func() {
+		<-stop
+		time.Sleep(10 * time.Millisecond)
+		released.Store(true)
+	})
+
+	stopControllers(context.Background(), stop, &running)
+	if !released.Load() {
+		t.Fatal("expected controllers to release events before return")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	var blocked sync.WaitGroup
+	blocked.Add(1)
+	defer blocked.Done()
+	stopControllers(ctx, make(chan struct{}), &blocked)
+}
+
 func TestValidateFormatInput(t *testing.T) {
 	if err := validateFormatInput("short-format"); err != nil {
 		t.Fatalf("unexpected validation error: %v", err)